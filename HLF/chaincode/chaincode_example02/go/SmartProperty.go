@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
@@ -15,6 +16,50 @@ import (
 type ManageProperties struct {
 }
 
+// eventVersion is bumped whenever the DomainEvent body changes incompatibly
+const eventVersion = "1.0"
+
+// typed event names, Fabric keeps a single event per transaction
+const (
+	PoliciesIssued = "PoliciesIssued"
+)
+
+// DomainEvent is the versioned body carried by every chaincode event, the envelope of
+// events.go in the supply chain chaincode. The two chaincodes are packaged apart, so
+// this copy and emitBatchEvent must be kept in sync with it by hand.
+type DomainEvent struct {
+	Version   string   `json:"version"`
+	EventType string   `json:"eventType"`
+	EntityID  string   `json:"entityID"`
+	EntityIDs []string `json:"entityIDs,omitempty"`
+	OldState  string   `json:"oldState"`
+	NewState  string   `json:"newState"`
+	ActorMSP  string   `json:"actorMSP"`
+	TxID      string   `json:"txID"`
+}
+
+// emitBatchEvent sets one typed event for every entity a transaction moved from oldState to newState
+func emitBatchEvent(stub shim.ChaincodeStubInterface, eventType string, entityIDs []string, oldState, newState string) error {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+	event := DomainEvent{
+		Version:   eventVersion,
+		EventType: eventType,
+		EntityIDs: entityIDs,
+		OldState:  oldState,
+		NewState:  newState,
+		ActorMSP:  mspID,
+		TxID:      stub.GetTxID(),
+	}
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(eventType, eventAsBytes)
+}
+
 type PolicyImage struct {
 	DocumentIdHash string `json:"documentIdHash"`
 	FileName       string `json:"fileName,omitempty"`
@@ -149,11 +194,6 @@ func (t *ManageProperties) Invoke(stub shim.ChaincodeStubInterface) sc.Response
 	
 
 	fmt.Println("invoke did not find func: " + function)
-	errMsg := "{ \"message\" : \"Received unknown function invocation\", \"code\" : \"503\"}"
-	err := stub.SetEvent("errEvent", []byte(errMsg))
-	if err != nil {
-		return shim.Error(err.Error())
-	}
 	return shim.Error("Invalid Smart Contract function name.")
 }
 
@@ -163,16 +203,11 @@ func (t *ManageProperties) Invoke(stub shim.ChaincodeStubInterface) sc.Response
 func (t *ManageProperties) getPropertybyId(stub shim.ChaincodeStubInterface, args []string) sc.Response {
 	var jsonResp, errResp string
 	fmt.Println("start getPropertybyId")
-	fmt.Println("start getPropertybyId", args[0])
 	var err error
 	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\" \" as an argument\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return shim.Success(nil)
+		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
+	fmt.Println("start getPropertybyId", args[0])
 	_propertyId := args[0]
 
 	jsonResp = ""
@@ -182,11 +217,7 @@ func (t *ManageProperties) getPropertybyId(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(errResp)
 	} else if valueAsBytes == nil {
 		fmt.Println(_propertyId + " not found")
-		errMsg := "{ \"Property\" : \"" + _propertyId + "\",\"message\" : \"" + "Property Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+		return shim.Error("property does not exist: " + _propertyId)
 	} else {
 		jsonResp = string(valueAsBytes[:])
 	}
@@ -203,12 +234,7 @@ func (t *ManageProperties) getPolicybyId(stub shim.ChaincodeStubInterface, args
 	fmt.Println("start getPolicybyId")
 	var err error
 	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\" \" as an argument\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return shim.Success(nil)
+		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
 	_policyId := args[0]
@@ -220,11 +246,7 @@ func (t *ManageProperties) getPolicybyId(stub shim.ChaincodeStubInterface, args
 		return shim.Error(errResp)
 	} else if valueAsBytes == nil {
 		fmt.Println(_policyId + " not found")
-		errMsg := "{ \"PolicyId\" : \"" + _policyId + "\",\"message\" : \"" + "Policy Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+		return shim.Error("policy does not exist: " + _policyId)
 	} else {
 		jsonResp = string(valueAsBytes[:])
 	}
@@ -239,7 +261,7 @@ func (t *ManageProperties) getPolicybyId(stub shim.ChaincodeStubInterface, args
 func (t *ManageProperties) createPolicy(stub shim.ChaincodeStubInterface, args []string) sc.Response {
 	var err error
 	var PropertyAsBytes []byte
-	var tosend, _propertyId, _policyId string
+	var _propertyId, _policyId string
 	var propertyIdArray, policyIdArray []string
 
 	fmt.Println("start createPolicy--------------")
@@ -320,16 +342,19 @@ func (t *ManageProperties) createPolicy(stub shim.ChaincodeStubInterface, args [
 			policyIdArray = append(policyIdArray, newPolicy.PolicyId)
 		}
 	}
-	tosend = "{  \"message\" : \"Polices stored successfully on legder. Please find below details for more information.\",\"Policies successfully stored on ledger with policyIds \" : \"" + strings.Join(policyIdArray, ",") + "\", \"Properties successfully created/updated with propertyIds\" : \"" + strings.Join(propertyIdArray, ",") + "\", \"code\" : \"200\"}"
-	fmt.Println("event message: " + tosend)
-	err = stub.SetEvent("evtsender", []byte(tosend))
+	// ==== One PoliciesIssued event names every policy stored by the transaction ====
+	err = emitBatchEvent(stub, PoliciesIssued, policyIdArray, "", "issued")
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	fmt.Println("end createPolicy")
 
-	return shim.Success(nil)
+	issuedAsBytes, err := json.Marshal(map[string][]string{"policyIds": policyIdArray, "propertyIds": propertyIdArray})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(issuedAsBytes)
 }
 
 
@@ -343,12 +368,7 @@ func (t *ManageProperties) getPropertyPolicies(stub shim.ChaincodeStubInterface,
 	fmt.Println("start getPropertyPolicies method")
 	var err error
 	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\" \" as an argument\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return shim.Success(nil)
+		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
 
 	_propertyId := args[0]
@@ -358,11 +378,7 @@ func (t *ManageProperties) getPropertyPolicies(stub shim.ChaincodeStubInterface,
 		return shim.Error(errResp)
 	} else if propertyValueAsBytes == nil {
 		fmt.Println(_propertyId + " not found")
-		errMsg := "{ \"_propertyId\" : \"" + _propertyId + "\",\"message\" : \"" + "Property Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+		return shim.Error("property does not exist: " + _propertyId)
 	} else {
 		propertyJsonResp = string(propertyValueAsBytes[:])
 	}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// identityParticipantIndex maps a submitter (MSP ID + certificate common name) to its participant
+const identityParticipantIndex = "identity~participant"
+
+// adminAttribute marks registry maintainers that are not themselves participants.
+// Holders in the admin MSP configured at Init administer the network, holders in
+// any other MSP only maintain the organization and participants of their own MSP.
+const adminAttribute = "supplychain.admin"
+
+// configObjectType holds the chaincode configuration written at Init:
+// adminMSPKey the MSP ID whose supplychain.admin identities administer the chaincode,
+// clearingAdminKey the enrollment ID of the single admin allowed to deposit funds
+const (
+	configObjectType = "config"
+	adminMSPKey      = "adminMSP"
+	clearingAdminKey = "clearingAdmin"
+)
+
+// getConfig reads a configuration value, empty before Init set it
+func getConfig(stub shim.ChaincodeStubInterface, key string) (string, error) {
+	valueAsBytes, err := getObjectState(stub, configObjectType, key)
+	if err != nil {
+		return "", err
+	}
+	return string(valueAsBytes), nil
+}
+
+// accessRule lists who may call a chaincode function.
+// MSPAdmin lets the admins of every MSP in, the function then limits them to their own MSP.
+type accessRule struct {
+	Roles    []Role
+	Admin    bool
+	MSPAdmin bool
+}
+
+// allRoles is every participant role
+var allRoles = []Role{customer, seller, driver, LogisticArgument, LogisticManager}
+
+// functionPermissions is the per-function permission matrix.
+// Functions that are not listed are queries open to every active participant and admin.
+var functionPermissions = map[string]accessRule{
+	"createOrganization":      {Admin: true},
+	"updateOrganization":      {Admin: true, MSPAdmin: true},
+	"deactivateOrganization":  {Admin: true, MSPAdmin: true},
+	"createParticipantUser":   {Admin: true, MSPAdmin: true},
+	"assignSecurityRole":      {Admin: true, MSPAdmin: true},
+	"deactivateParticipant":   {Admin: true, MSPAdmin: true},
+	"createShipment":          {Roles: []Role{seller}},
+	"createShipmentsBatch":    {Roles: []Role{seller}},
+	"transferShipment":        {Roles: allRoles},
+	"updateShipmentState":     {Roles: []Role{seller, driver, LogisticManager, customer}},
+	"validatePurchaseOrder":   {Roles: []Role{seller}},
+	"preparePurchaseOrder":    {Roles: []Role{seller}},
+	"shipPurchaseOrder":       {Roles: []Role{seller}},
+	"deliverPurchaseOrder":    {Roles: []Role{customer}},
+	"rejectPurchaseOrder":     {Roles: []Role{seller, customer}},
+	"requestPayment":          {Roles: []Role{seller}},
+	"markPaid":                {Roles: []Role{seller}},
+	"createLogisticUnit":      {Roles: []Role{seller, LogisticManager}},
+	"packageLogistic":         {Roles: []Role{seller, LogisticManager}},
+	"moveLogisticUnit":        {Roles: []Role{driver, LogisticManager}},
+	"updateLogisticUnitState": {Roles: []Role{seller, driver, LogisticManager}},
+	"raiseDispute":            {Roles: allRoles},
+	"commentOnDispute":        {Roles: allRoles},
+	"resolveDispute":          {Roles: []Role{customer, seller}},
+	"proposeHandover":         {Roles: allRoles},
+	"acceptHandover":          {Roles: allRoles},
+	"depositFunds":            {Admin: true},
+	"recordReceipt":           {Roles: []Role{customer}},
+	"setComplianceThresholds": {Roles: []Role{seller, LogisticManager}},
+	"recordTelemetry":         {Roles: []Role{driver, LogisticManager}},
+	"updateShipmentPosition":  {Roles: []Role{driver, LogisticManager}},
+	"setSLAContract":          {Admin: true, Roles: []Role{seller, LogisticManager}},
+	"createCarrier":           {Admin: true, Roles: []Role{seller, LogisticManager}},
+	"updateCarrier":           {Admin: true, Roles: []Role{seller, LogisticManager}},
+	"deactivateCarrier":       {Admin: true, Roles: []Role{seller, LogisticManager}},
+	"createCustomer":          {Admin: true, Roles: []Role{seller}},
+	"updateCustomer":          {Admin: true, Roles: []Role{seller}},
+	"deactivateCustomer":      {Admin: true, Roles: []Role{seller}},
+	"archiveShipment":         {Admin: true, Roles: []Role{seller}},
+	"archivePurchaseOrder":    {Admin: true, Roles: []Role{seller}},
+	"deleteShipment":          {Admin: true},
+	"deletePurchaseOrder":     {Admin: true},
+	"getPurgeCandidates":      {Admin: true},
+}
+
+// shipmentStatePermissions narrows updateShipmentState by the state being entered
+var shipmentStatePermissions = map[ShipmentOrderState][]Role{
+	loading:             {seller, driver, LogisticManager},
+	loaded:              {seller, driver, LogisticManager},
+	inTransit:           {driver, LogisticManager},
+	deliveredComplete:   {customer},
+	deliveredIncomplete: {customer},
+}
+
+// caller is the resolved submitter of the current transaction.
+// Admin is the network admin, MSPAdmin any identity carrying the admin attribute.
+type caller struct {
+	MSPID        string
+	EnrollmentID string
+	Admin        bool
+	MSPAdmin     bool
+	Participant  *ParticipantUser
+}
+
+// hasRole reports whether the caller is an active participant holding one of the roles
+func (c caller) hasRole(roles []Role) bool {
+	if c.Participant == nil || !c.Participant.Active {
+		return false
+	}
+	for _, role := range roles {
+		if c.Participant.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// accessDenied is the structured error returned and logged when a call is refused
+type accessDenied struct {
+	Message       string `json:"message"`
+	Function      string `json:"function"`
+	MSPID         string `json:"mspID"`
+	EnrollmentID  string `json:"enrollmentID"`
+	ParticipantID string `json:"participantID,omitempty"`
+	Role          string `json:"role,omitempty"`
+	Code          string `json:"code"`
+}
+
+// getCaller resolves the submitter through the client identity library to a participant.
+// Identities carrying the supplychain.admin=true attribute are admins of their MSP, those of the
+// administrator MSP configured at Init are the network admin. The Admin@ certificates of the
+// member organizations are not admins.
+func getCaller(stub shim.ChaincodeStubInterface) (caller, error) {
+	var c caller
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return c, err
+	}
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return c, err
+	}
+	c.MSPID = mspID
+	c.EnrollmentID = cert.Subject.CommonName
+
+	if err := cid.AssertAttributeValue(stub, adminAttribute, "true"); err == nil {
+		adminMSP, err := getConfig(stub, adminMSPKey)
+		if err != nil {
+			return c, err
+		}
+		c.MSPAdmin = true
+		c.Admin = len(adminMSP) > 0 && adminMSP == c.MSPID
+	}
+
+	indexKey, err := stub.CreateCompositeKey(identityParticipantIndex, []string{c.MSPID, c.EnrollmentID})
+	if err != nil {
+		return c, err
+	}
+	participantIDAsBytes, err := stub.GetState(indexKey)
+	if err != nil {
+		return c, err
+	} else if participantIDAsBytes == nil {
+		return c, nil
+	}
+	participant, err := getParticipant(stub, string(participantIDAsBytes))
+	if err != nil {
+		return c, err
+	}
+	c.Participant = &participant
+	return c, nil
+}
+
+// checkAccess evaluates the permission matrix for a function. A nil result means access is granted.
+func checkAccess(c caller, function string) *accessDenied {
+	rule, restricted := functionPermissions[function]
+	if !restricted {
+		if c.MSPAdmin || (c.Participant != nil && c.Participant.Active) {
+			return nil
+		}
+		return newAccessDenied(c, function, "caller is not a registered participant")
+	}
+	if (rule.Admin && c.Admin) || (rule.MSPAdmin && c.MSPAdmin) {
+		return nil
+	}
+	if c.hasRole(rule.Roles) {
+		return nil
+	}
+	return newAccessDenied(c, function, "caller is not permitted to invoke "+function)
+}
+
+// canMaintainMSP reports whether the caller may maintain the organization and participants bound to an MSP
+func (c caller) canMaintainMSP(mspID string) bool {
+	return c.Admin || (c.MSPAdmin && c.MSPID == mspID)
+}
+
+// checkShipmentStateAccess evaluates whether the caller may move a shipment into the given state
+func checkShipmentStateAccess(c caller, to ShipmentOrderState) *accessDenied {
+	if c.hasRole(shipmentStatePermissions[to]) {
+		return nil
+	}
+	return newAccessDenied(c, "updateShipmentState", "caller is not permitted to move a shipment to "+to.String())
+}
+
+func newAccessDenied(c caller, function, message string) *accessDenied {
+	denied := &accessDenied{
+		Message:      message,
+		Function:     function,
+		MSPID:        c.MSPID,
+		EnrollmentID: c.EnrollmentID,
+		Code:         "403",
+	}
+	if c.Participant != nil {
+		denied.ParticipantID = c.Participant.ParticipantID
+		denied.Role = c.Participant.Role.String()
+	}
+	return denied
+}
+
+// denyAccess logs the denial and returns it as the structured error response.
+// An error response is never committed, so the denial cannot be an event.
+func denyAccess(stub shim.ChaincodeStubInterface, denied *accessDenied) pb.Response {
+	errMsg, err := json.Marshal(denied)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("access denied: " + string(errMsg))
+	return shim.Error(string(errMsg))
+}
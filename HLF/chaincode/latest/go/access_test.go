@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestCheckAccess(t *testing.T) {
+	active := func(role Role) *ParticipantUser {
+		return &ParticipantUser{ParticipantID: "participant01", Role: role, Active: true}
+	}
+	tests := []struct {
+		name     string
+		c        caller
+		function string
+		want     bool
+	}{
+		{"network admin registers organizations", caller{Admin: true, MSPAdmin: true}, "createOrganization", true},
+		{"MSP admin cannot register organizations", caller{MSPAdmin: true}, "createOrganization", false},
+		{"MSP admin registers participants", caller{MSPAdmin: true}, "createParticipantUser", true},
+		{"MSP admin queries", caller{MSPAdmin: true}, "getOrganizationbyName", true},
+		{"seller creates shipments", caller{Participant: active(seller)}, "createShipment", true},
+		{"driver cannot create shipments", caller{Participant: active(driver)}, "createShipment", false},
+		{"deactivated seller", caller{Participant: &ParticipantUser{Role: seller}}, "createShipment", false},
+		{"admin is not a seller", caller{Admin: true, MSPAdmin: true}, "createShipment", false},
+		{"participant queries", caller{Participant: active(driver)}, "readShipmentData", true},
+		{"unregistered identity queries", caller{}, "readShipmentData", false},
+		{"customer cannot deposit", caller{Participant: active(customer)}, "depositFunds", false},
+	}
+	for _, tt := range tests {
+		if got := checkAccess(tt.c, tt.function) == nil; got != tt.want {
+			t.Errorf("%s: granted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeniedCallIsNotCommitted(t *testing.T) {
+	s := newTestStub(t, networkAdmin.MSPID, networkAdmin.EnrollmentID)
+	s.mustCreateOrganization(networkAdmin, "Org1", "Org1MSP")
+	events := len(s.events)
+
+	s.mustDeny(sellerUser, "createOrganization", `{"name":"Org2","mspID":"Org2MSP"}`)
+	if len(s.events) != events {
+		t.Errorf("a denied call committed event %s", s.events[len(s.events)-1].EventName)
+	}
+	s.mustFail(networkAdmin, "does not exist", "getOrganizationbyName", "Org2")
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// archivable reads the archived flag of any stored object
+type archivable struct {
+	Archived bool `json:"archived"`
+}
+
+// PurgeCandidate is a record past the retention period. BlockedBy lists the shipments
+// that still reference a purchase order and must be deleted first.
+type PurgeCandidate struct {
+	ObjectType   string    `json:"objectType"`
+	ID           string    `json:"id"`
+	State        string    `json:"state"`
+	Archived     bool      `json:"archived"`
+	LastActivity time.Time `json:"lastActivity"`
+	BlockedBy    []string  `json:"blockedBy,omitempty"`
+}
+
+// RetentionReport lists the records of one page whose last activity is older than the cutoff.
+// Bookmark resumes the scan with the next page, it is empty after the last page.
+type RetentionReport struct {
+	RetentionDays int              `json:"retentionDays"`
+	Cutoff        time.Time        `json:"cutoff"`
+	ObjectType    string           `json:"objectType"`
+	Candidates    []PurgeCandidate `json:"candidates"`
+	Bookmark      string           `json:"bookmark"`
+}
+
+// lastActivity is the latest state transition, delivery or archival of a record
+func lastActivity(history []StateTransition, archivedAt *time.Time, other ...time.Time) time.Time {
+	var latest time.Time
+	for _, transition := range history {
+		if transition.Timestamp.After(latest) {
+			latest = transition.Timestamp
+		}
+	}
+	if archivedAt != nil && archivedAt.After(latest) {
+		latest = *archivedAt
+	}
+	for _, date := range other {
+		if date.After(latest) {
+			latest = date
+		}
+	}
+	return latest
+}
+
+// checkShipmentPurgeable allows the hard delete of delivered shipments without an open dispute
+func checkShipmentPurgeable(shipment Shipment) error {
+	if !shipment.ShipmentOrderState.isDelivered() {
+		return fmt.Errorf("shipment %s is %s, only delivered shipments can be deleted", shipment.ShipmentID, shipment.ShipmentOrderState.String())
+	}
+	if shipment.Dispute {
+		return fmt.Errorf("shipment %s is frozen by open dispute %s", shipment.ShipmentID, shipment.DisputeID)
+	}
+	return nil
+}
+
+// checkPurchaseOrderPurgeable allows the hard delete of rejected or paid purchase orders
+// that no shipment references anymore
+func checkPurchaseOrderPurgeable(purchaseOrder PurchaseOrder, shipmentIDs []string) error {
+	if !purchaseOrder.State.isTerminal() {
+		return fmt.Errorf("purchase order %s is %s, only rejected or paid purchase orders can be deleted", purchaseOrder.PurchaseOrderID, purchaseOrder.State.String())
+	}
+	if len(shipmentIDs) > 0 {
+		return fmt.Errorf("purchase order %s is still referenced by shipments %v, delete them first", purchaseOrder.PurchaseOrderID, shipmentIDs)
+	}
+	return nil
+}
+
+// ===========================================================================
+// archiveShipment - make a shipment read-only and hide it from list queries.
+// In-progress shipments and shipments under an open dispute cannot be archived.
+// args: shipmentID
+// ===========================================================================
+func (t *SupplyChainChaincode) archiveShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	shipmentID := args[0]
+	fmt.Println("- start archiveShipment ", shipmentID)
+
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment.Dispute {
+		return shim.Error("shipment " + shipmentID + " is frozen by open dispute " + shipment.DisputeID)
+	}
+	// ==== An archived shipment can never be delivered, so it must not hold up an escrow ====
+	if shipment.ShipmentOrderState != waiting && !shipment.ShipmentOrderState.isDelivered() {
+		return shim.Error("shipment " + shipmentID + " is " + shipment.ShipmentOrderState.String() + ", only waiting or delivered shipments can be archived")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment.Archived = true
+	shipment.ArchivedAt = &txTime
+	shipment.ObjectType = shipmentObjectType
+	shipmentAsBytes, err := json.Marshal(shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putObjectState(stub, shipmentObjectType, shipmentID, shipmentAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putShipmentStatus(stub, shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end archiveShipment (success)")
+	if err = emitEvent(stub, ShipmentArchived, shipmentID, shipment.ShipmentOrderState.String(), "archived"); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(shipmentAsBytes)
+}
+
+// ===========================================================================
+// archivePurchaseOrder - make a purchase order read-only and hide it from list queries.
+// A purchase order whose funds are locked in escrow cannot be archived.
+// args: purchaseOrderID
+// ===========================================================================
+func (t *SupplyChainChaincode) archivePurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	purchaseOrderID := args[0]
+	fmt.Println("- start archivePurchaseOrder ", purchaseOrderID)
+
+	purchaseOrder, err := getPurchaseOrder(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if purchaseOrder.Archived {
+		return shim.Error("purchase order " + purchaseOrderID + " is archived and read-only")
+	}
+	escrow, err := getEscrow(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if escrow != nil && escrow.Status == escrowLocked {
+		return shim.Error("purchase order " + purchaseOrderID + " still has funds locked in escrow")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	purchaseOrder.Archived = true
+	purchaseOrder.ArchivedAt = &txTime
+	purchaseOrderAsBytes, err := json.Marshal(purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putObjectState(stub, purchaseOrderObjectType, purchaseOrderID, purchaseOrderAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end archivePurchaseOrder (success)")
+	if err = emitEvent(stub, PurchaseOrderArchived, purchaseOrderID, purchaseOrder.State.String(), "archived"); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(purchaseOrderAsBytes)
+}
+
+// ===========================================================================
+// deletePurchaseOrder - remove a rejected or paid purchase order and its private pricing
+// from state once no shipment references it. The ledger history of the key is kept.
+// args: purchaseOrderID
+// ===========================================================================
+func (t *SupplyChainChaincode) deletePurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	purchaseOrderID := args[0]
+	fmt.Println("- start deletePurchaseOrder ", purchaseOrderID)
+
+	purchaseOrder, err := getPurchaseOrder(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipmentIDs, err := getPurchaseOrderShipmentIDs(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = checkPurchaseOrderPurgeable(purchaseOrder, shipmentIDs); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(purchaseOrder.PriceCollection) > 0 {
+		priceKey, err := stub.CreateCompositeKey(purchaseOrderObjectType, []string{purchaseOrderID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.DelPrivateData(purchaseOrder.PriceCollection, priceKey); err != nil {
+			return shim.Error("Failed to delete private pricing of " + purchaseOrderID + ": " + err.Error())
+		}
+	}
+	if err = deleteObjectState(stub, purchaseOrderObjectType, purchaseOrderID); err != nil {
+		return shim.Error("Failed to delete purchase order " + purchaseOrderID + ": " + err.Error())
+	}
+	fmt.Println("- end deletePurchaseOrder (success)")
+	if err = emitEvent(stub, PurchaseOrderDeleted, purchaseOrderID, purchaseOrder.State.String(), "deleted"); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ===========================================================================
+// getPurgeCandidates - retention policy: one page of the shipments or purchase orders, archived
+// or not, that deleteShipment or deletePurchaseOrder accept and whose last activity is older
+// than the retention period, counted back from the transaction timestamp.
+// Page through the shipments first, they have to be deleted before their purchase orders.
+// args: retentionDays, objectType (shipment or purchaseOrder), pageSize, bookmark
+// ===========================================================================
+func (t *SupplyChainChaincode) getPurgeCandidates(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting retentionDays, objectType, pageSize and bookmark")
+	}
+	retentionDays, err := strconv.Atoi(args[0])
+	if err != nil || retentionDays < 0 {
+		return shim.Error("retentionDays must be a non-negative integer: " + args[0])
+	}
+	objectType := args[1]
+	if objectType != shipmentObjectType && objectType != purchaseOrderObjectType {
+		return shim.Error("objectType must be " + shipmentObjectType + " or " + purchaseOrderObjectType + ": " + objectType)
+	}
+	pageSize, err := parsePageSize(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	report := RetentionReport{RetentionDays: retentionDays, Cutoff: txTime.AddDate(0, 0, -retentionDays), ObjectType: objectType, Candidates: []PurgeCandidate{}}
+
+	resultsIterator, responseMetadata, err := stub.GetStateByPartialCompositeKeyWithPagination(objectType, []string{}, pageSize, args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if objectType == shipmentObjectType {
+			var shipment Shipment
+			if err = json.Unmarshal(responseRange.Value, &shipment); err != nil {
+				return shim.Error(err.Error())
+			}
+			last := lastActivity(shipment.History, shipment.ArchivedAt, shipment.RealArrivedDate)
+			if checkShipmentPurgeable(shipment) != nil || last.After(report.Cutoff) {
+				continue
+			}
+			report.Candidates = append(report.Candidates, PurgeCandidate{
+				ObjectType:   shipmentObjectType,
+				ID:           shipment.ShipmentID,
+				State:        shipment.ShipmentOrderState.String(),
+				Archived:     shipment.Archived,
+				LastActivity: last,
+			})
+			continue
+		}
+		var purchaseOrder PurchaseOrder
+		if err = json.Unmarshal(responseRange.Value, &purchaseOrder); err != nil {
+			return shim.Error(err.Error())
+		}
+		last := lastActivity(purchaseOrder.History, purchaseOrder.ArchivedAt)
+		if !purchaseOrder.State.isTerminal() || last.After(report.Cutoff) {
+			continue
+		}
+		shipmentIDs, err := getPurchaseOrderShipmentIDs(stub, purchaseOrder.PurchaseOrderID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		report.Candidates = append(report.Candidates, PurgeCandidate{
+			ObjectType:   purchaseOrderObjectType,
+			ID:           purchaseOrder.PurchaseOrderID,
+			State:        purchaseOrder.State.String(),
+			Archived:     purchaseOrder.Archived,
+			LastActivity: last,
+			BlockedBy:    shipmentIDs,
+		})
+	}
+	if responseMetadata.FetchedRecordsCount >= pageSize {
+		report.Bookmark = responseMetadata.Bookmark
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(reportAsBytes)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// carriers are keyed by carrierID, the SCAC uniqueness index maps to the carrierID
+const (
+	carrierObjectType = "carrier"
+	carrierSCACIndex  = "carrier~scac"
+)
+
+// transportModes are the modes a carrier can declare
+var transportModes = map[string]bool{
+	"road":       true,
+	"rail":       true,
+	"sea":        true,
+	"air":        true,
+	"intermodal": true,
+}
+
+// scacPattern is the Standard Carrier Alpha Code format, two to four capital letters
+var scacPattern = regexp.MustCompile(`^[A-Z]{2,4}$`)
+
+// getCarrier loads a registered carrier
+func getCarrier(stub shim.ChaincodeStubInterface, carrierID string) (Carrier, error) {
+	var carrier Carrier
+	carrierAsBytes, err := getObjectState(stub, carrierObjectType, carrierID)
+	if err != nil {
+		return carrier, fmt.Errorf("failed to get carrier %s: %s", carrierID, err.Error())
+	} else if carrierAsBytes == nil {
+		return carrier, fmt.Errorf("carrier does not exist: %s", carrierID)
+	}
+	err = json.Unmarshal(carrierAsBytes, &carrier)
+	return carrier, err
+}
+
+// putCarrier writes a carrier record
+func putCarrier(stub shim.ChaincodeStubInterface, carrier Carrier) ([]byte, error) {
+	carrierAsBytes, err := json.Marshal(carrier)
+	if err != nil {
+		return nil, err
+	}
+	return carrierAsBytes, putObjectState(stub, carrierObjectType, carrier.CarrierID, carrierAsBytes)
+}
+
+// carrierOrganizationID is the organization operating a carrier, empty for a carrier that is not registered
+func carrierOrganizationID(stub shim.ChaincodeStubInterface, carrierID string) (string, error) {
+	carrierAsBytes, err := getObjectState(stub, carrierObjectType, carrierID)
+	if err != nil || carrierAsBytes == nil {
+		return "", err
+	}
+	var carrier Carrier
+	err = json.Unmarshal(carrierAsBytes, &carrier)
+	return carrier.OrganizationID, err
+}
+
+// validateCarrier normalizes and checks the descriptive fields of a carrier
+func validateCarrier(carrier *Carrier) error {
+	carrier.Name = strings.TrimSpace(carrier.Name)
+	carrier.SCAC = strings.ToUpper(strings.TrimSpace(carrier.SCAC))
+	v := newValidator("carrier")
+	v.required("name", carrier.Name)
+	if !scacPattern.MatchString(carrier.SCAC) {
+		v.add("scac", "must be 2 to 4 letters: %s", carrier.SCAC)
+	}
+	if len(carrier.Modes) <= 0 {
+		v.add("modes", "must list at least one of road, rail, sea, air or intermodal")
+	}
+	for i, mode := range carrier.Modes {
+		if !transportModes[mode] {
+			v.add(fmt.Sprintf("modes[%d]", i), "unknown transport mode: %s", mode)
+		}
+	}
+	return v.err()
+}
+
+// claimCarrierSCAC binds a SCAC to a carrier, failing if another carrier holds it
+func claimCarrierSCAC(stub shim.ChaincodeStubInterface, scac, carrierID string) error {
+	indexKey, err := stub.CreateCompositeKey(carrierSCACIndex, []string{scac})
+	if err != nil {
+		return err
+	}
+	holder, err := stub.GetState(indexKey)
+	if err != nil {
+		return err
+	}
+	if len(holder) > 0 && string(holder) != carrierID {
+		return fmt.Errorf("scac %s is already registered to carrier %s", scac, string(holder))
+	}
+	return stub.PutState(indexKey, []byte(carrierID))
+}
+
+// releaseCarrierSCAC removes a SCAC index entry
+func releaseCarrierSCAC(stub shim.ChaincodeStubInterface, scac string) error {
+	indexKey, err := stub.CreateCompositeKey(carrierSCACIndex, []string{scac})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+// ============================================================
+// createCarrier - register a carrier operated by the participants of an organization
+// args: carrier JSON {carrierID, organizationID, name, scac, contact, modes}
+// ============================================================
+func (t *SupplyChainChaincode) createCarrier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting carrier JSON")
+	}
+	fmt.Println("- start createCarrier")
+
+	var carrier Carrier
+	if err := decodeInput("carrier", args[0], &carrier); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(carrier.CarrierID) <= 0 {
+		return shim.Error("carrierID must be a non-empty string")
+	}
+	if err := validateCarrier(&carrier); err != nil {
+		return shim.Error(err.Error())
+	}
+	if denied, err := bindOrganization(stub, "createCarrier", carrier.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	if _, err := getCarrier(stub, carrier.CarrierID); err == nil {
+		return shim.Error("This carrierID already exists: " + carrier.CarrierID)
+	}
+	if err := claimCarrierSCAC(stub, carrier.SCAC, carrier.CarrierID); err != nil {
+		return shim.Error(err.Error())
+	}
+	carrier.Active = true
+
+	carrierAsBytes, err := putCarrier(stub, carrier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end createCarrier")
+	if err = emitEvent(stub, CarrierCreated, carrier.CarrierID, "", activeState(true)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(carrierAsBytes)
+}
+
+// ============================================================
+// readCarrier - read a carrier
+// ============================================================
+func (t *SupplyChainChaincode) readCarrier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID")
+	}
+	carrierAsBytes, err := getObjectState(stub, carrierObjectType, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if carrierAsBytes == nil {
+		return shim.Error("carrier does not exist: " + args[0])
+	}
+	return shim.Success(carrierAsBytes)
+}
+
+// ============================================================
+// updateCarrier - replace the name, SCAC, contact and modes of a carrier
+// args: carrierID, carrier JSON {name, scac, contact, modes}
+// ============================================================
+func (t *SupplyChainChaincode) updateCarrier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID and carrier JSON")
+	}
+	var update Carrier
+	if err := decodeInput("carrier", args[1], &update); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateCarrier(&update); err != nil {
+		return shim.Error(err.Error())
+	}
+	carrier, err := getCarrier(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !carrier.Active {
+		return shim.Error("carrier is deactivated: " + carrier.CarrierID)
+	}
+	if denied, err := checkOrganizationMaintainer(stub, "updateCarrier", carrier.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	if update.SCAC != carrier.SCAC {
+		if err = claimCarrierSCAC(stub, update.SCAC, carrier.CarrierID); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = releaseCarrierSCAC(stub, carrier.SCAC); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	oldSCAC := carrier.SCAC
+	carrier.Name = update.Name
+	carrier.SCAC = update.SCAC
+	carrier.Contact = update.Contact
+	carrier.Modes = update.Modes
+
+	carrierAsBytes, err := putCarrier(stub, carrier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, CarrierUpdated, carrier.CarrierID, oldSCAC, carrier.SCAC); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(carrierAsBytes)
+}
+
+// ============================================================
+// deactivateCarrier - mark a carrier inactive, new shipments can no longer reference it
+// ============================================================
+func (t *SupplyChainChaincode) deactivateCarrier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID")
+	}
+	carrier, err := getCarrier(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !carrier.Active {
+		return shim.Error("carrier is already deactivated: " + carrier.CarrierID)
+	}
+	if denied, err := checkOrganizationMaintainer(stub, "deactivateCarrier", carrier.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	carrier.Active = false
+
+	carrierAsBytes, err := putCarrier(stub, carrier)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, CarrierDeactivated, carrier.CarrierID, activeState(true), activeState(false)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(carrierAsBytes)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCarrierOrganizationBinding(t *testing.T) {
+	s := newTestStub(t, networkAdmin.MSPID, networkAdmin.EnrollmentID)
+	sellerOrg := s.mustCreateOrganization(networkAdmin, "Org1", "Org1MSP")
+	buyerOrg := s.mustCreateOrganization(networkAdmin, "Org2", "Org2MSP")
+	s.mustCreateParticipant(networkAdmin, "seller01", sellerOrg, seller, sellerUser)
+	carrier := func(carrierID, organizationID, scac string) string {
+		return fmt.Sprintf(`{"carrierID":%q,"organizationID":%q,"name":"Carrier","scac":%q,"modes":["road"]}`, carrierID, organizationID, scac)
+	}
+
+	// ==== Participants bind carriers to their own organization, the network admin to any ====
+	s.mustInvoke(sellerUser, "createCarrier", carrier("carrier01", sellerOrg, "CARA"))
+	s.mustDeny(sellerUser, "createCarrier", carrier("carrier02", buyerOrg, "CARB"))
+	s.mustFail(sellerUser, "organizationID", "createCarrier", carrier("carrier02", "", "CARB"))
+	s.mustFail(networkAdmin, "does not exist", "createCarrier", carrier("carrier02", "missing", "CARB"))
+	s.mustInvoke(networkAdmin, "createCarrier", carrier("carrier02", buyerOrg, "CARB"))
+
+	// ==== Only the carrier's organization or the network admin maintains it ====
+	s.mustInvoke(sellerUser, "updateCarrier", "carrier01", carrier("", "", "CARC"))
+	s.mustDeny(sellerUser, "updateCarrier", "carrier02", carrier("", "", "CARD"))
+	s.mustDeny(sellerUser, "deactivateCarrier", "carrier02")
+	s.mustInvoke(networkAdmin, "deactivateCarrier", "carrier02")
+}
@@ -2,15 +2,15 @@ package main
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
-	"hash/fnv"
-	"log"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -22,6 +22,8 @@ type Organization struct {
 	OrganizationID string `json:"organizationID"`
 	Tx             string `json:"tx"`
 	Name           string `json:"name"`
+	MSPID          string `json:"mspID"`
+	Active         bool   `json:"active"`
 }
 
 type ParticipantUser struct {
@@ -29,6 +31,9 @@ type ParticipantUser struct {
 	Name          string       `json:"name"`
 	Organization  Organization `json:"organization"`
 	Role          Role         `json:"role"`
+	Active        bool         `json:"active"`
+	MSPID         string       `json:"mspID"`
+	EnrollmentID  string       `json:"enrollmentID"`
 }
 
 type Role int
@@ -42,18 +47,20 @@ const (
 )
 
 type Logistics struct {
-	LogisticsID   string             `json:"logisticsID"`
-	Contains      []LogisticsUnit    `json:"contains"`
-	ContainedBY   []LogisticsUnit    `json:"containedBY"`
-	State         PurchaseOrderState `json:"state"`
-	Type          string             `json:"type"`
-	Assignee      ParticipantUser    `json:"assignee"`
-	Owner         ParticipantUser    `json:"owner"`
-	CounterSignee ParticipantUser    `json:"counterSignee"`
-	Location      Location           `json:"location"`
-	Size          float64            `json:"size"`
-	Weight        float64            `json:"weight"`
-	Price         float64            `json:"price"`
+	LogisticsID     string             `json:"logisticsID"`
+	Contains        []LogisticsUnit    `json:"contains"`
+	ContainedBY     []LogisticsUnit    `json:"containedBY"`
+	State           PurchaseOrderState `json:"state"`
+	Type            string             `json:"type"`
+	Assignee        ParticipantUser    `json:"assignee"`
+	Owner           ParticipantUser    `json:"owner"`
+	CounterSignee   ParticipantUser    `json:"counterSignee"`
+	Location        Location           `json:"location"`
+	Size            float64            `json:"size"`
+	Weight          float64            `json:"weight"`
+	Price           float64            `json:"price"`
+	PriceHash       string             `json:"priceHash,omitempty"`
+	PriceCollection string             `json:"priceCollection,omitempty"`
 }
 
 type PurchaseOrder struct {
@@ -63,8 +70,24 @@ type PurchaseOrder struct {
 	ExpectedDelDate time.Time          `json:"expectedDelDate"`
 	ShipTO          Location           `json:"shipTO"`
 	Amount          float64            `json:"amount"`
+	AmountHash      string             `json:"amountHash,omitempty"`
+	PriceCollection string             `json:"priceCollection,omitempty"`
 	Product         []LogisticsUnit    `json:"product"`
 	State           PurchaseOrderState `json:"state"`
+	History         []StateTransition  `json:"history"`
+	Archived        bool               `json:"archived,omitempty"`
+	ArchivedAt      *time.Time         `json:"archivedAt,omitempty"`
+}
+
+// StateTransition records who moved an object from one state to another and when
+type StateTransition struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ActorMSP  string    `json:"actorMSP"`
+	ActorID   string    `json:"actorID"`
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	Comment   string    `json:"comment,omitempty"`
 }
 
 type LogisticsUnit struct {
@@ -81,17 +104,23 @@ type LogisticsUnit struct {
 	PurchaseOrderID string             `json:"purchaseOrderID"`
 	Quantity        int                `json:"quantity"`
 	Price           float64            `json:"price"`
+	PriceHash       string             `json:"priceHash,omitempty"`
+	PriceCollection string             `json:"priceCollection,omitempty"`
 	DisputeReason   string             `json:"disputeReason"`
 	DisputeComment  string             `json:"disputeComment"`
 }
 
 type Location struct {
-	LocationID     string `json:"locationID"`
-	Street         string `json:"street"`
-	DockLineNumber string `json:"dockLineNumber"`
-	PostalCode     string `json:"postalCode"`
-	City           string `json:"city"`
-	Country        string `json:"country"`
+	LocationID     string      `json:"locationID"`
+	Street         string      `json:"street"`
+	DockLineNumber string      `json:"dockLineNumber"`
+	PostalCode     string      `json:"postalCode"`
+	City           string      `json:"city"`
+	Country        string      `json:"country"`
+	Address        string      `json:"address,omitempty"`
+	Dock           string      `json:"dock,omitempty"`
+	Latitude       *Coordinate `json:"latitude,omitempty"`
+	Longitude      *Coordinate `json:"longitude,omitempty"`
 }
 
 type PurchaseOrderState int
@@ -109,6 +138,7 @@ const (
 )
 
 type Shipment struct {
+	ObjectType            string             `json:"docType"` //docType is used to distinguish the various types of objects in state database
 	ShipmentID            string             `json:"shipmentID"`
 	PurchaseOrder         PurchaseOrder      `json:"purchaseOrder"`
 	Customer              Customer           `json:"customerID"`
@@ -121,6 +151,12 @@ type Shipment struct {
 	ShipmentOrderState    ShipmentOrderState `json:"shipmentOrderState"`
 	Dispute               bool               `json:"dispute"`
 	ReasonDispute         string             `json:"reasonDispute"`
+	DisputeID             string             `json:"disputeID,omitempty"`
+	NonCompliant          bool               `json:"nonCompliant"`
+	History               []StateTransition  `json:"history"`
+	Owners                []Ownership        `json:"owners,omitempty"`
+	Archived              bool               `json:"archived,omitempty"`
+	ArchivedAt            *time.Time         `json:"archivedAt,omitempty"`
 }
 
 type ShipmentOrderState int
@@ -135,17 +171,64 @@ const (
 )
 
 type Customer struct {
-	CustomerID string `json:"customerID"`
+	CustomerID        string     `json:"customerID"`
+	OrganizationID    string     `json:"organizationID,omitempty"`
+	Name              string     `json:"name,omitempty"`
+	BillingAddress    *Location  `json:"billingAddress,omitempty"`
+	ShippingAddresses []Location `json:"shippingAddresses,omitempty"`
+	Active            bool       `json:"active,omitempty"`
 }
 
 type Carrier struct {
-	CarrierID string `json:"carrierID"`
+	CarrierID      string          `json:"carrierID"`
+	OrganizationID string          `json:"organizationID,omitempty"`
+	Name           string          `json:"name,omitempty"`
+	SCAC           string          `json:"scac,omitempty"`
+	Contact        *CarrierContact `json:"contact,omitempty"`
+	Modes          []string        `json:"modes,omitempty"`
+	Active         bool            `json:"active,omitempty"`
+}
+
+type CarrierContact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
 }
 
-func hash(s string) uint32 {
-	h := fnv.New32a()
-	h.Write([]byte(s))
-	return h.Sum32()
+// getTxTime returns the transaction timestamp so every endorser stamps the same time
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// newStateTransition builds a StateTransition for the submitter of the current transaction
+func newStateTransition(stub shim.ChaincodeStubInterface, from, to fmt.Stringer, comment string) (StateTransition, error) {
+	var transition StateTransition
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return transition, err
+	}
+	actorID, err := cid.GetID(stub)
+	if err != nil {
+		return transition, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return transition, err
+	}
+	transition = StateTransition{
+		From:      from.String(),
+		To:        to.String(),
+		ActorMSP:  mspID,
+		ActorID:   actorID,
+		TxID:      stub.GetTxID(),
+		Timestamp: txTime,
+		Comment:   comment,
+	}
+	return transition, nil
 }
 
 // String returns the name of the state
@@ -160,7 +243,7 @@ func (n PurchaseOrderState) String() string {
 }
 
 func (n ShipmentOrderState) String() string {
-	names := [...]string{"waiting", "loading", "loaded", "inTransit,", "deliveredComplete", "deliveredIncomplete"}
+	names := [...]string{"waiting", "loading", "loaded", "inTransit", "deliveredComplete", "deliveredIncomplete"}
 
 	// prevent panicking in case of Weekday is out-of-range
 	if n < waiting || n > deliveredIncomplete {
@@ -182,7 +265,33 @@ func main() {
 
 // Init initializes chaincode
 // ===========================
+// Init - stores the MSP ID of the chaincode administrators and the clearing admin,
+// and indexes the shipments of every purchase order
+// args: adminMSPID, clearingAdminID (optional). A blank argument on upgrade keeps the current value.
 func (t *SupplyChainChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	for i, key := range []string{adminMSPKey, clearingAdminKey} {
+		value := ""
+		if len(args) > i {
+			value = strings.TrimSpace(args[i])
+		}
+		if len(value) <= 0 {
+			current, err := getConfig(stub, key)
+			if err != nil {
+				return shim.Error(err.Error())
+			} else if len(current) <= 0 && key == adminMSPKey {
+				return shim.Error("Incorrect number of arguments. Expecting the MSP ID of the chaincode administrators")
+			}
+			continue
+		}
+		if err := putObjectState(stub, configObjectType, key, []byte(value)); err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println("- config " + key + ": " + value)
+	}
+	if err := indexPurchaseOrderShipments(stub); err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -192,6 +301,15 @@ func (t *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Respo
 	function, args := stub.GetFunctionAndParameters()
 	fmt.Println("invoke is running " + function)
 
+	// ==== Resolve the submitter and check it against the permission matrix ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if denied := checkAccess(c, function); denied != nil {
+		return denyAccess(stub, denied)
+	}
+
 	if function == "createShipment" { //create a new shipment
 		return t.createShipment(stub, args)
 	} else if function == "readShipmentData" { //read a shipment
@@ -200,22 +318,181 @@ func (t *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Respo
 		return t.getHistoryForShipment(stub, args)
 	} else if function == "getShipmentByRange" { //get containers based on range query
 		return t.getShipmentByRange(stub, args)
+	} else if function == "getShipmentByRangeWithPagination" { //get shipments page by page
+		return t.getShipmentByRangeWithPagination(stub, args)
+	} else if function == "getHistoryForShipmentWithPagination" { //get history of a shipment page by page
+		return t.getHistoryForShipmentWithPagination(stub, args)
+	} else if function == "queryShipmentsByCarrier" { //rich query on carrier
+		return t.queryShipmentsByCarrier(stub, args)
+	} else if function == "queryShipmentsByCustomer" { //rich query on customer
+		return t.queryShipmentsByCustomer(stub, args)
+	} else if function == "queryShipmentsByPurchaseOrder" { //rich query on purchase order
+		return t.queryShipmentsByPurchaseOrder(stub, args)
+	} else if function == "queryShipmentsByState" { //rich query on ShipmentOrderState
+		return t.queryShipmentsByState(stub, args)
+	} else if function == "queryShipmentsByDispute" { //rich query on dispute flag
+		return t.queryShipmentsByDispute(stub, args)
+	} else if function == "queryShipmentsByExpectedArrival" { //rich query on expected arrival window
+		return t.queryShipmentsByExpectedArrival(stub, args)
+	} else if function == "listShipments" { //get all shipments
+		return listObjectsResponse(stub, shipmentObjectType)
+	} else if function == "getPurchaseOrderByRange" { //get purchase orders based on range query
+		return getObjectsByRangeResponse(stub, purchaseOrderObjectType, args)
+	} else if function == "listPurchaseOrders" { //get all purchase orders
+		return listObjectsResponse(stub, purchaseOrderObjectType)
+	} else if function == "getOrganizationByRange" { //get organizations based on range query
+		return getObjectsByRangeResponse(stub, organizationObjectType, args)
+	} else if function == "listOrganizations" { //get all organizations
+		return listObjectsResponse(stub, organizationObjectType)
+	} else if function == "getParticipantByRange" { //get participants based on range query
+		return getObjectsByRangeResponse(stub, participantObjectType, args)
+	} else if function == "listParticipants" { //get all participants
+		return listObjectsResponse(stub, participantObjectType)
+	} else if function == "getLogisticUnitByRange" { //get logistic units based on range query
+		return getObjectsByRangeResponse(stub, logisticsUnitObjectType, args)
+	} else if function == "listLogisticUnits" { //get all logistic units
+		return listObjectsResponse(stub, logisticsUnitObjectType)
 	} else if function == "transferShipment" { //change owner of a specific shipment
 		return t.transferShipment(stub, args)
 	} else if function == "createOrganization" { //create new organization
 		return t.createOrganization(stub, args)
 	} else if function == "getOrganizationbyID" { //create new organization
 		return t.getOrganizationbyID(stub, args)
+	} else if function == "getOrganizationbyName" { //look up an organization by its unique name
+		return t.getOrganizationbyName(stub, args)
+	} else if function == "updateOrganization" { //rename an organization
+		return t.updateOrganization(stub, args)
+	} else if function == "deactivateOrganization" { //deactivate an organization
+		return t.deactivateOrganization(stub, args)
+	} else if function == "updateShipmentState" { //move a shipment through its lifecycle
+		return t.updateShipmentState(stub, args)
+	} else if function == "readPurchaseOrder" { //read a purchase order
+		return t.readPurchaseOrder(stub, args)
+	} else if function == "validatePurchaseOrder" { //AwaitingValidation -> Validated
+		return t.movePurchaseOrder(stub, args, Validated)
+	} else if function == "preparePurchaseOrder" { //Validated -> Prepared
+		return t.movePurchaseOrder(stub, args, Prepared)
+	} else if function == "shipPurchaseOrder" { //Prepared or Pending -> Shipped
+		return t.movePurchaseOrder(stub, args, Shipped)
+	} else if function == "deliverPurchaseOrder" { //Shipped -> Delivered
+		return t.movePurchaseOrder(stub, args, Delivered)
+	} else if function == "rejectPurchaseOrder" { //reject an order that has not shipped yet
+		return t.movePurchaseOrder(stub, args, Rejected)
+	} else if function == "requestPayment" { //Delivered -> AwaitingPayment
+		return t.movePurchaseOrder(stub, args, AwaitingPayment)
+	} else if function == "markPaid" { //AwaitingPayment -> Paid
+		return t.movePurchaseOrder(stub, args, Paid)
+	} else if function == "createParticipantUser" { // create a participant within the organization
+		return t.createParticipantUser(stub, args)
+	} else if function == "getParticipantbyID" { // read a participant
+		return t.getParticipantbyID(stub, args)
+	} else if function == "listParticipantsByOrganization" { // list the participants of an organization
+		return t.listParticipantsByOrganization(stub, args)
+	} else if function == "assignSecurityRole" { // assign or update the rol of participant
+		return t.assignSecurityRole(stub, args)
+	} else if function == "deactivateParticipant" { // deactivate a participant
+		return t.deactivateParticipant(stub, args)
+	} else if function == "createLogisticUnit" { // create logisticunit
+		return t.createLogisticUnit(stub, args)
+	} else if function == "packageLogistic" { // packaging the logistic unit
+		return t.packageLogistic(stub, args)
+	} else if function == "moveLogisticUnit" { // move a logistic unit and its contents
+		return t.moveLogisticUnit(stub, args)
+	} else if function == "updateLogisticUnitState" { // change the state of a logistic unit and its contents
+		return t.updateLogisticUnitState(stub, args)
+	} else if function == "getLogisticUnitTree" { // packaging tree with rolled-up totals
+		return t.getLogisticUnitTree(stub, args)
+	} else if function == "raiseDispute" { // open a dispute on a shipment
+		return t.raiseDispute(stub, args)
+	} else if function == "commentOnDispute" { // add to the dispute thread
+		return t.commentOnDispute(stub, args)
+	} else if function == "resolveDispute" { // buyer and seller agree on a resolution
+		return t.resolveDispute(stub, args)
+	} else if function == "getDisputesByShipment" { // dispute threads of a shipment
+		return t.getDisputesByShipment(stub, args)
+	} else if function == "getDisputesByPurchaseOrder" { // dispute threads of a purchase order
+		return t.getDisputesByPurchaseOrder(stub, args)
+	} else if function == "proposeHandover" { // assignee proposes a custody transfer
+		return t.proposeHandover(stub, args)
+	} else if function == "acceptHandover" { // counter-signee accepts the custody transfer
+		return t.acceptHandover(stub, args)
+	} else if function == "listPendingHandovers" { // custody transfers awaiting acceptance
+		return t.listPendingHandovers(stub, args)
+	} else if function == "getCustodyLog" { // completed custody transfers of a unit
+		return t.getCustodyLog(stub, args)
+	} else if function == "depositFunds" { // credit the balance account of an organization
+		return t.depositFunds(stub, args)
+	} else if function == "getAccountBalance" { // balance and escrowed total of an organization
+		return t.getAccountBalance(stub, args)
+	} else if function == "readEscrow" { // escrow of a purchase order
+		return t.readEscrow(stub, args)
+	} else if function == "getEscrowsByOrganization" { // escrows of an organization as buyer or seller
+		return t.getEscrowsByOrganization(stub, args)
+	} else if function == "recordReceipt" { // consignee records the received quantities of a shipment
+		return t.recordReceipt(stub, args)
+	} else if function == "getReconciliationReport" { // shortage/overage report of a purchase order
+		return t.getReconciliationReport(stub, args)
+	} else if function == "getReceiptsByPurchaseOrder" { // receipts recorded for a purchase order
+		return t.getReceiptsByPurchaseOrder(stub, args)
+	} else if function == "setComplianceThresholds" { // configure the compliance limits of a shipment
+		return t.setComplianceThresholds(stub, args)
+	} else if function == "readComplianceThresholds" { // compliance limits of a shipment
+		return t.readComplianceThresholds(stub, args)
+	} else if function == "recordTelemetry" { // store a sensor reading and check it against the limits
+		return t.recordTelemetry(stub, args)
+	} else if function == "getTelemetry" { // sensor readings of a shipment
+		return t.getTelemetry(stub, args)
+	} else if function == "updateShipmentPosition" { // append a GPS fix to the route of a shipment
+		return t.updateShipmentPosition(stub, args)
+	} else if function == "getShipmentRoute" { // GPS track and distance travelled of a shipment
+		return t.getShipmentRoute(stub, args)
+	} else if function == "readPrivatePrice" { // private price of a purchase order or logistics unit
+		return t.readPrivatePrice(stub, args)
+	} else if function == "verifyPrivatePrice" { // check a disclosed price against its public hash
+		return t.verifyPrivatePrice(stub, args)
+	} else if function == "setSLAContract" { // create or replace the SLA contract of a carrier
+		return t.setSLAContract(stub, args)
+	} else if function == "readSLAContract" { // SLA contract of a carrier
+		return t.readSLAContract(stub, args)
+	} else if function == "querySLAViolations" { // late deliveries of a carrier in a date range
+		return t.querySLAViolations(stub, args)
+	} else if function == "createCarrier" { //register a carrier
+		return t.createCarrier(stub, args)
+	} else if function == "readCarrier" { //read a carrier
+		return t.readCarrier(stub, args)
+	} else if function == "updateCarrier" { //update name, SCAC, contact and modes of a carrier
+		return t.updateCarrier(stub, args)
+	} else if function == "deactivateCarrier" { //deactivate a carrier
+		return t.deactivateCarrier(stub, args)
+	} else if function == "listCarriers" { //get all carriers
+		return listObjectsResponse(stub, carrierObjectType)
+	} else if function == "createCustomer" { //register a customer
+		return t.createCustomer(stub, args)
+	} else if function == "readCustomer" { //read a customer
+		return t.readCustomer(stub, args)
+	} else if function == "updateCustomer" { //update name and addresses of a customer
+		return t.updateCustomer(stub, args)
+	} else if function == "deactivateCustomer" { //deactivate a customer
+		return t.deactivateCustomer(stub, args)
+	} else if function == "listCustomers" { //get all customers
+		return listObjectsResponse(stub, customerObjectType)
+	} else if function == "createShipmentsBatch" { //create many shipments in one transaction
+		return t.createShipmentsBatch(stub, args)
+	} else if function == "getShipmentTraceability" { //ledger history of a shipment and its units for the EPCIS export
+		return t.getShipmentTraceability(stub, args)
+	} else if function == "archiveShipment" { //make a shipment read-only and hide it from list queries
+		return t.archiveShipment(stub, args)
+	} else if function == "archivePurchaseOrder" { //make a purchase order read-only and hide it from list queries
+		return t.archivePurchaseOrder(stub, args)
+	} else if function == "deleteShipment" { //remove a delivered shipment from state
+		return t.deleteShipment(stub, args)
+	} else if function == "deletePurchaseOrder" { //remove a rejected or paid purchase order from state
+		return t.deletePurchaseOrder(stub, args)
+	} else if function == "getPurgeCandidates" { //records past the retention period that may be deleted
+		return t.getPurgeCandidates(stub, args)
+	} else if function == "getShipmentOwners" { //ordered ownership list of a shipment
+		return t.getShipmentOwners(stub, args)
 	}
-	// else if function == "createParticipantUser" { // create a participant within the organization
-	// 	return t.createUser(stub, args)
-	// } else if function == "assignSecurityRole" { // assign or update the rol of participant
-	// 	return t.assignSecurityRole(stub, args)
-	// } else if function == "createLogisticUnit" { // create logisticunit
-	// 	return t.createLogisticUnit(stub, args)
-	// } else if function == "packageLogistic" { // packaging the logistic unit
-	// 	return t.packageLogistic(stub, args)
-	// }
 
 	fmt.Println("invoke did not find func: " + function) //error
 	return shim.Error("Received unknown function invocation")
@@ -239,74 +516,85 @@ func (t *SupplyChainChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Respo
 
 func (t *SupplyChainChaincode) getOrganizationbyID(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var jsonResp, errResp string
-	fmt.Println("start getOrganizationbyID", args[0])
 	var err error
 	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\" \" as an argument\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return shim.Success(nil)
+		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
+	fmt.Println("start getOrganizationbyID", args[0])
 	_organizationID := args[0]
 
 	_tempJSON := Organization{}
 
 	jsonResp = ""
-	valueAsBytes, err := stub.GetState(_organizationID)
+	valueAsBytes, err := getObjectState(stub, organizationObjectType, _organizationID)
 	if err != nil {
 		errResp = "{\"Error\":\"Failed to get state for " + _organizationID + "\"}"
 		return shim.Error(errResp)
 	}
 	json.Unmarshal(valueAsBytes, &_tempJSON)
 
-	if _tempJSON.OrganizationID == _organizationID {
-		jsonResp = string(valueAsBytes[:])
-	} else {
+	if _tempJSON.OrganizationID != _organizationID {
 		fmt.Println(_organizationID + " not found")
-		errMsg := "{ \"Organization\" : \"" + _organizationID + "\",\"message\" : \"" + "Organization Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+		return shim.Error("organization does not exist: " + _organizationID)
 	}
+	jsonResp = string(valueAsBytes[:])
 	fmt.Println("jsonResp : " + jsonResp)
 	fmt.Println("end getOrganizationbyID")
 	return shim.Success([]byte(jsonResp))
 	//send it onward
 }
 
+// ============================================================
+// createOrganization - register an organization bound to a Fabric MSP, by the network admin
+// args: organization JSON {name, mspID}
+// ============================================================
 func (t *SupplyChainChaincode) createOrganization(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
-	var tosend, organizationID string
-	//var uuid [16]byte
+	var organizationID string
+	fmt.Println("- start creating organization")
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organization JSON")
+	}
 	var org Organization
-	if err := json.Unmarshal([]byte(args[0])), &org); err != nil {
-		log.Fatal(err)
+	if err := decodeInput("organization", args[0], &org); err != nil {
+		return shim.Error(err.Error())
 	}
-	org.OrganizationID=hash(org.Name)
-	organizationID=fmt.Sprint(org.OrganizationID)
-	err = stub.PutState(organizationID, []byte(args[0]))
-	if err != nil {
+	org.Name = strings.TrimSpace(org.Name)
+	if err := validateOrganization(org); err != nil {
 		return shim.Error(err.Error())
 	}
-	fmt.Println("- transaction created")
+	// ==== The network admin registers the organization of any MSP, the admins of that MSP maintain it from then on ====
 
-	tosend = "{  \"message\" : \"Organization created successfully on legder with organizationID \" : \"" + organizationID + "\", \"code\" : \"200\"}"
-	//}else if count == len(existPolicyArray){
-	//tosend = "{ \"message\" : \"All of these Polices already exists in legder.\", \"Policies failed to stored on ledger with policyIds \" : \"" + strings.Join(existPolicyArray, ",") + "\", \"code\" : \"503\"}"
-	//}else{
-	//tosend = "{ \"message\" : \"Polices stored successfully on legder except few policies which already exists in ledger. Please find below details for more information.\", \"Policies successfully stored on ledger with policyIds \" : \"" + strings.Join(policyIdArray, ",") + "\", \"Policies failed to stored on ledger with policyIds \" : \"" + strings.Join(existPolicyArray, ",") + "\", \"Properties successfully created/updated with propertyIds\" : \"" + strings.Join(propertyIdArray, ",") + "\", \"code\" : \"503\"}"
-	//}
+	// ==== The tx ID is unique on the channel, so it makes a collision-free organization ID ====
+	organizationID = stub.GetTxID()
+	org.OrganizationID = organizationID
+	org.Tx = organizationID
+	org.Active = true
 
-	fmt.Println("event message: " + tosend)
-	err = stub.SetEvent("evtsender", []byte(tosend))
+	existing, err := getObjectState(stub, organizationObjectType, organizationID)
 	if err != nil {
 		return shim.Error(err.Error())
+	} else if existing != nil {
+		return shim.Error("This organizationID already exists: " + organizationID)
+	}
+	if err = claimOrganizationIndex(stub, organizationNameIndex, normalizeOrganizationName(org.Name), organizationID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = claimOrganizationIndex(stub, organizationMSPIndex, org.MSPID, organizationID); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	return shim.Success(nil)
+	orgAsBytes, err := putOrganization(stub, org)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- transaction created")
+
+	if err = emitEvent(stub, OrganizationCreated, organizationID, "", activeState(org.Active)); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(orgAsBytes)
 }
 
 func (t *SupplyChainChaincode) createShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -315,6 +603,9 @@ func (t *SupplyChainChaincode) createShipment(stub shim.ChaincodeStubInterface,
 	fmt.Println(len(args))
 	// ==== Input sanitation ====
 	fmt.Println("- start init shipment")
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and shipment JSON")
+	}
 	if len(args[0]) <= 0 {
 		return shim.Error("1st argument must be a non-empty string")
 	}
@@ -328,39 +619,175 @@ func (t *SupplyChainChaincode) createShipment(stub shim.ChaincodeStubInterface,
 	fmt.Println("shipmentID--" + shipmentID)
 	fmt.Println("Payload--" + payload)
 
+	// ==== Create shipment object and shipment to JSON ====
+	var shipmentVariable Shipment
+	if err := decodeInput("shipment", payload, &shipmentVariable); err != nil {
+		return shim.Error(err.Error())
+	}
+	shipmentVariable, err = importShipment(stub, shipmentID, shipmentVariable, pricingTransientKey, map[string]PurchaseOrder{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println(" Succussfully created shipment details")
+	if err = emitEvent(stub, ShipmentCreated, shipmentID, "", shipmentVariable.ShipmentOrderState.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// importShipment validates a decoded shipment and writes it together with its purchase order
+// when the order is new. The transient map entry priceKey holds the private pricing of a new order.
+// purchaseOrders are the orders written earlier in the same transaction, which the ledger does not
+// return until commit; new orders are added to it. A *shipmentImportError means nothing was written.
+func importShipment(stub shim.ChaincodeStubInterface, shipmentID string, shipmentVariable Shipment, priceKey string, purchaseOrders map[string]PurchaseOrder) (Shipment, error) {
 	// ==== Check if shipmentID already exists ====
-	shipmentAsBytes, err := stub.GetState(shipmentID)
+	shipmentAsBytes, err := getObjectState(stub, shipmentObjectType, shipmentID)
 	if err != nil {
-		return shim.Error("Failed to get shipmentID: " + err.Error())
+		return shipmentVariable, fmt.Errorf("Failed to get shipmentID: %s", err.Error())
 	} else if shipmentAsBytes != nil {
 		fmt.Println("This shipmentID already exists: " + shipmentID)
-		return shim.Error("This shipmentID already exists: " + shipmentID)
+		return shipmentVariable, &shipmentImportError{Status: shipmentDuplicate, Err: fmt.Errorf("This shipmentID already exists: %s", shipmentID)}
 	}
-	// ==== Create shipment object and shipment to JSON ====
-	var shipmentVariable Shipment
-	if err := json.Unmarshal([]byte(payload), &shipmentVariable); err != nil {
-		log.Fatal(err)
+	// ==== Real dates are stamped by updateShipmentState from the tx timestamp, validation rejects them ====
+	if err := validateShipment(shipmentVariable); err != nil {
+		return shipmentVariable, rejectShipment(err)
 	}
+	shipmentVariable.ObjectType = shipmentObjectType
+	shipmentVariable.ShipmentID = shipmentID
+	// ==== Dates are kept in UTC at second precision so CouchDB range selectors compare them correctly ====
+	shipmentVariable.ExpectedDepartureDate = shipmentVariable.ExpectedDepartureDate.UTC().Truncate(time.Second)
+	shipmentVariable.ExpectedArrivedDate = shipmentVariable.ExpectedArrivedDate.UTC().Truncate(time.Second)
+	shipmentVariable.ShipmentOrderState = waiting
+	shipmentVariable.History = nil
 	purchaseOrderID := shipmentVariable.PurchaseOrder.PurchaseOrderID
-	_tempPurchase := &PurchaseOrder{PurchaseOrderID: shipmentVariable.PurchaseOrder.PurchaseOrderID, State: shipmentVariable.PurchaseOrder.State}
-
-	_tempPurchaseJsonAsBytes, err := json.Marshal(_tempPurchase)
+	// ==== Prices travel in the transient map, the public records only keep their hash ====
+	if shipmentVariable.PurchaseOrder.Amount != 0 {
+		return shipmentVariable, rejectShipment(fmt.Errorf("amount must be passed in the transient map under %s, not in the shipment payload", priceKey))
+	}
+	for _, line := range shipmentVariable.PurchaseOrder.Product {
+		if line.Price != 0 {
+			return shipmentVariable, rejectShipment(fmt.Errorf("line prices must be passed in the transient map under %s, not in the shipment payload", priceKey))
+		}
+	}
+	// ==== Carrier and customer must be registered and active, the shipment only keeps their IDs ====
+	carrier, err := getCarrier(stub, shipmentVariable.Carrier.CarrierID)
 	if err != nil {
-		return shim.Error(err.Error())
+		return shipmentVariable, rejectShipment(err)
+	} else if !carrier.Active {
+		return shipmentVariable, rejectShipment(fmt.Errorf("carrier is deactivated: %s", carrier.CarrierID))
 	}
-	fmt.Println(string(_tempPurchaseJsonAsBytes))
-	_tempShipmentJsonAsBytes, err1 := json.Marshal(payload)
-	// === Save shipment to state ===
-	err = stub.PutState(purchaseOrderID, []byte(_tempPurchaseJsonAsBytes))
+	customer, err := getCustomer(stub, shipmentVariable.Customer.CustomerID)
 	if err != nil {
-		return shim.Error(err.Error())
+		return shipmentVariable, rejectShipment(err)
+	} else if !customer.Active {
+		return shipmentVariable, rejectShipment(fmt.Errorf("customer is deactivated: %s", customer.CustomerID))
+	}
+	shipmentVariable.Carrier = Carrier{CarrierID: carrier.CarrierID}
+	shipmentVariable.Customer = Customer{CustomerID: customer.CustomerID}
+	// ==== A new purchase order always starts in AwaitingValidation, an existing one keeps its state ====
+	existing, found := purchaseOrders[purchaseOrderID]
+	if !found {
+		purchaseOrderAsBytes, err := getObjectState(stub, purchaseOrderObjectType, purchaseOrderID)
+		if err != nil {
+			return shipmentVariable, fmt.Errorf("Failed to get purchaseOrderID: %s", err.Error())
+		} else if purchaseOrderAsBytes != nil {
+			if err = json.Unmarshal(purchaseOrderAsBytes, &existing); err != nil {
+				return shipmentVariable, err
+			}
+			found = true
+		}
+	}
+	if found && existing.Archived {
+		return shipmentVariable, rejectShipment(fmt.Errorf("purchase order %s is archived and read-only", purchaseOrderID))
+	}
+	// ==== Buyer and seller of the purchase order must be active participants of active organizations ====
+	parties := shipmentVariable.PurchaseOrder
+	if found {
+		parties = existing
+	}
+	if err = checkActiveParticipant(stub, parties.Buyer.ParticipantID, "buyer"); err != nil {
+		return shipmentVariable, rejectShipment(err)
+	}
+	if err = checkActiveParticipant(stub, parties.Seller.ParticipantID, "seller"); err != nil {
+		return shipmentVariable, rejectShipment(err)
 	}
-	err1 = stub.PutState(shipmentID, []byte(_tempShipmentJsonAsBytes))
+	// ==== Only the seller of the purchase order ships it and becomes the first owner ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shipmentVariable, err
+	}
+	if c.Participant == nil || c.Participant.ParticipantID != parties.Seller.ParticipantID {
+		return shipmentVariable, rejectShipment(fmt.Errorf("only the seller %s of purchase order %s can create its shipments", parties.Seller.ParticipantID, purchaseOrderID))
+	}
+	// ==== The seller owns a new shipment until transferShipment hands it over ====
+	owner, err := newOwnership(stub, parties.Seller.ParticipantID, shipmentVariable.Carrier.CarrierID, "")
+	if err != nil {
+		return shipmentVariable, err
+	}
+	shipmentVariable.Owners = []Ownership{owner}
+	// ==== The shipment embeds the stored purchase order, never the state, history or parties sent by the client ====
+	if found {
+		shipmentVariable.PurchaseOrder = existing
+	} else {
+		_tempPurchase := shipmentVariable.PurchaseOrder
+		_tempPurchase.State = AwaitingValidation
+		_tempPurchase.History = nil
+		_tempPurchase.AmountHash = ""
+		_tempPurchase.PriceCollection = ""
+
+		price, err := getTransientPrice(stub, priceKey)
+		if err != nil {
+			return shipmentVariable, rejectShipment(err)
+		}
+		if price != nil {
+			lines := map[string]bool{}
+			for _, line := range _tempPurchase.Product {
+				lines[line.LogisticsUnitID] = true
+			}
+			for lineID := range price.LinePrices {
+				if !lines[lineID] {
+					return shipmentVariable, rejectShipment(fmt.Errorf("transient pricing has a price for unknown line %s", lineID))
+				}
+			}
+			collection, err := purchaseOrderCollection(stub, _tempPurchase)
+			if err != nil {
+				return shipmentVariable, rejectShipment(err)
+			}
+			hash, err := putPrivatePrice(stub, collection, purchaseOrderObjectType, purchaseOrderID, *price)
+			if err != nil {
+				return shipmentVariable, err
+			}
+			_tempPurchase.AmountHash = hash
+			_tempPurchase.PriceCollection = collection
+		}
+		shipmentVariable.PurchaseOrder = _tempPurchase
+
+		_tempPurchaseJsonAsBytes, err := json.Marshal(_tempPurchase)
+		if err != nil {
+			return shipmentVariable, err
+		}
+		err = putObjectState(stub, purchaseOrderObjectType, purchaseOrderID, _tempPurchaseJsonAsBytes)
+		if err != nil {
+			return shipmentVariable, err
+		}
+		purchaseOrders[purchaseOrderID] = _tempPurchase
+	}
+	_tempShipmentJsonAsBytes, err1 := json.Marshal(shipmentVariable)
 	if err1 != nil {
-		return shim.Error(err1.Error())
+		return shipmentVariable, err1
 	}
-	fmt.Println(" Succussfully created shipment details")
-	return shim.Success(nil)
+	// === Save shipment to state ===
+	err1 = putObjectState(stub, shipmentObjectType, shipmentID, _tempShipmentJsonAsBytes)
+	if err1 != nil {
+		return shipmentVariable, err1
+	}
+	if err = putShipmentStatus(stub, shipmentVariable); err != nil {
+		return shipmentVariable, err
+	}
+	if err = putPurchaseOrderShipment(stub, purchaseOrderID, shipmentID); err != nil {
+		return shipmentVariable, err
+	}
+	return shipmentVariable, nil
 }
 
 // ===============================================
@@ -375,7 +802,7 @@ func (t *SupplyChainChaincode) readShipmentData(stub shim.ChaincodeStubInterface
 	}
 
 	shipmentID = args[0]
-	shipmentDataAsbytes, err := stub.GetState(shipmentID) //get the shipment from chaincode state
+	shipmentDataAsbytes, err := getObjectState(stub, shipmentObjectType, shipmentID) //get the shipment from chaincode state
 	if err != nil {
 		shipmentDataJsonResp = "{\"Error\":\"Failed to get state for " + shipmentID + "\"}"
 		return shim.Error(shipmentDataJsonResp)
@@ -387,126 +814,157 @@ func (t *SupplyChainChaincode) readShipmentData(stub shim.ChaincodeStubInterface
 }
 
 // ==================================================
-// deleteShipment - remove a shipment key/value pair from state
+// deleteShipment - remove a shipment key/value pair from state. Only delivered shipments
+// without an open dispute can be deleted, the ledger history of the key is kept.
+// args: shipmentID
 // ==================================================
-
-// // ===========================================================
-// // transfer a shipment by setting a new owner name on the shipment
-// // ===========================================================
-func (t *SupplyChainChaincode) transferShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+func (t *SupplyChainChaincode) deleteShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
 	}
-	//var shipmentStatus string
 	shipmentID := args[0]
-	payload := args[1]
-	fmt.Println("- start updation ", shipmentID, payload)
+	fmt.Println("- start deleteShipment ", shipmentID)
 
-	shipmentAsBytes, err := stub.GetState(shipmentID)
+	shipment, err := getShipment(stub, shipmentID)
 	if err != nil {
-		return shim.Error("Failed to get shipmentID:" + err.Error())
-	} else if shipmentAsBytes == nil {
-		return shim.Error("shipmentID does not exist")
+		return shim.Error(err.Error())
 	}
-
-	var _tempShipment Shipment
-	//surgicalkitToTransfer := surgicalkit{}
-	err1 := json.Unmarshal(shipmentAsBytes, &_tempShipment) //unmarshal it aka JSON.parse()
-	if err1 != nil {
-		return shim.Error(err1.Error())
-	}
-	//_tempShipment.shipmentID = shipmentID //change the owner
-	//_tempShipment.Payload 	 = Payload
-	//var j = []byte(_tempShipment)
-	// a map shipment to decode the JSON structure into
-	//c := make(map[string]interface{})
-
-	// unmarschal JSON
-	//  json.Unmarshal(j, &c)
-	// for s, v := range c {
-	// 	switch vv :=v.(type) {
-	// 		case string :
-	// 					if(s=="st"){
-	// 						fmt.Println("status field found in payload--"+vv)
-	// 						shipmentStatus = vv
-	// 					}
-	// 	}
-	// }
-	//fmt.Println("shipmentStatus------"+shipmentStatus)
-
-	// if shipmentStatus == "tampered" {
-	// 	surgicalkitToTransfer.Compliant = false
-	// }else{
-	// 	surgicalkitToTransfer.Compliant = true
-	// }
-	purchaseOrderID := _tempShipment.PurchaseOrder.PurchaseOrderID
-	_tempPurchase := &PurchaseOrder{PurchaseOrderID: _tempShipment.PurchaseOrder.PurchaseOrderID, State: _tempShipment.PurchaseOrder.State}
-	_tempPurchaseJsonAsBytes, err2 := json.Marshal(_tempPurchase)
-	if err2 != nil {
-		return shim.Error(err2.Error())
-	}
-	fmt.Println("transfer ower-purchaseOrder-%v+", string(_tempPurchaseJsonAsBytes))
-	// === Save shipment to state ===
-	err3 := stub.PutState(purchaseOrderID, []byte(_tempPurchaseJsonAsBytes))
-	if err3 != nil {
-		return shim.Error(err3.Error())
+	if err = checkShipmentPurgeable(shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = deleteObjectState(stub, shipmentObjectType, shipmentID); err != nil {
+		return shim.Error("Failed to delete shipment " + shipmentID + ": " + err.Error())
+	}
+	if err = deleteObjectState(stub, shipmentStatusObjectType, shipmentID); err != nil {
+		return shim.Error("Failed to delete shipment " + shipmentID + ": " + err.Error())
 	}
-	_tempShipmentJSONasBytes, _ := json.Marshal(_tempShipment)
-	err4 := stub.PutState(shipmentID, _tempShipmentJSONasBytes) //rewrite the shipment
-	if err4 != nil {
-		return shim.Error(err4.Error())
+	if err = deletePurchaseOrderShipment(stub, shipment.PurchaseOrder.PurchaseOrderID, shipmentID); err != nil {
+		return shim.Error("Failed to delete shipment " + shipmentID + ": " + err.Error())
+	}
+	fmt.Println("- end deleteShipment (success)")
+	if err = emitEvent(stub, ShipmentDeleted, shipmentID, shipment.ShipmentOrderState.String(), "deleted"); err != nil {
+		return shim.Error(err.Error())
 	}
-	fmt.Println("transfer ower-shipement-%v+", string(_tempShipmentJSONasBytes))
-	fmt.Println("- end shipement transfer(success)")
 	return shim.Success(nil)
 }
 
-func (t *SupplyChainChaincode) getShipmentByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+// ===========================================================================
+// transferShipment - hand a shipment over to a new owner and/or carrier. Only the current
+// owner may transfer, the new owner must be an active participant and the new carrier an
+// active registered carrier. The previous periods are kept in the ownership list.
+// args: shipmentID, transfer JSON {"ownerID" and/or "carrierID" [, "comment"]}
+// ===========================================================================
+func (t *SupplyChainChaincode) transferShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and transfer JSON")
 	}
+	shipmentID := args[0]
+	fmt.Println("- start transferShipment ", shipmentID)
 
-	startKey := args[0]
-	endKey := args[1]
+	var transfer ShipmentTransfer
+	if err := decodeInput("transfer", args[1], &transfer); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateTransfer(transfer); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
+	shipment, err := getWritableShipment(stub, shipmentID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer resultsIterator.Close()
+	if shipment.Dispute {
+		return shim.Error("shipment " + shipmentID + " is frozen by open dispute " + shipment.DisputeID)
+	}
+	if shipment.ShipmentOrderState.isDelivered() {
+		return shim.Error("shipment " + shipmentID + " is " + shipment.ShipmentOrderState.String() + " and can no longer be transferred")
+	}
 
-	// buffer is a JSON array containing QueryResults
-	var buffer bytes.Buffer
-	buffer.WriteString("[")
+	// ==== Only the current owner hands the shipment over ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	previous := currentOwner(shipment)
+	if c.Participant == nil || c.Participant.ParticipantID != previous.OwnerID {
+		return denyAccess(stub, newAccessDenied(c, "transferShipment", "caller is not the current owner of shipment "+shipmentID))
+	}
 
-	bArrayMemberAlreadyWritten := false
-	for resultsIterator.HasNext() {
-		queryResponse, err := resultsIterator.Next()
-		if err != nil {
+	next, err := newOwnership(stub, previous.OwnerID, previous.CarrierID, transfer.Comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(transfer.OwnerID) > 0 {
+		if err = checkActiveParticipant(stub, transfer.OwnerID, "new owner"); err != nil {
 			return shim.Error(err.Error())
 		}
-		// Add a comma before array members, suppress it for the first array member
-		if bArrayMemberAlreadyWritten == true {
-			buffer.WriteString(",")
+		next.OwnerID = transfer.OwnerID
+	}
+	if len(transfer.CarrierID) > 0 {
+		carrier, err := getCarrier(stub, transfer.CarrierID)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if !carrier.Active {
+			return shim.Error("carrier is deactivated: " + carrier.CarrierID)
 		}
-		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Record\":")
-		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResponse.Value))
-		buffer.WriteString("}")
-		bArrayMemberAlreadyWritten = true
+		next.CarrierID = transfer.CarrierID
 	}
-	buffer.WriteString("]")
+	if next.OwnerID == previous.OwnerID && next.CarrierID == previous.CarrierID {
+		return shim.Error("shipment " + shipmentID + " is already owned by " + previous.OwnerID + " and carried by " + previous.CarrierID)
+	}
+
+	shipment.Owners = append(shipmentOwners(shipment), next)
+	shipment.Carrier.CarrierID = next.CarrierID
+	shipmentAsBytes, err := putShipment(stub, shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// ==== The status key follows the carrier, telemetry checks its organization there ====
+	if err = putShipmentStatus(stub, shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end transferShipment (success) ", previous.String(), "->", next.String())
+	if err = emitEvent(stub, ShipmentTransferred, shipmentID, previous.String(), next.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(shipmentAsBytes)
+}
 
-	fmt.Printf("- getShipmentByRange queryResult:\n%s\n", buffer.String())
+// ===========================================================================
+// getShipmentByRange - shipments with startID <= shipmentID < endID
+// ===========================================================================
+func (t *SupplyChainChaincode) getShipmentByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return getObjectsByRangeResponse(stub, shipmentObjectType, args)
+}
 
-	return shim.Success(buffer.Bytes())
+// writeHistoryRecord writes one history entry as {"TxID", "Value", "Timestamp", "IsDelete"}
+func writeHistoryRecord(buffer *bytes.Buffer, response *queryresult.KeyModification) {
+	buffer.WriteString("{\"TxID\":")
+	buffer.WriteString("\"")
+	buffer.WriteString(response.TxId)
+	buffer.WriteString("\"")
+
+	buffer.WriteString(", \"Value\":")
+	// if it was a deleteShipment operation on given key, then we need to set the
+	//corresponding value null. Else, we will write the response.Value
+	//as-is (as the Value itself a JSON shipment)
+	if response.IsDelete {
+		buffer.WriteString("null")
+	} else {
+		buffer.WriteString(string(response.Value))
+	}
+
+	buffer.WriteString(", \"Timestamp\":")
+	buffer.WriteString("\"")
+	buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
+	buffer.WriteString("\"")
+
+	buffer.WriteString(", \"IsDelete\":")
+	buffer.WriteString("\"")
+	buffer.WriteString(strconv.FormatBool(response.IsDelete))
+	buffer.WriteString("\"")
+
+	buffer.WriteString("}")
 }
 
 func (t *SupplyChainChaincode) getHistoryForShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -519,7 +977,11 @@ func (t *SupplyChainChaincode) getHistoryForShipment(stub shim.ChaincodeStubInte
 
 	fmt.Printf("- start getHistoryForShipment: %s\n", shipmentID)
 
-	resultsIterator, err := stub.GetHistoryForKey(shipmentID)
+	shipmentKey, err := stub.CreateCompositeKey(shipmentObjectType, []string{shipmentID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetHistoryForKey(shipmentKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -539,32 +1001,7 @@ func (t *SupplyChainChaincode) getHistoryForShipment(stub shim.ChaincodeStubInte
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
 		}
-		buffer.WriteString("{\"TxID\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(response.TxId)
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"Value\":")
-		// if it was a deleteShipment operation on given key, then we need to set the
-		//corresponding value null. Else, we will write the response.Value
-		//as-is (as the Value itself a JSON shipment)
-		if response.IsDelete {
-			buffer.WriteString("null")
-		} else {
-			buffer.WriteString(string(response.Value))
-		}
-
-		buffer.WriteString(", \"Timestamp\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).String())
-		buffer.WriteString("\"")
-
-		buffer.WriteString(", \"IsDelete\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(strconv.FormatBool(response.IsDelete))
-		buffer.WriteString("\"")
-
-		buffer.WriteString("}")
+		writeHistoryRecord(&buffer, response)
 		bArrayMemberAlreadyWritten = true
 	}
 	buffer.WriteString("]")
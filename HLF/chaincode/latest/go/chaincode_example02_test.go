@@ -0,0 +1,381 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// attributesOID is the certificate extension the Fabric CA stores identity attributes in
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// identities of the sample network: the network admin of Org1MSP, the admin of Org2MSP,
+// a seller in Org1MSP and a buyer in Org2MSP
+var (
+	networkAdmin = identity{MSPID: "Org1MSP", EnrollmentID: "supplychain-admin", Admin: true}
+	org2Admin    = identity{MSPID: "Org2MSP", EnrollmentID: "supplychain-admin", Admin: true}
+	sellerUser   = identity{MSPID: "Org1MSP", EnrollmentID: "User1@org1.example.com"}
+	buyerUser    = identity{MSPID: "Org2MSP", EnrollmentID: "User1@org2.example.com"}
+)
+
+// participants of the other organizations: a driver of Org3MSP, the organization operating the
+// carrier, a driver of the buyer's organization and a receiver of the carrier's organization
+var (
+	driverUser          = identity{MSPID: "Org3MSP", EnrollmentID: "User1@org3.example.com"}
+	buyerDriverUser     = identity{MSPID: "Org2MSP", EnrollmentID: "User2@org2.example.com"}
+	carrierReceiverUser = identity{MSPID: "Org3MSP", EnrollmentID: "User2@org3.example.com"}
+)
+
+// sampleNetwork holds the organization IDs of the sample network
+type sampleNetwork struct {
+	sellerOrg  string
+	buyerOrg   string
+	carrierOrg string
+}
+
+// identity is a transaction submitter, an enrollment ID of an MSP optionally carrying the supplychain.admin attribute
+type identity struct {
+	MSPID        string
+	EnrollmentID string
+	Admin        bool
+}
+
+// testStub runs the chaincode on the shim MockStub with what the mock leaves out: the
+// submitter, the transient map and the commit of a proposal. Like a peer, it applies the
+// writes of a transaction and keeps its event only when the chaincode returned a success,
+// and a transaction does not read its own writes.
+type testStub struct {
+	*shim.MockStub
+	t         *testing.T
+	cc        *SupplyChainChaincode
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+	now       time.Time
+	txCount   int
+	writes    []pendingWrite
+	event     *pb.ChaincodeEvent
+	events    []pb.ChaincodeEvent
+	creators  map[identity][]byte
+}
+
+// pendingWrite is a public (empty collection) or private write held until the transaction commits
+type pendingWrite struct {
+	collection string
+	key        string
+	value      []byte
+	delete     bool
+}
+
+// newTestStub starts a chaincode instance with adminMSP and clearingAdmin as Init arguments
+func newTestStub(t *testing.T, adminMSP, clearingAdmin string) *testStub {
+	cc := new(SupplyChainChaincode)
+	s := &testStub{
+		MockStub: shim.NewMockStub("supplychain", cc),
+		t:        t,
+		cc:       cc,
+		now:      time.Date(2019, 3, 1, 8, 0, 0, 0, time.UTC),
+		creators: map[identity][]byte{},
+	}
+	s.submit(identity{MSPID: adminMSP, EnrollmentID: clearingAdmin, Admin: true}, nil, true, "init", adminMSP, clearingAdmin)
+	return s
+}
+
+// invoke submits a transaction as id and returns the chaincode response
+func (s *testStub) invoke(id identity, function string, args ...string) pb.Response {
+	return s.submit(id, nil, false, function, args...)
+}
+
+// invokeTransient submits a transaction carrying a transient map
+func (s *testStub) invokeTransient(id identity, transient map[string][]byte, function string, args ...string) pb.Response {
+	return s.submit(id, transient, false, function, args...)
+}
+
+// mustInvoke submits a transaction that has to succeed and returns its payload
+func (s *testStub) mustInvoke(id identity, function string, args ...string) []byte {
+	s.t.Helper()
+	response := s.invoke(id, function, args...)
+	if response.Status != shim.OK {
+		s.t.Fatalf("%s by %s@%s: %s", function, id.EnrollmentID, id.MSPID, response.Message)
+	}
+	return response.Payload
+}
+
+// mustInvokeTransient submits a transaction carrying a transient map that has to succeed and returns its payload
+func (s *testStub) mustInvokeTransient(id identity, transient map[string][]byte, function string, args ...string) []byte {
+	s.t.Helper()
+	response := s.invokeTransient(id, transient, function, args...)
+	if response.Status != shim.OK {
+		s.t.Fatalf("%s by %s@%s: %s", function, id.EnrollmentID, id.MSPID, response.Message)
+	}
+	return response.Payload
+}
+
+// mustDeny submits a transaction that has to be refused with an access denial
+func (s *testStub) mustDeny(id identity, function string, args ...string) {
+	s.t.Helper()
+	response := s.invoke(id, function, args...)
+	if response.Status == shim.OK {
+		s.t.Fatalf("%s by %s@%s: succeeded, want access denied", function, id.EnrollmentID, id.MSPID)
+	}
+	if !strings.Contains(response.Message, `"code":"403"`) {
+		s.t.Fatalf("%s by %s@%s: %s, want access denied", function, id.EnrollmentID, id.MSPID, response.Message)
+	}
+}
+
+// mustFail submits a transaction that has to fail with an error containing want
+func (s *testStub) mustFail(id identity, want, function string, args ...string) {
+	s.t.Helper()
+	response := s.invoke(id, function, args...)
+	if response.Status == shim.OK {
+		s.t.Fatalf("%s by %s@%s: succeeded, want an error containing %q", function, id.EnrollmentID, id.MSPID, want)
+	}
+	if !strings.Contains(response.Message, want) {
+		s.t.Fatalf("%s by %s@%s: %s, want an error containing %q", function, id.EnrollmentID, id.MSPID, response.Message, want)
+	}
+}
+
+// submit runs Init or Invoke as one transaction, one minute after the previous one
+func (s *testStub) submit(id identity, transient map[string][]byte, init bool, function string, args ...string) pb.Response {
+	s.txCount++
+	txID := fmt.Sprintf("tx%03d", s.txCount)
+	s.now = s.now.Add(time.Minute)
+	s.args = [][]byte{[]byte(function)}
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.creator = s.creatorOf(id)
+	s.transient = transient
+	s.writes = nil
+	s.event = nil
+
+	s.MockTransactionStart(txID)
+	var response pb.Response
+	if init {
+		response = s.cc.Init(s)
+	} else {
+		response = s.cc.Invoke(s)
+	}
+	if response.Status < shim.ERRORTHRESHOLD {
+		for _, write := range s.writes {
+			var err error
+			switch {
+			case len(write.collection) > 0 && write.delete:
+				delete(s.PvtState[write.collection], write.key)
+			case len(write.collection) > 0:
+				err = s.MockStub.PutPrivateData(write.collection, write.key, write.value)
+			case write.delete:
+				err = s.MockStub.DelState(write.key)
+			default:
+				err = s.MockStub.PutState(write.key, write.value)
+			}
+			if err != nil {
+				s.t.Fatalf("commit of %s: %v", txID, err)
+			}
+		}
+		if s.event != nil {
+			s.events = append(s.events, *s.event)
+		}
+	}
+	s.MockTransactionEnd(txID)
+	return response
+}
+
+// publicKeysContaining lists the public state keys whose value contains text
+func (s *testStub) publicKeysContaining(text string) []string {
+	var keys []string
+	for key, value := range s.State {
+		if strings.Contains(string(value), text) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// seed writes records the way an older chaincode version left them, outside of any chaincode function
+func (s *testStub) seed(write func(stub shim.ChaincodeStubInterface) error) {
+	s.t.Helper()
+	s.txCount++
+	txID := fmt.Sprintf("tx%03d", s.txCount)
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	if err := write(s.MockStub); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// creatorOf serializes a self-signed certificate of id the way the peer passes the submitter to cid
+func (s *testStub) creatorOf(id identity) []byte {
+	if creator, found := s.creators[id]; found {
+		return creator
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.creators) + 1)),
+		Subject:      pkix.Name{CommonName: id.EnrollmentID, Organization: []string{id.MSPID}},
+		NotBefore:    time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if id.Admin {
+		attrs, _ := json.Marshal(map[string]map[string]string{"attrs": {adminAttribute: "true"}})
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attrs}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   id.MSPID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.creators[id] = creator
+	return creator
+}
+
+// mustCreateOrganization registers an organization and returns its ID
+func (s *testStub) mustCreateOrganization(by identity, name, mspID string) string {
+	s.t.Helper()
+	var org Organization
+	payload := s.mustInvoke(by, "createOrganization", fmt.Sprintf(`{"name":%q,"mspID":%q}`, name, mspID))
+	if err := json.Unmarshal(payload, &org); err != nil {
+		s.t.Fatal(err)
+	}
+	return org.OrganizationID
+}
+
+// mustCreateParticipant registers the participant of user within an organization
+func (s *testStub) mustCreateParticipant(by identity, participantID, organizationID string, role Role, user identity) {
+	s.t.Helper()
+	s.mustInvoke(by, "createParticipantUser", fmt.Sprintf(`{"participantID":%q,"name":%q,"organization":{"organizationID":%q},"role":%q,"mspID":%q,"enrollmentID":%q}`,
+		participantID, participantID, organizationID, role.String(), user.MSPID, user.EnrollmentID))
+}
+
+// newSupplyChainStub onboards the sample network: seller01 of Org1 sells to buyer01 of Org2,
+// carrier01 of Org3 carries to customer01 of Org2
+func newSupplyChainStub(t *testing.T) (*testStub, sampleNetwork) {
+	s := newTestStub(t, networkAdmin.MSPID, networkAdmin.EnrollmentID)
+	network := sampleNetwork{
+		sellerOrg:  s.mustCreateOrganization(networkAdmin, "Org1", "Org1MSP"),
+		buyerOrg:   s.mustCreateOrganization(networkAdmin, "Org2", "Org2MSP"),
+		carrierOrg: s.mustCreateOrganization(networkAdmin, "Org3", "Org3MSP"),
+	}
+	s.mustCreateParticipant(networkAdmin, "seller01", network.sellerOrg, seller, sellerUser)
+	s.mustCreateParticipant(networkAdmin, "buyer01", network.buyerOrg, customer, buyerUser)
+	s.mustCreateParticipant(networkAdmin, "driver01", network.carrierOrg, driver, driverUser)
+	s.mustCreateParticipant(networkAdmin, "driver02", network.buyerOrg, driver, buyerDriverUser)
+	s.mustCreateParticipant(networkAdmin, "receiver03", network.carrierOrg, customer, carrierReceiverUser)
+	s.mustInvoke(networkAdmin, "createCarrier", `{"carrierID":"carrier01","organizationID":"`+network.carrierOrg+`","name":"Carrier","scac":"CARR","modes":["road"]}`)
+	s.mustInvoke(networkAdmin, "createCustomer", `{"customerID":"customer01","organizationID":"`+network.buyerOrg+`","name":"Customer","billingAddress":{"address":"paris","city":"Paris","country":"FR"},"shippingAddresses":[{"address":"paris","city":"Paris","country":"FR","dock":"ns"}]}`)
+	return s, network
+}
+
+// pricingTransient is the transient map carrying the private price of a purchase order
+func pricingTransient(price float64, salt string) map[string][]byte {
+	return map[string][]byte{pricingTransientKey: []byte(fmt.Sprintf(`{"price":%.2f,"salt":%q}`, price, salt))}
+}
+
+// shipmentPayload is the createShipment JSON of a shipment of purchase order purchaseOrderID
+// from seller01 to buyer01, carried by carrier01 to customer01
+func shipmentPayload(purchaseOrderID string) string {
+	return `{"purchaseOrder":{"purchaseOrderID":"` + purchaseOrderID + `","seller":{"participantID":"seller01"},"buyer":{"participantID":"buyer01"}},` +
+		`"customerID":{"customerID":"customer01"},"carrier":{"carrierID":"carrier01"},` +
+		`"location":{"latitude":"48.8566","longitude":"2.3522","address":"paris","dock":"ns"},` +
+		`"expectedDepartureDate":"2019-03-02T08:00:00Z","expectedArrivedDate":"2019-03-03T08:00:00Z"}`
+}
+
+// orderedShipmentPayload is shipmentPayload with product, the JSON array of the ordered lines
+func orderedShipmentPayload(purchaseOrderID, product string) string {
+	return strings.Replace(shipmentPayload(purchaseOrderID), `"buyer":{"participantID":"buyer01"}`, `"buyer":{"participantID":"buyer01"},"product":`+product, 1)
+}
+
+// lastEvent is the event of the last committed transaction that set one
+func (s *testStub) lastEvent() DomainEvent {
+	s.t.Helper()
+	var event DomainEvent
+	if len(s.events) <= 0 {
+		s.t.Fatal("no event was committed")
+	}
+	if err := json.Unmarshal(s.events[len(s.events)-1].Payload, &event); err != nil {
+		s.t.Fatal(err)
+	}
+	return event
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	var args []string
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) <= 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now.Unix(), Nanos: int32(s.now.Nanosecond())}, nil
+}
+
+func (s *testStub) SetEvent(name string, payload []byte) error {
+	s.event = &pb.ChaincodeEvent{EventName: name, Payload: payload}
+	return nil
+}
+
+func (s *testStub) PutState(key string, value []byte) error {
+	s.writes = append(s.writes, pendingWrite{key: key, value: value})
+	return nil
+}
+
+func (s *testStub) DelState(key string) error {
+	s.writes = append(s.writes, pendingWrite{key: key, delete: true})
+	return nil
+}
+
+func (s *testStub) PutPrivateData(collection, key string, value []byte) error {
+	s.writes = append(s.writes, pendingWrite{collection: collection, key: key, value: value})
+	return nil
+}
+
+func (s *testStub) DelPrivateData(collection, key string) error {
+	s.writes = append(s.writes, pendingWrite{collection: collection, key: key, delete: true})
+	return nil
+}
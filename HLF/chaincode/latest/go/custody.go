@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// pending handovers are keyed by unit and indexed by the receiving participant,
+// completed handovers are appended to the custody log of the unit in tx time order
+const (
+	handoverObjectType     = "handover"
+	counterSigneeIndex     = "counterSignee~handover"
+	custodyLogObjectType   = "custody"
+	defaultHandoverTimeout = 24 * time.Hour
+	sortableTimeLayout     = "20060102T150405.000000000Z"
+)
+
+// HandoverProposal is a custody transfer proposed by the current assignee and awaiting the counter-signee
+type HandoverProposal struct {
+	ProposalID      string    `json:"proposalID"`
+	LogisticsUnitID string    `json:"logisticsUnitID"`
+	FromID          string    `json:"fromParticipantID"`
+	ToID            string    `json:"toParticipantID"`
+	ProposedAt      time.Time `json:"proposedAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	Expired         bool      `json:"expired"`
+}
+
+// CustodyRecord is one completed handover in the custody log of a unit
+type CustodyRecord struct {
+	LogisticsUnitID string    `json:"logisticsUnitID"`
+	ProposalID      string    `json:"proposalID"`
+	FromID          string    `json:"fromParticipantID"`
+	ToID            string    `json:"toParticipantID"`
+	ProposedAt      time.Time `json:"proposedAt"`
+	AcceptedAt      time.Time `json:"acceptedAt"`
+	TxID            string    `json:"txID"`
+}
+
+// getHandover loads the pending handover of a unit, nil if there is none
+func getHandover(stub shim.ChaincodeStubInterface, logisticsUnitID string) (*HandoverProposal, error) {
+	handoverKey, err := stub.CreateCompositeKey(handoverObjectType, []string{logisticsUnitID})
+	if err != nil {
+		return nil, err
+	}
+	handoverAsBytes, err := stub.GetState(handoverKey)
+	if err != nil || handoverAsBytes == nil {
+		return nil, err
+	}
+	var proposal HandoverProposal
+	err = json.Unmarshal(handoverAsBytes, &proposal)
+	return &proposal, err
+}
+
+// deleteHandover removes a pending handover and its counter-signee index entry
+func deleteHandover(stub shim.ChaincodeStubInterface, proposal *HandoverProposal) error {
+	handoverKey, err := stub.CreateCompositeKey(handoverObjectType, []string{proposal.LogisticsUnitID})
+	if err != nil {
+		return err
+	}
+	if err = stub.DelState(handoverKey); err != nil {
+		return err
+	}
+	indexKey, err := stub.CreateCompositeKey(counterSigneeIndex, []string{proposal.ToID, proposal.LogisticsUnitID})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+// unitCustodian is the participant holding custody of a unit: its assignee, which is the creator
+// until the first handover. A unit without one is held by the current owner of its shipment.
+func unitCustodian(stub shim.ChaincodeStubInterface, unit LogisticsUnit) (string, error) {
+	if len(unit.Assignee.ParticipantID) > 0 || len(unit.ShipmentID) <= 0 {
+		return unit.Assignee.ParticipantID, nil
+	}
+	shipment, err := getShipment(stub, unit.ShipmentID)
+	if err != nil {
+		return "", err
+	}
+	return currentOwner(shipment).OwnerID, nil
+}
+
+// ===========================================================================
+// proposeHandover - the custodian of a unit proposes to hand it over to another participant.
+// The custodian is the assignee, or the owner of the unit's shipment for a unit never assigned.
+// args: logisticsUnitID, toParticipantID [, timeout in seconds]
+// ===========================================================================
+func (t *SupplyChainChaincode) proposeHandover(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID and toParticipantID")
+	}
+	logisticsUnitID := args[0]
+	toID := args[1]
+	timeout := defaultHandoverTimeout
+	if len(args) > 2 {
+		seconds, err := strconv.Atoi(args[2])
+		if err != nil || seconds <= 0 {
+			return shim.Error("timeout must be a positive number of seconds")
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	fmt.Println("- start proposeHandover ", logisticsUnitID, toID)
+
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	unit, err := getLogisticsUnit(stub, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	custodianID, err := unitCustodian(stub, unit)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(custodianID) <= 0 {
+		return shim.Error("logistics unit " + logisticsUnitID + " has no custodian to hand it over")
+	}
+	if c.Participant == nil || c.Participant.ParticipantID != custodianID {
+		return denyAccess(stub, newAccessDenied(c, "proposeHandover", "only the custodian "+custodianID+" can hand over "+logisticsUnitID))
+	}
+
+	receiver, err := getParticipant(stub, toID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !receiver.Active {
+		return shim.Error("participant is deactivated: " + toID)
+	}
+	if toID == custodianID {
+		return shim.Error("participant already has custody of " + logisticsUnitID)
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// ==== Only one live proposal per unit, an expired one can be replaced ====
+	pending, err := getHandover(stub, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if pending != nil {
+		if txTime.Before(pending.ExpiresAt) {
+			return shim.Error("a handover of " + logisticsUnitID + " is already pending: " + pending.ProposalID)
+		}
+		if err = deleteHandover(stub, pending); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	proposal := HandoverProposal{
+		ProposalID:      stub.GetTxID(),
+		LogisticsUnitID: logisticsUnitID,
+		FromID:          custodianID,
+		ToID:            toID,
+		ProposedAt:      txTime,
+		ExpiresAt:       txTime.Add(timeout),
+	}
+	proposalAsBytes, err := json.Marshal(proposal)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	handoverKey, err := stub.CreateCompositeKey(handoverObjectType, []string{logisticsUnitID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(handoverKey, proposalAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	indexKey, err := stub.CreateCompositeKey(counterSigneeIndex, []string{toID, logisticsUnitID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	unit.CounterSignee = receiver
+	if _, err = putLogisticsUnit(stub, unit); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end proposeHandover ", proposal.ProposalID)
+	if err = emitEvent(stub, CustodyTransferProposed, logisticsUnitID, proposal.FromID, proposal.ToID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(proposalAsBytes)
+}
+
+// ===========================================================================
+// acceptHandover - the counter-signee accepts a pending handover with their own identity.
+// Custody moves to the counter-signee for the unit and everything packed inside it,
+// pending handovers of the nested units are dropped.
+// args: logisticsUnitID
+// ===========================================================================
+func (t *SupplyChainChaincode) acceptHandover(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID")
+	}
+	logisticsUnitID := args[0]
+	fmt.Println("- start acceptHandover ", logisticsUnitID)
+
+	proposal, err := getHandover(stub, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if proposal == nil {
+		return shim.Error("no handover pending for " + logisticsUnitID)
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if c.Participant == nil || !c.Participant.Active || c.Participant.ParticipantID != proposal.ToID {
+		return denyAccess(stub, newAccessDenied(c, "acceptHandover", "only the counter-signee can accept the handover of "+logisticsUnitID))
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !txTime.Before(proposal.ExpiresAt) {
+		return shim.Error("handover " + proposal.ProposalID + " expired at " + proposal.ExpiresAt.String())
+	}
+
+	receiver := *c.Participant
+	err = updateLogisticsUnitTree(stub, logisticsUnitID, func(unit *LogisticsUnit) error {
+		unit.Assignee = receiver
+		unit.CounterSignee = ParticipantUser{}
+		if unit.LogisticsUnitID == logisticsUnitID {
+			return nil
+		}
+		// ==== A nested unit now follows its parent, its own pending handover can no longer be accepted ====
+		pending, err := getHandover(stub, unit.LogisticsUnitID)
+		if err != nil || pending == nil {
+			return err
+		}
+		fmt.Println("- acceptHandover: dropping pending handover ", pending.ProposalID, " of nested unit ", unit.LogisticsUnitID)
+		return deleteHandover(stub, pending)
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = deleteHandover(stub, proposal); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	record := CustodyRecord{
+		LogisticsUnitID: logisticsUnitID,
+		ProposalID:      proposal.ProposalID,
+		FromID:          proposal.FromID,
+		ToID:            proposal.ToID,
+		ProposedAt:      proposal.ProposedAt,
+		AcceptedAt:      txTime,
+		TxID:            stub.GetTxID(),
+	}
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	custodyKey, err := stub.CreateCompositeKey(custodyLogObjectType, []string{logisticsUnitID, txTime.Format(sortableTimeLayout), record.TxID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(custodyKey, recordAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end acceptHandover ", proposal.FromID, "->", proposal.ToID)
+	if err = emitEvent(stub, CustodyTransferred, logisticsUnitID, proposal.FromID, proposal.ToID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(recordAsBytes)
+}
+
+// ===========================================================================
+// listPendingHandovers - pending handovers, all of them or those awaiting one participant.
+// Proposals past their expiry are returned flagged as expired.
+// args: [toParticipantID]
+// ===========================================================================
+func (t *SupplyChainChaincode) listPendingHandovers(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var logisticsUnitIDs []string
+	if len(args) > 0 && len(args[0]) > 0 {
+		resultsIterator, err := stub.GetStateByPartialCompositeKey(counterSigneeIndex, []string{args[0]})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer resultsIterator.Close()
+		for resultsIterator.HasNext() {
+			responseRange, err := resultsIterator.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			logisticsUnitIDs = append(logisticsUnitIDs, compositeKeyParts[1])
+		}
+	} else {
+		resultsIterator, err := stub.GetStateByPartialCompositeKey(handoverObjectType, []string{})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer resultsIterator.Close()
+		for resultsIterator.HasNext() {
+			responseRange, err := resultsIterator.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			logisticsUnitIDs = append(logisticsUnitIDs, compositeKeyParts[0])
+		}
+	}
+
+	proposals := []HandoverProposal{}
+	for _, logisticsUnitID := range logisticsUnitIDs {
+		proposal, err := getHandover(stub, logisticsUnitID)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if proposal == nil {
+			continue
+		}
+		proposal.Expired = !txTime.Before(proposal.ExpiresAt)
+		proposals = append(proposals, *proposal)
+	}
+	proposalsAsBytes, err := json.Marshal(proposals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(proposalsAsBytes)
+}
+
+// ===========================================================================
+// getCustodyLog - completed handovers of a unit in the order they happened
+// ===========================================================================
+func (t *SupplyChainChaincode) getCustodyLog(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID")
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(custodyLogObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []CustodyRecord{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var record CustodyRecord
+		if err = json.Unmarshal(responseRange.Value, &record); err != nil {
+			return shim.Error(err.Error())
+		}
+		records = append(records, record)
+	}
+	recordsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(recordsAsBytes)
+}
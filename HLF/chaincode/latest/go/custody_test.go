@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestHandoverCustodian(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", shipmentPayload("purchase01"))
+
+	// ==== The creator holds a new unit, whatever assignee the payload names ====
+	var unit LogisticsUnit
+	payload := s.mustInvoke(sellerUser, "createLogisticUnit", `{"logisticsUnitID":"pallet01","type":"pallet","shipmentID":"shipment01","assignee":{"participantID":"driver01"},"location":{"latitude":"48.8566","longitude":"2.3522","address":"paris"}}`)
+	if err := json.Unmarshal(payload, &unit); err != nil {
+		t.Fatal(err)
+	}
+	if unit.Assignee.ParticipantID != "seller01" {
+		t.Errorf("assignee = %q, want the creator seller01", unit.Assignee.ParticipantID)
+	}
+	s.mustDeny(driverUser, "proposeHandover", "pallet01", "driver01")
+	s.mustInvoke(sellerUser, "proposeHandover", "pallet01", "driver01")
+	s.mustInvoke(driverUser, "acceptHandover", "pallet01")
+	s.mustDeny(sellerUser, "proposeHandover", "pallet01", "buyer01")
+	s.mustInvoke(driverUser, "proposeHandover", "pallet01", "buyer01")
+
+	// ==== A unit never assigned is held by the owner of its shipment ====
+	s.seed(func(stub shim.ChaincodeStubInterface) error {
+		_, err := putLogisticsUnit(stub, LogisticsUnit{LogisticsUnitID: "legacy01", Type: unitType, ShipmentID: "shipment01"})
+		return err
+	})
+	s.mustDeny(driverUser, "proposeHandover", "legacy01", "driver01")
+	s.mustInvoke(sellerUser, "proposeHandover", "legacy01", "driver01")
+	if event := s.lastEvent(); event.EventType != CustodyTransferProposed || event.OldState != "seller01" || event.NewState != "driver01" {
+		t.Errorf("last event = %+v, want %s from seller01 to driver01", event, CustodyTransferProposed)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// customers are keyed by customerID
+const customerObjectType = "customer"
+
+// getCustomer loads a registered customer
+func getCustomer(stub shim.ChaincodeStubInterface, customerID string) (Customer, error) {
+	var customer Customer
+	customerAsBytes, err := getObjectState(stub, customerObjectType, customerID)
+	if err != nil {
+		return customer, fmt.Errorf("failed to get customer %s: %s", customerID, err.Error())
+	} else if customerAsBytes == nil {
+		return customer, fmt.Errorf("customer does not exist: %s", customerID)
+	}
+	err = json.Unmarshal(customerAsBytes, &customer)
+	return customer, err
+}
+
+// putCustomer writes a customer record
+func putCustomer(stub shim.ChaincodeStubInterface, customer Customer) ([]byte, error) {
+	customerAsBytes, err := json.Marshal(customer)
+	if err != nil {
+		return nil, err
+	}
+	return customerAsBytes, putObjectState(stub, customerObjectType, customer.CustomerID, customerAsBytes)
+}
+
+// customerOrganizationID is the organization receiving for a customer, empty for a customer that is not registered
+func customerOrganizationID(stub shim.ChaincodeStubInterface, customerID string) (string, error) {
+	customerAsBytes, err := getObjectState(stub, customerObjectType, customerID)
+	if err != nil || customerAsBytes == nil {
+		return "", err
+	}
+	var customer Customer
+	err = json.Unmarshal(customerAsBytes, &customer)
+	return customer.OrganizationID, err
+}
+
+// validateCustomer normalizes and checks the descriptive fields of a customer
+func validateCustomer(customer *Customer) error {
+	customer.Name = strings.TrimSpace(customer.Name)
+	v := newValidator("customer")
+	v.required("name", customer.Name)
+	if customer.BillingAddress == nil {
+		v.add("billingAddress", "is required")
+	} else {
+		v.location("billingAddress", *customer.BillingAddress)
+	}
+	if len(customer.ShippingAddresses) <= 0 {
+		v.add("shippingAddresses", "must contain at least one address")
+	}
+	for i, address := range customer.ShippingAddresses {
+		v.location(fmt.Sprintf("shippingAddresses[%d]", i), address)
+	}
+	return v.err()
+}
+
+// ============================================================
+// createCustomer - register a customer whose deliveries an organization receives
+// args: customer JSON {customerID, organizationID, name, billingAddress, shippingAddresses}
+// ============================================================
+func (t *SupplyChainChaincode) createCustomer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting customer JSON")
+	}
+	fmt.Println("- start createCustomer")
+
+	var customer Customer
+	if err := decodeInput("customer", args[0], &customer); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(customer.CustomerID) <= 0 {
+		return shim.Error("customerID must be a non-empty string")
+	}
+	if err := validateCustomer(&customer); err != nil {
+		return shim.Error(err.Error())
+	}
+	if denied, err := bindOrganization(stub, "createCustomer", customer.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	if _, err := getCustomer(stub, customer.CustomerID); err == nil {
+		return shim.Error("This customerID already exists: " + customer.CustomerID)
+	}
+	customer.Active = true
+
+	customerAsBytes, err := putCustomer(stub, customer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end createCustomer")
+	if err = emitEvent(stub, CustomerCreated, customer.CustomerID, "", activeState(true)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(customerAsBytes)
+}
+
+// ============================================================
+// readCustomer - read a customer
+// ============================================================
+func (t *SupplyChainChaincode) readCustomer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting customerID")
+	}
+	customerAsBytes, err := getObjectState(stub, customerObjectType, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if customerAsBytes == nil {
+		return shim.Error("customer does not exist: " + args[0])
+	}
+	return shim.Success(customerAsBytes)
+}
+
+// ============================================================
+// updateCustomer - replace the name and addresses of a customer
+// args: customerID, customer JSON {name, billingAddress, shippingAddresses}
+// ============================================================
+func (t *SupplyChainChaincode) updateCustomer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting customerID and customer JSON")
+	}
+	var update Customer
+	if err := decodeInput("customer", args[1], &update); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateCustomer(&update); err != nil {
+		return shim.Error(err.Error())
+	}
+	customer, err := getCustomer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !customer.Active {
+		return shim.Error("customer is deactivated: " + customer.CustomerID)
+	}
+	if denied, err := checkOrganizationMaintainer(stub, "updateCustomer", customer.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	oldName := customer.Name
+	customer.Name = update.Name
+	customer.BillingAddress = update.BillingAddress
+	customer.ShippingAddresses = update.ShippingAddresses
+
+	customerAsBytes, err := putCustomer(stub, customer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, CustomerUpdated, customer.CustomerID, oldName, customer.Name); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(customerAsBytes)
+}
+
+// ============================================================
+// deactivateCustomer - mark a customer inactive, new shipments can no longer reference it
+// ============================================================
+func (t *SupplyChainChaincode) deactivateCustomer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting customerID")
+	}
+	customer, err := getCustomer(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !customer.Active {
+		return shim.Error("customer is already deactivated: " + customer.CustomerID)
+	}
+	if denied, err := checkOrganizationMaintainer(stub, "deactivateCustomer", customer.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	customer.Active = false
+
+	customerAsBytes, err := putCustomer(stub, customer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, CustomerDeactivated, customer.CustomerID, activeState(true), activeState(false)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(customerAsBytes)
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// disputes are keyed by shipment and indexed by purchase order
+const (
+	disputeObjectType         = "dispute"
+	purchaseOrderDisputeIndex = "purchaseOrder~dispute"
+)
+
+// DisputeStatus is the state of a dispute thread
+type DisputeStatus string
+
+const (
+	disputeOpen     DisputeStatus = "open"
+	disputeResolved DisputeStatus = "resolved"
+)
+
+// String returns the name of the dispute status
+func (s DisputeStatus) String() string {
+	return string(s)
+}
+
+// Dispute is the thread opened against a shipment, optionally about one logistics unit.
+// Approvals maps the organizations of the buyer and of the seller to the resolution each approved.
+type Dispute struct {
+	DisputeID       string            `json:"disputeID"`
+	ShipmentID      string            `json:"shipmentID"`
+	PurchaseOrderID string            `json:"purchaseOrderID"`
+	LogisticsUnitID string            `json:"logisticsUnitID,omitempty"`
+	Reason          string            `json:"reason"`
+	Status          DisputeStatus     `json:"status"`
+	Comments        []DisputeComment  `json:"comments"`
+	Approvals       map[string]string `json:"approvals"`
+	Resolution      string            `json:"resolution,omitempty"`
+	History         []StateTransition `json:"history"`
+}
+
+// DisputeComment is one entry of a dispute thread
+type DisputeComment struct {
+	ActorMSP  string    `json:"actorMSP"`
+	ActorID   string    `json:"actorID"`
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	Comment   string    `json:"comment"`
+}
+
+// getDispute loads one dispute thread of a shipment
+func getDispute(stub shim.ChaincodeStubInterface, shipmentID, disputeID string) (Dispute, error) {
+	var dispute Dispute
+	disputeKey, err := stub.CreateCompositeKey(disputeObjectType, []string{shipmentID, disputeID})
+	if err != nil {
+		return dispute, err
+	}
+	disputeAsBytes, err := stub.GetState(disputeKey)
+	if err != nil {
+		return dispute, fmt.Errorf("failed to get dispute %s: %s", disputeID, err.Error())
+	} else if disputeAsBytes == nil {
+		return dispute, fmt.Errorf("dispute does not exist: %s", disputeID)
+	}
+	err = json.Unmarshal(disputeAsBytes, &dispute)
+	return dispute, err
+}
+
+// putDispute writes a dispute thread under its shipment
+func putDispute(stub shim.ChaincodeStubInterface, dispute Dispute) ([]byte, error) {
+	disputeKey, err := stub.CreateCompositeKey(disputeObjectType, []string{dispute.ShipmentID, dispute.DisputeID})
+	if err != nil {
+		return nil, err
+	}
+	disputeAsBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return nil, err
+	}
+	return disputeAsBytes, stub.PutState(disputeKey, disputeAsBytes)
+}
+
+// newDisputeComment stamps a comment with the submitter and tx timestamp
+func newDisputeComment(stub shim.ChaincodeStubInterface, comment string) (DisputeComment, error) {
+	var entry DisputeComment
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return entry, err
+	}
+	actorID, err := cid.GetID(stub)
+	if err != nil {
+		return entry, err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return entry, err
+	}
+	entry = DisputeComment{
+		ActorMSP:  mspID,
+		ActorID:   actorID,
+		TxID:      stub.GetTxID(),
+		Timestamp: txTime,
+		Comment:   comment,
+	}
+	return entry, nil
+}
+
+// getOpenDispute loads the shipment and the dispute currently open on it
+func getOpenDispute(stub shim.ChaincodeStubInterface, shipmentID string) (Shipment, Dispute, error) {
+	var dispute Dispute
+	shipment, err := getShipment(stub, shipmentID)
+	if err != nil {
+		return shipment, dispute, err
+	}
+	if !shipment.Dispute || len(shipment.DisputeID) <= 0 {
+		return shipment, dispute, fmt.Errorf("shipment has no open dispute: %s", shipmentID)
+	}
+	dispute, err = getDispute(stub, shipmentID, shipment.DisputeID)
+	return shipment, dispute, err
+}
+
+// isShipmentParty reports whether a participant may raise a dispute on a shipment: the buyer or
+// seller of its purchase order, its current owner or the carrier's participant holding custody of
+// the disputed logistics unit or of a unit of the order
+func isShipmentParty(stub shim.ChaincodeStubInterface, shipment Shipment, participantID, logisticsUnitID string) (bool, error) {
+	if len(participantID) <= 0 {
+		return false, nil
+	}
+	if participantID == currentOwner(shipment).OwnerID {
+		return true, nil
+	}
+	purchaseOrder, err := getPurchaseOrder(stub, shipment.PurchaseOrder.PurchaseOrderID)
+	if err != nil {
+		return false, err
+	}
+	if participantID == purchaseOrder.Buyer.ParticipantID || participantID == purchaseOrder.Seller.ParticipantID {
+		return true, nil
+	}
+	unitIDs := []string{}
+	if len(logisticsUnitID) > 0 {
+		unitIDs = append(unitIDs, logisticsUnitID)
+	}
+	for _, line := range purchaseOrder.Product {
+		unitIDs = append(unitIDs, line.LogisticsUnitID)
+	}
+	for _, unitID := range unitIDs {
+		unitAsBytes, err := getObjectState(stub, logisticsUnitObjectType, unitID)
+		if err != nil {
+			return false, err
+		} else if unitAsBytes == nil {
+			continue
+		}
+		var unit LogisticsUnit
+		if err = json.Unmarshal(unitAsBytes, &unit); err != nil {
+			return false, err
+		}
+		if unit.Assignee.ParticipantID == participantID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// openDispute opens a dispute thread on a shipment and freezes it. The shipment is
+// written by openDispute, so callers set any other shipment changes beforehand.
+func openDispute(stub shim.ChaincodeStubInterface, shipment Shipment, reason, logisticsUnitID string) (Dispute, error) {
+	shipmentID := shipment.ShipmentID
+	dispute := Dispute{
+		DisputeID:       stub.GetTxID(),
+		ShipmentID:      shipmentID,
+		PurchaseOrderID: shipment.PurchaseOrder.PurchaseOrderID,
+		LogisticsUnitID: logisticsUnitID,
+		Reason:          reason,
+		Status:          disputeOpen,
+		Comments:        []DisputeComment{},
+		Approvals:       map[string]string{},
+	}
+	if shipment.Dispute {
+		return dispute, fmt.Errorf("shipment already has an open dispute: %s", shipment.DisputeID)
+	}
+	transition, err := newStateTransition(stub, DisputeStatus(""), disputeOpen, reason)
+	if err != nil {
+		return dispute, err
+	}
+	dispute.History = append(dispute.History, transition)
+
+	if len(logisticsUnitID) > 0 {
+		unit, err := getLogisticsUnit(stub, logisticsUnitID)
+		if err != nil {
+			return dispute, err
+		}
+		if unit.ShipmentID != shipmentID {
+			return dispute, fmt.Errorf("logistics unit %s is not part of shipment %s", logisticsUnitID, shipmentID)
+		}
+		unit.DisputeReason = reason
+		unit.DisputeComment = ""
+		if _, err = putLogisticsUnit(stub, unit); err != nil {
+			return dispute, err
+		}
+	}
+
+	if _, err = putDispute(stub, dispute); err != nil {
+		return dispute, err
+	}
+	if len(dispute.PurchaseOrderID) > 0 {
+		indexKey, err := stub.CreateCompositeKey(purchaseOrderDisputeIndex, []string{dispute.PurchaseOrderID, shipmentID, dispute.DisputeID})
+		if err != nil {
+			return dispute, err
+		}
+		if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return dispute, err
+		}
+	}
+
+	shipment.Dispute = true
+	shipment.ReasonDispute = reason
+	shipment.DisputeID = dispute.DisputeID
+	_, err = putShipment(stub, shipment)
+	return dispute, err
+}
+
+// ===========================================================================
+// raiseDispute - open a dispute on a shipment, freezing its state transitions.
+// Only the buyer, seller, current owner or carrier of the shipment may raise it.
+// args: shipmentID, reason [, logisticsUnitID]
+// ===========================================================================
+func (t *SupplyChainChaincode) raiseDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and reason")
+	}
+	shipmentID := args[0]
+	reason := args[1]
+	logisticsUnitID := ""
+	if len(args) > 2 {
+		logisticsUnitID = args[2]
+	}
+	fmt.Println("- start raiseDispute ", shipmentID)
+
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	participantID := ""
+	if c.Participant != nil {
+		participantID = c.Participant.ParticipantID
+	}
+	party, err := isShipmentParty(stub, shipment, participantID, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !party {
+		return denyAccess(stub, newAccessDenied(c, "raiseDispute", "only the buyer, seller, owner or carrier of shipment "+shipmentID+" can raise a dispute"))
+	}
+	dispute, err := openDispute(stub, shipment, reason, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disputeAsBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end raiseDispute ", dispute.DisputeID)
+	if err = emitEvent(stub, DisputeRaised, dispute.DisputeID, "", disputeOpen.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputeAsBytes)
+}
+
+// ===========================================================================
+// commentOnDispute - append a comment to the open dispute of a shipment.
+// Only the parties that may raise a dispute on the shipment may comment.
+// args: shipmentID, comment
+// ===========================================================================
+func (t *SupplyChainChaincode) commentOnDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and comment")
+	}
+	shipment, dispute, err := getOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	participantID := ""
+	if c.Participant != nil {
+		participantID = c.Participant.ParticipantID
+	}
+	party, err := isShipmentParty(stub, shipment, participantID, dispute.LogisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !party {
+		return denyAccess(stub, newAccessDenied(c, "commentOnDispute", "only the buyer, seller, owner or carrier of shipment "+args[0]+" can comment on its dispute"))
+	}
+	entry, err := newDisputeComment(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dispute.Comments = append(dispute.Comments, entry)
+
+	if len(dispute.LogisticsUnitID) > 0 {
+		unit, err := getLogisticsUnit(stub, dispute.LogisticsUnitID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		unit.DisputeComment = args[1]
+		if _, err = putLogisticsUnit(stub, unit); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	disputeAsBytes, err := putDispute(stub, dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, DisputeCommented, dispute.DisputeID, dispute.Status.String(), dispute.Status.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputeAsBytes)
+}
+
+// ===========================================================================
+// resolveDispute - approve a resolution on behalf of the buyer or seller of the purchase order.
+// Approvals are kept per organization, the dispute closes once the organizations of the buyer
+// and of the seller approved the same resolution. Both parties must belong to distinct organizations.
+// args: shipmentID, resolution
+// ===========================================================================
+func (t *SupplyChainChaincode) resolveDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and resolution")
+	}
+	resolution := args[1]
+	shipment, dispute, err := getOpenDispute(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Buyer and seller are the registered participants of the purchase order, approvals are kept per organization ====
+	purchaseOrder, err := getPurchaseOrder(stub, dispute.PurchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	buyerID := purchaseOrder.Buyer.ParticipantID
+	sellerID := purchaseOrder.Seller.ParticipantID
+
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if c.Participant == nil || (c.Participant.ParticipantID != buyerID && c.Participant.ParticipantID != sellerID) {
+		return denyAccess(stub, newAccessDenied(c, "resolveDispute", "only the buyer or seller of purchase order "+dispute.PurchaseOrderID+" can resolve this dispute"))
+	}
+	buyerOrganizationID, err := participantOrganizationID(stub, buyerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sellerOrganizationID, err := participantOrganizationID(stub, sellerID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if buyerOrganizationID == sellerOrganizationID {
+		return shim.Error("buyer and seller of purchase order " + dispute.PurchaseOrderID + " belong to organization " + buyerOrganizationID + ", its disputes cannot be resolved by mutual approval")
+	}
+	dispute.Approvals[c.Participant.Organization.OrganizationID] = resolution
+
+	entry, err := newDisputeComment(stub, "proposed resolution: "+resolution)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dispute.Comments = append(dispute.Comments, entry)
+
+	if dispute.Approvals[buyerOrganizationID] == resolution && dispute.Approvals[sellerOrganizationID] == resolution {
+		transition, err := newStateTransition(stub, disputeOpen, disputeResolved, resolution)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		dispute.Status = disputeResolved
+		dispute.Resolution = resolution
+		dispute.History = append(dispute.History, transition)
+
+		shipment.Dispute = false
+		shipment.ReasonDispute = ""
+		shipment.DisputeID = ""
+		if _, err = putShipment(stub, shipment); err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println("- resolveDispute: dispute resolved ", dispute.DisputeID)
+	}
+
+	disputeAsBytes, err := putDispute(stub, dispute)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	eventType := DisputeResolutionProposed
+	if dispute.Status == disputeResolved {
+		eventType = DisputeResolved
+	}
+	if err = emitEvent(stub, eventType, dispute.DisputeID, disputeOpen.String(), dispute.Status.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputeAsBytes)
+}
+
+// ===========================================================================
+// getDisputesByShipment - every dispute thread raised against a shipment
+// ===========================================================================
+func (t *SupplyChainChaincode) getDisputesByShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(disputeObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	disputes := []Dispute{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var dispute Dispute
+		if err = json.Unmarshal(responseRange.Value, &dispute); err != nil {
+			return shim.Error(err.Error())
+		}
+		disputes = append(disputes, dispute)
+	}
+	disputesAsBytes, err := json.Marshal(disputes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputesAsBytes)
+}
+
+// ===========================================================================
+// getDisputesByPurchaseOrder - every dispute thread raised against the shipments of a purchase order
+// ===========================================================================
+func (t *SupplyChainChaincode) getDisputesByPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(purchaseOrderDisputeIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	disputes := []Dispute{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		dispute, err := getDispute(stub, compositeKeyParts[1], compositeKeyParts[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		disputes = append(disputes, dispute)
+	}
+	disputesAsBytes, err := json.Marshal(disputes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(disputesAsBytes)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDisputeParties(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", shipmentPayload("purchase01"))
+	s.mustInvoke(buyerUser, "raiseDispute", "shipment01", "damaged pallet")
+
+	// ==== Only the shipment parties take part in the thread ====
+	s.mustDeny(buyerDriverUser, "commentOnDispute", "shipment01", "not my shipment")
+	s.mustDeny(carrierReceiverUser, "commentOnDispute", "shipment01", "not my shipment")
+	s.mustInvoke(sellerUser, "commentOnDispute", "shipment01", "photos please")
+
+	// ==== The dispute closes once both organizations approved the same resolution ====
+	s.mustInvoke(buyerUser, "resolveDispute", "shipment01", "refund")
+	if event := s.lastEvent(); event.EventType != DisputeResolutionProposed {
+		t.Errorf("last event = %s, want %s", event.EventType, DisputeResolutionProposed)
+	}
+	s.mustInvoke(sellerUser, "resolveDispute", "shipment01", "credit note")
+	var dispute Dispute
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "resolveDispute", "shipment01", "credit note"), &dispute); err != nil {
+		t.Fatal(err)
+	}
+	if dispute.Status != disputeResolved || dispute.Approvals[network.buyerOrg] != "credit note" || dispute.Approvals[network.sellerOrg] != "credit note" {
+		t.Errorf("dispute = %s with approvals %v, want resolved by both organizations", dispute.Status, dispute.Approvals)
+	}
+
+	// ==== A buyer of the seller's own organization cannot approve on both sides ====
+	buyer11 := identity{MSPID: "Org1MSP", EnrollmentID: "User3@org1.example.com"}
+	s.mustCreateParticipant(networkAdmin, "buyer11", network.sellerOrg, customer, buyer11)
+	s.mustInvoke(sellerUser, "createShipment", "shipment02", strings.Replace(shipmentPayload("purchase02"), "buyer01", "buyer11", 1))
+	s.mustInvoke(buyer11, "raiseDispute", "shipment02", "missing box")
+	s.mustFail(buyer11, "cannot be resolved by mutual approval", "resolveDispute", "shipment02", "refund")
+}
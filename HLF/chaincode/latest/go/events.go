@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// eventVersion is bumped whenever the DomainEvent body changes incompatibly
+const eventVersion = "1.0"
+
+// one event name per business fact. Fabric keeps a single event per transaction,
+// so every mutating function emits exactly one of these as its last step.
+const (
+	OrganizationCreated       = "OrganizationCreated"
+	OrganizationUpdated       = "OrganizationUpdated"
+	OrganizationDeactivated   = "OrganizationDeactivated"
+	ParticipantCreated        = "ParticipantCreated"
+	ParticipantRoleChanged    = "ParticipantRoleChanged"
+	ParticipantDeactivated    = "ParticipantDeactivated"
+	ShipmentCreated           = "ShipmentCreated"
+	ShipmentStateChanged      = "ShipmentStateChanged"
+	ShipmentTransferred       = "ShipmentTransferred"
+	PurchaseOrderStateChanged = "PurchaseOrderStateChanged"
+	LogisticsUnitCreated      = "LogisticsUnitCreated"
+	LogisticsUnitPackaged     = "LogisticsUnitPackaged"
+	LogisticsUnitMoved        = "LogisticsUnitMoved"
+	LogisticsUnitStateChanged = "LogisticsUnitStateChanged"
+	DisputeRaised             = "DisputeRaised"
+	DisputeCommented          = "DisputeCommented"
+	DisputeResolutionProposed = "DisputeResolutionProposed"
+	DisputeResolved           = "DisputeResolved"
+	CustodyTransferProposed   = "CustodyTransferProposed"
+	CustodyTransferred        = "CustodyTransferred"
+	FundsDeposited            = "FundsDeposited"
+	DeliveryReconciled        = "DeliveryReconciled"
+	ComplianceThresholdsSet   = "ComplianceThresholdsSet"
+	TelemetryRecorded         = "TelemetryRecorded"
+	ComplianceBreached        = "ComplianceBreached"
+	ShipmentPositionUpdated   = "ShipmentPositionUpdated"
+	SLAContractSet            = "SLAContractSet"
+	CarrierCreated            = "CarrierCreated"
+	CarrierUpdated            = "CarrierUpdated"
+	CarrierDeactivated        = "CarrierDeactivated"
+	CustomerCreated           = "CustomerCreated"
+	CustomerUpdated           = "CustomerUpdated"
+	CustomerDeactivated       = "CustomerDeactivated"
+	ShipmentsImported         = "ShipmentsImported"
+	ShipmentArchived          = "ShipmentArchived"
+	ShipmentDeleted           = "ShipmentDeleted"
+	PurchaseOrderArchived     = "PurchaseOrderArchived"
+	PurchaseOrderDeleted      = "PurchaseOrderDeleted"
+)
+
+// DomainEvent is the versioned body carried by every chaincode event. A batch event
+// lists the entities it covers in EntityIDs and leaves EntityID empty.
+// SmartProperty.go in chaincode_example02 carries a copy of this envelope and of
+// emitBatchEvent, the two chaincodes are packaged apart and must be kept in sync by hand.
+type DomainEvent struct {
+	Version   string   `json:"version"`
+	EventType string   `json:"eventType"`
+	EntityID  string   `json:"entityID"`
+	EntityIDs []string `json:"entityIDs,omitempty"`
+	OldState  string   `json:"oldState"`
+	NewState  string   `json:"newState"`
+	ActorMSP  string   `json:"actorMSP"`
+	TxID      string   `json:"txID"`
+}
+
+// emitEvent sets the typed event of the current transaction
+func emitEvent(stub shim.ChaincodeStubInterface, eventType, entityID, oldState, newState string) error {
+	return setDomainEvent(stub, DomainEvent{EventType: eventType, EntityID: entityID, OldState: oldState, NewState: newState})
+}
+
+// emitBatchEvent sets one typed event for every entity a transaction moved from oldState to newState
+func emitBatchEvent(stub shim.ChaincodeStubInterface, eventType string, entityIDs []string, oldState, newState string) error {
+	return setDomainEvent(stub, DomainEvent{EventType: eventType, EntityIDs: entityIDs, OldState: oldState, NewState: newState})
+}
+
+// setDomainEvent stamps the envelope with the version, actor and transaction and sets it
+func setDomainEvent(stub shim.ChaincodeStubInterface, event DomainEvent) error {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return err
+	}
+	event.Version = eventVersion
+	event.ActorMSP = mspID
+	event.TxID = stub.GetTxID()
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	fmt.Println("event message: " + string(eventAsBytes))
+	return stub.SetEvent(event.EventType, eventAsBytes)
+}
+
+// activeState names the active flag of registry records in events
+func activeState(active bool) string {
+	if active {
+		return "active"
+	}
+	return "inactive"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// every supply chain object lives under its own composite key namespace so IDs
+// of different object types can never collide or show up in each other's queries
+const (
+	shipmentObjectType      = "shipment"
+	purchaseOrderObjectType = "purchaseOrder"
+	organizationObjectType  = "organization"
+)
+
+// getObjectState reads an object by type and ID, returning nil if it does not exist
+func getObjectState(stub shim.ChaincodeStubInterface, objectType, id string) ([]byte, error) {
+	objectKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	return stub.GetState(objectKey)
+}
+
+// putObjectState writes an object by type and ID
+func putObjectState(stub shim.ChaincodeStubInterface, objectType, id string, value []byte) error {
+	objectKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(objectKey, value)
+}
+
+// deleteObjectState removes an object by type and ID, its ledger history is kept
+func deleteObjectState(stub shim.ChaincodeStubInterface, objectType, id string) error {
+	objectKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(objectKey)
+}
+
+// getObjectsByRange lists the objects of one type with startID <= ID < endID as [{"Key", "Record"}].
+// An empty endID means no upper bound. The partial composite key iterator returns keys in ID order.
+func getObjectsByRange(stub shim.ChaincodeStubInterface, objectType, startID, endID string) ([]byte, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	buffer, _, err := constructObjectResponseFromIterator(stub, resultsIterator, startID, endID)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("- getObjectsByRange %s queryResult:\n%s\n", objectType, buffer.String())
+
+	return buffer.Bytes(), nil
+}
+
+// ===========================================================================
+// getObjectsByRangeResponse - range query over one object type
+// args: startID, endID
+// ===========================================================================
+func getObjectsByRangeResponse(stub shim.ChaincodeStubInterface, objectType string, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	queryResults, err := getObjectsByRange(stub, objectType, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// ===========================================================================
+// listObjectsResponse - every object of one type
+// ===========================================================================
+func listObjectsResponse(stub shim.ChaincodeStubInterface, objectType string) pb.Response {
+	queryResults, err := getObjectsByRange(stub, objectType, "", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
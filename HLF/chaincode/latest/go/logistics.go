@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// logistics units are stored under their own composite key namespace, children are indexed by parent
+const (
+	logisticsUnitObjectType = "logisticsUnit"
+	parentChildIndex        = "parent~child"
+)
+
+// packaging levels, a unit can only be packed into a strictly higher level
+const (
+	unitType      = "unit"
+	palletType    = "pallet"
+	containerType = "container"
+)
+
+var packagingLevels = map[string]int{
+	unitType:      0,
+	palletType:    1,
+	containerType: 2,
+}
+
+// LogisticsUnitTree is a unit with its nested children and rolled-up totals.
+// TotalPrice is left out when a unit of the tree is priced in a collection the caller's MSP is not a member of.
+type LogisticsUnitTree struct {
+	LogisticsUnit
+	Children      []LogisticsUnitTree `json:"children"`
+	TotalSize     float64             `json:"totalSize"`
+	TotalWeight   float64             `json:"totalWeight"`
+	TotalQuantity int                 `json:"totalQuantity"`
+	TotalPrice    *float64            `json:"totalPrice,omitempty"`
+}
+
+// getLogisticsUnit loads a logistics unit from its composite key
+func getLogisticsUnit(stub shim.ChaincodeStubInterface, logisticsUnitID string) (LogisticsUnit, error) {
+	var unit LogisticsUnit
+	unitKey, err := stub.CreateCompositeKey(logisticsUnitObjectType, []string{logisticsUnitID})
+	if err != nil {
+		return unit, err
+	}
+	unitAsBytes, err := stub.GetState(unitKey)
+	if err != nil {
+		return unit, fmt.Errorf("failed to get logistics unit %s: %s", logisticsUnitID, err.Error())
+	} else if unitAsBytes == nil {
+		return unit, fmt.Errorf("logistics unit does not exist: %s", logisticsUnitID)
+	}
+	err = json.Unmarshal(unitAsBytes, &unit)
+	return unit, err
+}
+
+// putLogisticsUnit writes a logistics unit under its composite key
+func putLogisticsUnit(stub shim.ChaincodeStubInterface, unit LogisticsUnit) ([]byte, error) {
+	unitKey, err := stub.CreateCompositeKey(logisticsUnitObjectType, []string{unit.LogisticsUnitID})
+	if err != nil {
+		return nil, err
+	}
+	unitAsBytes, err := json.Marshal(unit)
+	if err != nil {
+		return nil, err
+	}
+	return unitAsBytes, stub.PutState(unitKey, unitAsBytes)
+}
+
+// getChildIDs lists the IDs of the units packed directly into a parent
+func getChildIDs(stub shim.ChaincodeStubInterface, parentID string) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(parentChildIndex, []string{parentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var childIDs []string
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		childIDs = append(childIDs, compositeKeyParts[1])
+	}
+	return childIDs, nil
+}
+
+// updateLogisticsUnitTree applies update to a unit and every unit nested below it,
+// stopping at the first unit update refuses
+func updateLogisticsUnitTree(stub shim.ChaincodeStubInterface, logisticsUnitID string, update func(*LogisticsUnit) error) error {
+	unit, err := getLogisticsUnit(stub, logisticsUnitID)
+	if err != nil {
+		return err
+	}
+	if err = update(&unit); err != nil {
+		return err
+	}
+	if _, err = putLogisticsUnit(stub, unit); err != nil {
+		return err
+	}
+	childIDs, err := getChildIDs(stub, logisticsUnitID)
+	if err != nil {
+		return err
+	}
+	for _, childID := range childIDs {
+		if err = updateLogisticsUnitTree(stub, childID, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPackaging checks that unit may be packed into parent: the parent must be of a strictly
+// higher packaging level and the unit must not be one of its ancestors, loaded through getUnit
+func checkPackaging(unit, parent LogisticsUnit, getUnit func(string) (LogisticsUnit, error)) error {
+	if packagingLevels[parent.Type] <= packagingLevels[unit.Type] {
+		return fmt.Errorf("a %s cannot be packed into a %s", unit.Type, parent.Type)
+	}
+	// ==== Walk up from the new parent, the unit must not be one of its ancestors ====
+	for ancestor := parent; ; {
+		if ancestor.LogisticsUnitID == unit.LogisticsUnitID {
+			return fmt.Errorf("packaging %s into %s would create a cycle", unit.LogisticsUnitID, parent.LogisticsUnitID)
+		}
+		if len(ancestor.ParentID) <= 0 {
+			return nil
+		}
+		var err error
+		ancestor, err = getUnit(ancestor.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logisticsUnitPrice is the price of a unit as seen by an MSP. Units priced before private pricing
+// keep a public price, the others are only known to the members of their pricing collection.
+func logisticsUnitPrice(stub shim.ChaincodeStubInterface, unit LogisticsUnit, mspID string) (*float64, error) {
+	if len(unit.PriceHash) <= 0 {
+		return &unit.Price, nil
+	}
+	if !isCollectionMember(unit.PriceCollection, mspID) {
+		return nil, nil
+	}
+	price, err := getPrivatePrice(stub, unit.PriceCollection, logisticsUnitObjectType, unit.LogisticsUnitID, unit.PriceHash)
+	if err != nil {
+		return nil, err
+	}
+	return &price.Price, nil
+}
+
+// buildLogisticsUnitTree loads a unit with its children and rolls up size, weight, quantity and
+// the price, which is only rolled up when mspID may read the price of every unit of the tree
+func buildLogisticsUnitTree(stub shim.ChaincodeStubInterface, logisticsUnitID, mspID string) (LogisticsUnitTree, error) {
+	var tree LogisticsUnitTree
+	unit, err := getLogisticsUnit(stub, logisticsUnitID)
+	if err != nil {
+		return tree, err
+	}
+	tree.LogisticsUnit = unit
+	tree.Children = []LogisticsUnitTree{}
+	tree.TotalSize = unit.Size
+	tree.TotalWeight = unit.Weight
+	tree.TotalQuantity = unit.Quantity
+	if tree.TotalPrice, err = logisticsUnitPrice(stub, unit, mspID); err != nil {
+		return tree, err
+	}
+
+	childIDs, err := getChildIDs(stub, logisticsUnitID)
+	if err != nil {
+		return tree, err
+	}
+	for _, childID := range childIDs {
+		child, err := buildLogisticsUnitTree(stub, childID, mspID)
+		if err != nil {
+			return tree, err
+		}
+		tree.Children = append(tree.Children, child)
+		tree.TotalSize += child.TotalSize
+		tree.TotalWeight += child.TotalWeight
+		tree.TotalQuantity += child.TotalQuantity
+		if tree.TotalPrice != nil && child.TotalPrice != nil {
+			*tree.TotalPrice += *child.TotalPrice
+		} else {
+			tree.TotalPrice = nil
+		}
+	}
+	return tree, nil
+}
+
+// ===========================================================================
+// createLogisticUnit - create a unit, pallet or container in the custody of its creator
+// args: logistics unit JSON
+// ===========================================================================
+func (t *SupplyChainChaincode) createLogisticUnit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting logistics unit JSON")
+	}
+	fmt.Println("- start createLogisticUnit")
+
+	var unit LogisticsUnit
+	err := decodeInput("logisticsUnit", args[0], &unit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = validateLogisticsUnit(unit); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getLogisticsUnit(stub, unit.LogisticsUnitID); err == nil {
+		return shim.Error("This logisticsUnitID already exists: " + unit.LogisticsUnitID)
+	}
+	// ==== Packaging is only changed through packageLogistic, custody starts with the creator ====
+	unit.ParentID = ""
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if c.Participant == nil {
+		return denyAccess(stub, newAccessDenied(c, "createLogisticUnit", "only a registered participant can create a logistics unit"))
+	}
+	unit.Assignee = *c.Participant
+	unit.CounterSignee = ParticipantUser{}
+
+	// ==== The price travels in the transient map, the unit only keeps its hash ====
+	if unit.Price != 0 {
+		return shim.Error("price must be passed in the transient map under " + pricingTransientKey + ", not in the logistics unit")
+	}
+	unit.PriceHash = ""
+	unit.PriceCollection = ""
+	price, err := getTransientPrice(stub, pricingTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if price != nil {
+		collection, err := logisticsUnitCollection(stub, unit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		price.LinePrices = nil
+		unit.PriceHash, err = putPrivatePrice(stub, collection, logisticsUnitObjectType, unit.LogisticsUnitID, *price)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		unit.PriceCollection = collection
+	}
+
+	unitAsBytes, err := putLogisticsUnit(stub, unit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end createLogisticUnit")
+	if err = emitEvent(stub, LogisticsUnitCreated, unit.LogisticsUnitID, "", unit.LogisticsState.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(unitAsBytes)
+}
+
+// ===========================================================================
+// packageLogistic - pack a unit into a pallet or a pallet into a container.
+// An empty parentID unpacks the unit.
+// args: logisticsUnitID, parentID
+// ===========================================================================
+func (t *SupplyChainChaincode) packageLogistic(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID and parentID")
+	}
+	logisticsUnitID := args[0]
+	parentID := args[1]
+	fmt.Println("- start packageLogistic ", logisticsUnitID, parentID)
+
+	unit, err := getLogisticsUnit(stub, logisticsUnitID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(parentID) > 0 {
+		parent, err := getLogisticsUnit(stub, parentID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkPackaging(unit, parent, func(logisticsUnitID string) (LogisticsUnit, error) {
+			return getLogisticsUnit(stub, logisticsUnitID)
+		})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// ==== Move the parent~child index entry ====
+	if len(unit.ParentID) > 0 {
+		oldIndexKey, err := stub.CreateCompositeKey(parentChildIndex, []string{unit.ParentID, logisticsUnitID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.DelState(oldIndexKey); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if len(parentID) > 0 {
+		indexKey, err := stub.CreateCompositeKey(parentChildIndex, []string{parentID, logisticsUnitID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	oldParentID := unit.ParentID
+	unit.ParentID = parentID
+	unitAsBytes, err := putLogisticsUnit(stub, unit)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, LogisticsUnitPackaged, logisticsUnitID, oldParentID, parentID); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end packageLogistic")
+	return shim.Success(unitAsBytes)
+}
+
+// ===========================================================================
+// moveLogisticUnit - set the location of a unit and everything packed inside it
+// args: logisticsUnitID, location JSON
+// ===========================================================================
+func (t *SupplyChainChaincode) moveLogisticUnit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID and location JSON")
+	}
+	var location Location
+	err := decodeInput("location", args[1], &location)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = validateLocation(location); err != nil {
+		return shim.Error(err.Error())
+	}
+	unit, err := getLogisticsUnit(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = updateLogisticsUnitTree(stub, args[0], func(unit *LogisticsUnit) error {
+		unit.Location = location
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, LogisticsUnitMoved, args[0], unit.Location.LocationID, location.LocationID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ===========================================================================
+// updateLogisticUnitState - set the state of a unit and everything packed inside it,
+// each unit moving along the purchase order transition table
+// args: logisticsUnitID, state (name or number)
+// ===========================================================================
+func (t *SupplyChainChaincode) updateLogisticUnitState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID and state")
+	}
+	state, err := parsePurchaseOrderState(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	unit, err := getLogisticsUnit(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !unit.LogisticsState.canTransition(state) {
+		return shim.Error("Illegal logistics unit state transition for " + args[0] + ": " + unit.LogisticsState.String() + " -> " + state.String())
+	}
+	// ==== Every unit of the tree follows the purchase order transition table, a unit already there is left as is ====
+	err = updateLogisticsUnitTree(stub, args[0], func(unit *LogisticsUnit) error {
+		if unit.LogisticsState == state {
+			return nil
+		}
+		if !unit.LogisticsState.canTransition(state) {
+			return fmt.Errorf("Illegal logistics unit state transition for %s: %s -> %s", unit.LogisticsUnitID, unit.LogisticsState.String(), state.String())
+		}
+		unit.LogisticsState = state
+		return nil
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, LogisticsUnitStateChanged, args[0], unit.LogisticsState.String(), state.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// ===========================================================================
+// getLogisticUnitTree - a unit with its full packaging tree and rolled-up totals,
+// the total price only for the members of the pricing collections of the tree
+// ===========================================================================
+func (t *SupplyChainChaincode) getLogisticUnitTree(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting logisticsUnitID")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tree, err := buildLogisticsUnitTree(stub, args[0], mspID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	treeAsBytes, err := json.Marshal(tree)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(treeAsBytes)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckPackaging(t *testing.T) {
+	// ==== a ledger with one container holding a pallet, plus legacy records packed the wrong way round ====
+	units := map[string]LogisticsUnit{
+		"unit01":       {LogisticsUnitID: "unit01", Type: unitType},
+		"pallet01":     {LogisticsUnitID: "pallet01", Type: palletType, ParentID: "container01"},
+		"container01":  {LogisticsUnitID: "container01", Type: containerType},
+		"container02":  {LogisticsUnitID: "container02", Type: containerType, ParentID: "legacy01"},
+		"legacy01":     {LogisticsUnitID: "legacy01", Type: palletType, ParentID: "legacyRoot01"},
+		"legacyRoot01": {LogisticsUnitID: "legacyRoot01", Type: containerType, ParentID: "missing01"},
+	}
+	getUnit := func(logisticsUnitID string) (LogisticsUnit, error) {
+		unit, found := units[logisticsUnitID]
+		if !found {
+			return LogisticsUnit{}, fmt.Errorf("logistics unit %s does not exist", logisticsUnitID)
+		}
+		return unit, nil
+	}
+	tests := []struct {
+		name     string
+		unitID   string
+		parentID string
+		wantErr  string
+	}{
+		{"unit into pallet", "unit01", "pallet01", ""},
+		{"unit into container", "unit01", "container01", ""},
+		{"pallet into container", "pallet01", "container01", ""},
+		{"pallet into unit", "pallet01", "unit01", "cannot be packed"},
+		{"container into pallet", "container01", "pallet01", "cannot be packed"},
+		{"pallet into pallet", "legacy01", "pallet01", "cannot be packed"},
+		{"container into itself", "container01", "container01", "cannot be packed"},
+		{"pallet into a container it holds", "legacy01", "container02", "cycle"},
+		{"unreadable ancestor", "unit01", "legacyRoot01", "does not exist"},
+	}
+	for _, tt := range tests {
+		parent, _ := getUnit(tt.parentID)
+		err := checkPackaging(units[tt.unitID], parent, getUnit)
+		switch {
+		case len(tt.wantErr) <= 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case len(tt.wantErr) > 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLogisticsUnitTreeTotalPrice(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	unit := `{"logisticsUnitID":%q,"type":%q,"location":{"latitude":"48.8566","longitude":"2.3522","address":"paris"}}`
+	s.mustInvoke(sellerUser, "createLogisticUnit", fmt.Sprintf(unit, "container01", "container"))
+	s.mustInvokeTransient(sellerUser, pricingTransient(100.25, "salt01"), "createLogisticUnit", fmt.Sprintf(unit, "pallet01", "pallet"))
+	s.mustInvokeTransient(sellerUser, pricingTransient(50, "salt02"), "createLogisticUnit", fmt.Sprintf(unit, "pallet02", "pallet"))
+	s.mustInvoke(sellerUser, "packageLogistic", "pallet01", "container01")
+	s.mustInvoke(sellerUser, "packageLogistic", "pallet02", "container01")
+
+	// ==== The private prices are rolled up for the seller's MSP only ====
+	tests := []struct {
+		by        identity
+		disclosed bool
+	}{
+		{sellerUser, true},
+		{driverUser, false},
+	}
+	for _, tt := range tests {
+		var tree LogisticsUnitTree
+		if err := json.Unmarshal(s.mustInvoke(tt.by, "getLogisticUnitTree", "container01"), &tree); err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Children) != 2 {
+			t.Errorf("tree read by %s has %d children, want 2", tt.by.MSPID, len(tree.Children))
+		}
+		if !tt.disclosed && tree.TotalPrice != nil {
+			t.Errorf("tree read by %s has total price %.2f, want none", tt.by.MSPID, *tree.TotalPrice)
+		} else if tt.disclosed && (tree.TotalPrice == nil || *tree.TotalPrice != 150.25) {
+			t.Errorf("tree read by %s has total price %v, want 150.25", tt.by.MSPID, tree.TotalPrice)
+		}
+	}
+}
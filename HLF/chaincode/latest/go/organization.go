@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// uniqueness indexes of the organization registry, each maps to the organizationID
+const (
+	organizationNameIndex = "organization~name"
+	organizationMSPIndex  = "organization~mspID"
+)
+
+// normalizeOrganizationName is the form used by the name uniqueness index
+func normalizeOrganizationName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// getOrganization loads an organization record, failing if it does not exist
+func getOrganization(stub shim.ChaincodeStubInterface, organizationID string) (Organization, error) {
+	var org Organization
+	orgAsBytes, err := getObjectState(stub, organizationObjectType, organizationID)
+	if err != nil {
+		return org, fmt.Errorf("failed to get organization %s: %s", organizationID, err.Error())
+	} else if orgAsBytes == nil {
+		return org, fmt.Errorf("organization does not exist: %s", organizationID)
+	}
+	err = json.Unmarshal(orgAsBytes, &org)
+	return org, err
+}
+
+// putOrganization writes an organization record
+func putOrganization(stub shim.ChaincodeStubInterface, org Organization) ([]byte, error) {
+	orgAsBytes, err := json.Marshal(org)
+	if err != nil {
+		return nil, err
+	}
+	return orgAsBytes, putObjectState(stub, organizationObjectType, org.OrganizationID, orgAsBytes)
+}
+
+// lookupOrganizationIndex returns the organizationID stored under a uniqueness index, empty if unclaimed
+func lookupOrganizationIndex(stub shim.ChaincodeStubInterface, index, value string) (string, error) {
+	indexKey, err := stub.CreateCompositeKey(index, []string{value})
+	if err != nil {
+		return "", err
+	}
+	organizationIDAsBytes, err := stub.GetState(indexKey)
+	return string(organizationIDAsBytes), err
+}
+
+// claimOrganizationIndex binds a unique value to an organization, failing if another organization holds it
+func claimOrganizationIndex(stub shim.ChaincodeStubInterface, index, value, organizationID string) error {
+	holder, err := lookupOrganizationIndex(stub, index, value)
+	if err != nil {
+		return err
+	}
+	if len(holder) > 0 && holder != organizationID {
+		return fmt.Errorf("%s is already registered to organization %s", value, holder)
+	}
+	indexKey, err := stub.CreateCompositeKey(index, []string{value})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte(organizationID))
+}
+
+// releaseOrganizationIndex removes a uniqueness index entry
+func releaseOrganizationIndex(stub shim.ChaincodeStubInterface, index, value string) error {
+	indexKey, err := stub.CreateCompositeKey(index, []string{value})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+// getOrganizationByMSP resolves the organization bound to a Fabric MSP ID
+func getOrganizationByMSP(stub shim.ChaincodeStubInterface, mspID string) (Organization, error) {
+	organizationID, err := lookupOrganizationIndex(stub, organizationMSPIndex, mspID)
+	if err != nil {
+		return Organization{}, err
+	} else if len(organizationID) <= 0 {
+		return Organization{}, fmt.Errorf("no organization registered for MSP %s", mspID)
+	}
+	return getOrganization(stub, organizationID)
+}
+
+// getOwnOrganization loads an organization the caller is allowed to maintain,
+// the network admin maintains every organization, MSP admins those of their MSP
+func getOwnOrganization(stub shim.ChaincodeStubInterface, organizationID string) (Organization, error) {
+	org, err := getOrganization(stub, organizationID)
+	if err != nil {
+		return org, err
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return org, err
+	}
+	if !c.canMaintainMSP(org.MSPID) {
+		return org, fmt.Errorf("organization %s can only be maintained by the network admin or an admin of MSP %s", organizationID, org.MSPID)
+	}
+	return org, nil
+}
+
+// checkOrganizationMaintainer checks that the caller may maintain the records bound to an organization,
+// the carriers and customers its participants operate. The network admin maintains them all.
+func checkOrganizationMaintainer(stub shim.ChaincodeStubInterface, function, organizationID string) (*accessDenied, error) {
+	c, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	if c.Admin {
+		return nil, nil
+	}
+	if c.Participant == nil || len(organizationID) <= 0 || c.Participant.Organization.OrganizationID != organizationID {
+		return newAccessDenied(c, function, "only the network admin or a participant of organization "+organizationID+" can maintain its records"), nil
+	}
+	return nil, nil
+}
+
+// bindOrganization checks the organization a new carrier or customer is bound to:
+// it must be active and the caller must maintain it
+func bindOrganization(stub shim.ChaincodeStubInterface, function, organizationID string) (*accessDenied, error) {
+	if len(organizationID) <= 0 {
+		return nil, fmt.Errorf("organizationID must be a non-empty string")
+	}
+	org, err := getOrganization(stub, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if !org.Active {
+		return nil, fmt.Errorf("organization is deactivated: %s", organizationID)
+	}
+	return checkOrganizationMaintainer(stub, function, organizationID)
+}
+
+// ============================================================
+// getOrganizationbyName - look up an organization by its unique name
+// ============================================================
+func (t *SupplyChainChaincode) getOrganizationbyName(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organization name")
+	}
+	organizationID, err := lookupOrganizationIndex(stub, organizationNameIndex, normalizeOrganizationName(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(organizationID) <= 0 {
+		return shim.Error("{\"Error\":\"organization does not exist: " + args[0] + "\"}")
+	}
+	orgAsBytes, err := getObjectState(stub, organizationObjectType, organizationID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(orgAsBytes)
+}
+
+// ============================================================
+// updateOrganization - rename an organization, keeping its ID and MSP binding
+// args: organizationID, organization JSON {name}. The MSP binding is fixed at registration.
+// ============================================================
+func (t *SupplyChainChaincode) updateOrganization(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID and organization JSON")
+	}
+	var update Organization
+	if err := decodeInput("organization", args[1], &update); err != nil {
+		return shim.Error(err.Error())
+	}
+	update.Name = strings.TrimSpace(update.Name)
+	if len(update.Name) <= 0 {
+		return shim.Error("name must be a non-empty string")
+	}
+
+	org, err := getOwnOrganization(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !org.Active {
+		return shim.Error("organization is deactivated: " + org.OrganizationID)
+	}
+
+	oldName := normalizeOrganizationName(org.Name)
+	newName := normalizeOrganizationName(update.Name)
+	if oldName != newName {
+		if err = claimOrganizationIndex(stub, organizationNameIndex, newName, org.OrganizationID); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = releaseOrganizationIndex(stub, organizationNameIndex, oldName); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	oldOrgName := org.Name
+	org.Name = update.Name
+	org.Tx = stub.GetTxID()
+
+	orgAsBytes, err := putOrganization(stub, org)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, OrganizationUpdated, org.OrganizationID, oldOrgName, org.Name); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(orgAsBytes)
+}
+
+// ============================================================
+// deactivateOrganization - mark an organization inactive, keeping its record and name
+// ============================================================
+func (t *SupplyChainChaincode) deactivateOrganization(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID")
+	}
+	org, err := getOwnOrganization(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !org.Active {
+		return shim.Error("organization is already deactivated: " + org.OrganizationID)
+	}
+	org.Active = false
+	org.Tx = stub.GetTxID()
+
+	orgAsBytes, err := putOrganization(stub, org)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, OrganizationDeactivated, org.OrganizationID, activeState(true), activeState(false)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(orgAsBytes)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOrganizationsOfTwoMSPs(t *testing.T) {
+	s := newTestStub(t, networkAdmin.MSPID, networkAdmin.EnrollmentID)
+
+	// ==== Only the network admin registers organizations, for any MSP ====
+	s.mustDeny(org2Admin, "createOrganization", `{"name":"Org2","mspID":"Org2MSP"}`)
+	sellerOrg := s.mustCreateOrganization(networkAdmin, "Org1", "Org1MSP")
+	buyerOrg := s.mustCreateOrganization(networkAdmin, "Org2", "Org2MSP")
+
+	// ==== Participants are registered by the network admin or an admin of their own MSP ====
+	s.mustCreateParticipant(networkAdmin, "seller01", sellerOrg, seller, sellerUser)
+	s.mustCreateParticipant(org2Admin, "buyer01", buyerOrg, customer, buyerUser)
+	s.mustFail(org2Admin, "can only be maintained", "createParticipantUser",
+		`{"participantID":"seller02","name":"seller02","organization":{"organizationID":"`+sellerOrg+`"},"role":"seller","mspID":"Org1MSP","enrollmentID":"User2@org1.example.com"}`)
+	s.mustFail(org2Admin, "can only be maintained", "updateOrganization", sellerOrg, `{"name":"Org1 renamed"}`)
+	s.mustInvoke(org2Admin, "updateOrganization", buyerOrg, `{"name":"Org2 Buyers"}`)
+	s.mustFail(org2Admin, "can only be maintained", "assignSecurityRole", "seller01", "customer")
+	s.mustDeny(buyerUser, "createParticipantUser",
+		`{"participantID":"buyer02","name":"buyer02","organization":{"organizationID":"`+buyerOrg+`"},"role":"customer","mspID":"Org2MSP","enrollmentID":"User2@org2.example.com"}`)
+
+	// ==== A purchase order between the two MSPs ====
+	s.mustInvoke(networkAdmin, "createCarrier", `{"carrierID":"carrier01","organizationID":"`+sellerOrg+`","name":"Carrier","scac":"CARR","modes":["road"]}`)
+	s.mustInvoke(networkAdmin, "createCustomer", `{"customerID":"customer01","organizationID":"`+buyerOrg+`","name":"Customer","billingAddress":{"address":"paris","city":"Paris","country":"FR"},"shippingAddresses":[{"address":"paris","city":"Paris","country":"FR","dock":"ns"}]}`)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", `{"purchaseOrder":{"purchaseOrderID":"purchase01","seller":{"participantID":"seller01"},"buyer":{"participantID":"buyer01"}},"customerID":{"customerID":"customer01"},"carrier":{"carrierID":"carrier01"},"location":{"latitude":"48.8566","longitude":"2.3522","address":"paris","dock":"ns"},"expectedDepartureDate":"2019-03-02T08:00:00Z","expectedArrivedDate":"2019-03-03T08:00:00Z"}`)
+	s.mustDeny(buyerUser, "validatePurchaseOrder", "purchase01")
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+
+	var purchaseOrder PurchaseOrder
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "readPurchaseOrder", "purchase01"), &purchaseOrder); err != nil {
+		t.Fatal(err)
+	}
+	if purchaseOrder.State != Validated {
+		t.Errorf("purchase order state = %s, want %s", purchaseOrder.State, Validated)
+	}
+	if event := s.lastEvent(); event.EventType != PurchaseOrderStateChanged || event.ActorMSP != "Org1MSP" {
+		t.Errorf("last event = %+v, want %s by Org1MSP", event, PurchaseOrderStateChanged)
+	}
+}
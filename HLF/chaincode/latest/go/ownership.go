@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Ownership is one period of the ownership list of a shipment: the participant responsible
+// for it and the carrier moving it, from the transaction that made the transfer
+type Ownership struct {
+	OwnerID   string    `json:"ownerID"`
+	CarrierID string    `json:"carrierID"`
+	From      time.Time `json:"from"`
+	TxID      string    `json:"txID"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// String names the owner and carrier of a period in events
+func (o Ownership) String() string {
+	return o.OwnerID + "/" + o.CarrierID
+}
+
+// ShipmentTransfer is the transferShipment payload, empty fields are left unchanged
+type ShipmentTransfer struct {
+	OwnerID   string `json:"ownerID"`
+	CarrierID string `json:"carrierID"`
+	Comment   string `json:"comment"`
+}
+
+// newOwnership opens an ownership period at the current transaction
+func newOwnership(stub shim.ChaincodeStubInterface, ownerID, carrierID, comment string) (Ownership, error) {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return Ownership{}, err
+	}
+	return Ownership{OwnerID: ownerID, CarrierID: carrierID, From: txTime, TxID: stub.GetTxID(), Comment: comment}, nil
+}
+
+// shipmentOwners is the ownership list of a shipment, oldest first. Shipments created before
+// ownership was tracked start with the seller of their purchase order and their carrier.
+func shipmentOwners(shipment Shipment) []Ownership {
+	if len(shipment.Owners) > 0 {
+		return shipment.Owners
+	}
+	return []Ownership{{OwnerID: shipment.PurchaseOrder.Seller.ParticipantID, CarrierID: shipment.Carrier.CarrierID}}
+}
+
+// currentOwner is the latest period of the ownership list
+func currentOwner(shipment Shipment) Ownership {
+	owners := shipmentOwners(shipment)
+	return owners[len(owners)-1]
+}
+
+// isCallerOrganization reports whether the caller is a participant of one of the organizations
+func isCallerOrganization(c caller, organizationIDs ...string) bool {
+	if c.Participant == nil {
+		return false
+	}
+	for _, organizationID := range organizationIDs {
+		if len(organizationID) > 0 && organizationID == c.Participant.Organization.OrganizationID {
+			return true
+		}
+	}
+	return false
+}
+
+// custodianOrganizationIDs are the organizations holding a shipment on its way:
+// the one of its current owner and the one operating its current carrier
+func custodianOrganizationIDs(stub shim.ChaincodeStubInterface, shipment Shipment) ([]string, error) {
+	owner := currentOwner(shipment)
+	ownerOrganizationID, err := participantOrganizationID(stub, owner.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	carrierOrganizationID, err := carrierOrganizationID(stub, owner.CarrierID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ownerOrganizationID, carrierOrganizationID}, nil
+}
+
+// recipientOrganizationIDs are the organizations a shipment is delivered to:
+// the one of the buyer of its purchase order and the one receiving for its customer
+func recipientOrganizationIDs(stub shim.ChaincodeStubInterface, shipment Shipment) ([]string, error) {
+	purchaseOrder, err := getPurchaseOrder(stub, shipment.PurchaseOrder.PurchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	buyerOrganizationID, err := participantOrganizationID(stub, purchaseOrder.Buyer.ParticipantID)
+	if err != nil {
+		return nil, err
+	}
+	customerOrganizationID, err := customerOrganizationID(stub, shipment.Customer.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{buyerOrganizationID, customerOrganizationID}, nil
+}
+
+// ===========================================================================
+// getShipmentOwners - ordered ownership list of a shipment, the current owner last
+// args: shipmentID
+// ===========================================================================
+func (t *SupplyChainChaincode) getShipmentOwners(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	shipment, err := getShipment(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ownersAsBytes, err := json.Marshal(shipmentOwners(shipment))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(ownersAsBytes)
+}
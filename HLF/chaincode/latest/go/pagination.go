@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// constructObjectResponseFromIterator writes the objects of an iterator with startID <= ID < endID
+// as [{"Key", "Record"}], keyed by the object ID. An empty endID means no upper bound.
+// It reports whether the iterator went past endID, in which case there is nothing left to page through.
+// Archived records are left out.
+func constructObjectResponseFromIterator(stub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface, startID, endID string) (*bytes.Buffer, bool, error) {
+	// buffer is a JSON array containing QueryResults
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	_, pastEnd, err := writeObjectRecords(stub, resultsIterator, &buffer, startID, endID, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	buffer.WriteString("]")
+
+	return &buffer, pastEnd, nil
+}
+
+// writeObjectRecords appends the objects of an iterator with startID <= ID < endID to an open
+// JSON array that already holds written records. It returns the number of records it added
+// and whether the iterator went past endID. Archived records are left out.
+func writeObjectRecords(stub shim.ChaincodeStubInterface, resultsIterator shim.StateQueryIteratorInterface, buffer *bytes.Buffer, startID, endID string, written int) (int, bool, error) {
+	added := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return added, false, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return added, false, err
+		}
+		id := compositeKeyParts[0]
+		if id < startID {
+			continue
+		}
+		if len(endID) > 0 && id >= endID {
+			return added, true, nil
+		}
+		// ==== Archived shipments and purchase orders are only reachable by ID ====
+		var record archivable
+		if err = json.Unmarshal(queryResponse.Value, &record); err == nil && record.Archived {
+			continue
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if written+added > 0 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString("{\"Key\":")
+		buffer.WriteString("\"")
+		buffer.WriteString(id)
+		buffer.WriteString("\"")
+
+		buffer.WriteString(", \"Record\":")
+		// Record is a JSON object, so we write as-is
+		buffer.WriteString(string(queryResponse.Value))
+		buffer.WriteString("}")
+		added++
+	}
+	return added, false, nil
+}
+
+// ===========================================================================================
+// addPaginationMetadataToQueryResults wraps the constructed query results with
+// QueryResponseMetadata, which contains the fetched records count and the next bookmark
+// ===========================================================================================
+func addPaginationMetadataToQueryResults(buffer *bytes.Buffer, responseMetadata *pb.QueryResponseMetadata) *bytes.Buffer {
+	var wrapped bytes.Buffer
+	wrapped.WriteString("{\"Records\":")
+	wrapped.Write(buffer.Bytes())
+	wrapped.WriteString(", \"ResponseMetadata\":{\"RecordsCount\":")
+	wrapped.WriteString("\"")
+	wrapped.WriteString(fmt.Sprintf("%v", responseMetadata.FetchedRecordsCount))
+	wrapped.WriteString("\"")
+	wrapped.WriteString(", \"Bookmark\":")
+	wrapped.WriteString("\"")
+	wrapped.WriteString(responseMetadata.Bookmark)
+	wrapped.WriteString("\"}}")
+
+	return &wrapped
+}
+
+// parsePageSize reads a positive page size argument
+func parsePageSize(value string) (int32, error) {
+	pageSize, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || pageSize <= 0 {
+		return 0, fmt.Errorf("page size must be a positive number: %s", value)
+	}
+	return int32(pageSize), nil
+}
+
+// ===========================================================================
+// getShipmentByRangeWithPagination - one page of shipments with startID <= shipmentID < endID.
+// Pass the returned Fabric bookmark to fetch the next page, an empty bookmark starts a new scan
+// and an empty returned bookmark means there is nothing left. Archived shipments are skipped
+// and further state pages are read until the page is full, so RecordsCount is the number of
+// shipments returned.
+// args: startID, endID, pageSize, bookmark
+// ===========================================================================
+func (t *SupplyChainChaincode) getShipmentByRangeWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+	startID := args[0]
+	endID := args[1]
+	pageSize, err := parsePageSize(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bookmark := args[3]
+
+	// buffer is a JSON array containing one page of shipments
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	var written int32
+	for written < pageSize {
+		requested := pageSize - written
+		resultsIterator, responseMetadata, err := stub.GetStateByPartialCompositeKeyWithPagination(shipmentObjectType, []string{}, requested, bookmark)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		added, pastEnd, err := writeObjectRecords(stub, resultsIterator, &buffer, startID, endID, int(written))
+		resultsIterator.Close()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		written += int32(added)
+		bookmark = responseMetadata.Bookmark
+		// ==== Past endID or a short state page, there is nothing left to page through ====
+		if pastEnd || responseMetadata.FetchedRecordsCount < requested {
+			bookmark = ""
+			break
+		}
+	}
+	buffer.WriteString("]")
+
+	responseMetadata := &pb.QueryResponseMetadata{FetchedRecordsCount: written, Bookmark: bookmark}
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(&buffer, responseMetadata)
+
+	fmt.Printf("- getShipmentByRangeWithPagination queryResult:\n%s\n", bufferWithPaginationInfo.String())
+
+	return shim.Success(bufferWithPaginationInfo.Bytes())
+}
+
+// ===========================================================================
+// getHistoryForShipmentWithPagination - one page of the history of a shipment, oldest first.
+// Fabric has no paginated history query, so the bookmark is an offset: the number of entries
+// already returned. Every page re-reads the history up to that offset; entries committed between
+// two calls are appended at the end and do not shift the pages already read.
+// args: shipmentID, pageSize, bookmark
+// ===========================================================================
+func (t *SupplyChainChaincode) getHistoryForShipmentWithPagination(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	shipmentID := args[0]
+	pageSize, err := parsePageSize(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	offset := 0
+	if len(args[2]) > 0 {
+		offset, err = strconv.Atoi(args[2])
+		if err != nil || offset < 0 {
+			return shim.Error("bookmark must be the value returned by the previous page: " + args[2])
+		}
+	}
+
+	shipmentKey, err := stub.CreateCompositeKey(shipmentObjectType, []string{shipmentID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetHistoryForKey(shipmentKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing one page of historic values for the shipment
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+
+	var fetched int32
+	position := 0
+	for resultsIterator.HasNext() && fetched < pageSize {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position++
+		if position <= offset {
+			continue
+		}
+		// Add a comma before array members, suppress it for the first array member
+		if fetched > 0 {
+			buffer.WriteString(",")
+		}
+		writeHistoryRecord(&buffer, response)
+		fetched++
+	}
+	buffer.WriteString("]")
+
+	responseMetadata := &pb.QueryResponseMetadata{FetchedRecordsCount: fetched}
+	if resultsIterator.HasNext() {
+		responseMetadata.Bookmark = strconv.Itoa(position)
+	}
+	bufferWithPaginationInfo := addPaginationMetadataToQueryResults(&buffer, responseMetadata)
+
+	fmt.Printf("- getHistoryForShipmentWithPagination returning:\n%s\n", bufferWithPaginationInfo.String())
+
+	return shim.Success(bufferWithPaginationInfo.Bytes())
+}
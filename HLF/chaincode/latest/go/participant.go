@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// participants are stored under their own composite key namespace and indexed by organization
+const (
+	participantObjectType        = "participant"
+	organizationParticipantIndex = "organization~participant"
+)
+
+// String returns the name of the role
+func (r Role) String() string {
+	names := [...]string{"customer", "seller", "driver", "LogisticArgument", "LogisticManager"}
+	if r < customer || r > LogisticManager {
+		return "Unknown"
+	}
+	return names[r]
+}
+
+// parseRole accepts either the role name or its numeric value
+func parseRole(value string) (Role, error) {
+	for role := customer; role <= LogisticManager; role++ {
+		if role.String() == value {
+			return role, nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < int(customer) || number > int(LogisticManager) {
+		return customer, fmt.Errorf("unknown role: %s", value)
+	}
+	return Role(number), nil
+}
+
+// getParticipant loads a participant from its composite key
+func getParticipant(stub shim.ChaincodeStubInterface, participantID string) (ParticipantUser, error) {
+	var participant ParticipantUser
+	participantKey, err := stub.CreateCompositeKey(participantObjectType, []string{participantID})
+	if err != nil {
+		return participant, err
+	}
+	participantAsBytes, err := stub.GetState(participantKey)
+	if err != nil {
+		return participant, fmt.Errorf("failed to get participant %s: %s", participantID, err.Error())
+	} else if participantAsBytes == nil {
+		return participant, fmt.Errorf("participant does not exist: %s", participantID)
+	}
+	err = json.Unmarshal(participantAsBytes, &participant)
+	return participant, err
+}
+
+// getOwnParticipant loads a participant the caller is allowed to maintain,
+// the network admin maintains every participant, MSP admins those of their MSP
+func getOwnParticipant(stub shim.ChaincodeStubInterface, participantID string) (ParticipantUser, error) {
+	participant, err := getParticipant(stub, participantID)
+	if err != nil {
+		return participant, err
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return participant, err
+	}
+	if !c.canMaintainMSP(participant.MSPID) || !c.canMaintainMSP(participant.Organization.MSPID) {
+		return participant, fmt.Errorf("participant %s can only be maintained by the network admin or an admin of MSP %s", participantID, participant.MSPID)
+	}
+	return participant, nil
+}
+
+// putParticipant writes a participant under its composite key
+func putParticipant(stub shim.ChaincodeStubInterface, participant ParticipantUser) ([]byte, error) {
+	participantKey, err := stub.CreateCompositeKey(participantObjectType, []string{participant.ParticipantID})
+	if err != nil {
+		return nil, err
+	}
+	participantAsBytes, err := json.Marshal(participant)
+	if err != nil {
+		return nil, err
+	}
+	return participantAsBytes, stub.PutState(participantKey, participantAsBytes)
+}
+
+// checkActiveParticipant fails unless a participant and its organization exist and are active
+func checkActiveParticipant(stub shim.ChaincodeStubInterface, participantID, party string) error {
+	if len(participantID) <= 0 {
+		return fmt.Errorf("%s participantID must be a non-empty string", party)
+	}
+	participant, err := getParticipant(stub, participantID)
+	if err != nil {
+		return fmt.Errorf("%s: %s", party, err.Error())
+	}
+	if !participant.Active {
+		return fmt.Errorf("%s is deactivated: %s", party, participantID)
+	}
+	org, err := getOrganization(stub, participant.Organization.OrganizationID)
+	if err != nil {
+		return fmt.Errorf("%s: %s", party, err.Error())
+	}
+	if !org.Active {
+		return fmt.Errorf("organization of the %s is deactivated: %s", party, org.OrganizationID)
+	}
+	return nil
+}
+
+// ===========================================================================
+// createParticipantUser - register a participant within an existing organization the caller maintains
+// args: participant JSON {participantID, name, organization: {organizationID}, role, mspID, enrollmentID}
+// ===========================================================================
+func (t *SupplyChainChaincode) createParticipantUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting participant JSON")
+	}
+	fmt.Println("- start createParticipantUser")
+
+	var participant ParticipantUser
+	err := decodeInput("participant", args[0], &participant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = validateParticipant(participant); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if _, err := getParticipant(stub, participant.ParticipantID); err == nil {
+		return shim.Error("This participantID already exists: " + participant.ParticipantID)
+	}
+	identityKey, err := stub.CreateCompositeKey(identityParticipantIndex, []string{participant.MSPID, participant.EnrollmentID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	boundAsBytes, err := stub.GetState(identityKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if boundAsBytes != nil {
+		return shim.Error("This identity is already bound to participant " + string(boundAsBytes))
+	}
+	org, err := getOwnOrganization(stub, participant.Organization.OrganizationID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !org.Active {
+		return shim.Error("organization is deactivated: " + org.OrganizationID)
+	}
+	if org.MSPID != participant.MSPID {
+		return shim.Error("participant mspID " + participant.MSPID + " does not match organization mspID " + org.MSPID)
+	}
+	participant.Organization = org
+	participant.Active = true
+
+	participantAsBytes, err := putParticipant(stub, participant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Index the participant by organization so it can be listed per organization ====
+	indexKey, err := stub.CreateCompositeKey(organizationParticipantIndex, []string{org.OrganizationID, participant.ParticipantID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Bind the submitter identity to the participant for authorization ====
+	err = stub.PutState(identityKey, []byte(participant.ParticipantID))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end createParticipantUser")
+	if err = emitEvent(stub, ParticipantCreated, participant.ParticipantID, "", participant.Role.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(participantAsBytes)
+}
+
+// ===============================================
+// getParticipantbyID - read a participant from chaincode state
+// ===============================================
+func (t *SupplyChainChaincode) getParticipantbyID(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting participantID")
+	}
+	participant, err := getParticipant(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	participantAsBytes, err := json.Marshal(participant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(participantAsBytes)
+}
+
+// ===============================================
+// listParticipantsByOrganization - all participants of an organization
+// ===============================================
+func (t *SupplyChainChaincode) listParticipantsByOrganization(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID")
+	}
+	organizationID := args[0]
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(organizationParticipantIndex, []string{organizationID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	participants := []ParticipantUser{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		participant, err := getParticipant(stub, compositeKeyParts[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		participants = append(participants, participant)
+	}
+
+	participantsAsBytes, err := json.Marshal(participants)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Printf("- listParticipantsByOrganization queryResult:\n%s\n", string(participantsAsBytes))
+	return shim.Success(participantsAsBytes)
+}
+
+// ===============================================
+// assignSecurityRole - assign or update the role of a participant
+// args: participantID, role (name or number)
+// ===============================================
+func (t *SupplyChainChaincode) assignSecurityRole(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting participantID and role")
+	}
+	role, err := parseRole(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	participant, err := getOwnParticipant(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !participant.Active {
+		return shim.Error("participant is deactivated: " + participant.ParticipantID)
+	}
+	fmt.Println("- assignSecurityRole ", participant.ParticipantID, participant.Role.String(), "->", role.String())
+	oldRole := participant.Role
+	participant.Role = role
+
+	participantAsBytes, err := putParticipant(stub, participant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, ParticipantRoleChanged, participant.ParticipantID, oldRole.String(), role.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(participantAsBytes)
+}
+
+// ===============================================
+// deactivateParticipant - mark a participant inactive, keeping its record
+// ===============================================
+func (t *SupplyChainChaincode) deactivateParticipant(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting participantID")
+	}
+	participant, err := getOwnParticipant(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !participant.Active {
+		return shim.Error("participant is already deactivated: " + participant.ParticipantID)
+	}
+	participant.Active = false
+
+	participantAsBytes, err := putParticipant(stub, participant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = emitEvent(stub, ParticipantDeactivated, participant.ParticipantID, activeState(true), activeState(false)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(participantAsBytes)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// prices never reach the public state. They are read from the transient map, written to the
+// pricing collection of the buyer and seller MSPs and only their hash is kept on the public record.
+const (
+	pricingTransientKey    = "pricing"
+	pricingCollectionStart = "pricing"
+)
+
+// PrivatePrice is the private pricing record of a purchase order or logistics unit.
+// The salt keeps the public hash from being brute forced.
+type PrivatePrice struct {
+	ObjectType string             `json:"docType"`
+	ID         string             `json:"id"`
+	Price      float64            `json:"price"`
+	LinePrices map[string]float64 `json:"linePrices,omitempty"`
+	Salt       string             `json:"salt"`
+}
+
+// pricingCollection is the collection shared by a set of MSPs, see collections_config.json
+func pricingCollection(mspIDs ...string) string {
+	members := map[string]bool{}
+	for _, mspID := range mspIDs {
+		if len(mspID) > 0 {
+			members[mspID] = true
+		}
+	}
+	var names []string
+	for mspID := range members {
+		names = append(names, mspID)
+	}
+	sort.Strings(names)
+	return pricingCollectionStart + "_" + strings.Join(names, "_")
+}
+
+// purchaseOrderCollection is the pricing collection of the buyer and seller of a purchase order
+func purchaseOrderCollection(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder) (string, error) {
+	buyer, err := getParticipant(stub, purchaseOrder.Buyer.ParticipantID)
+	if err != nil {
+		return "", fmt.Errorf("buyer of purchase order %s: %s", purchaseOrder.PurchaseOrderID, err.Error())
+	}
+	seller, err := getParticipant(stub, purchaseOrder.Seller.ParticipantID)
+	if err != nil {
+		return "", fmt.Errorf("seller of purchase order %s: %s", purchaseOrder.PurchaseOrderID, err.Error())
+	}
+	return pricingCollection(buyer.MSPID, seller.MSPID), nil
+}
+
+// logisticsUnitCollection is the pricing collection of the purchase order of a unit,
+// or of the creating organization alone for a unit that is not ordered yet
+func logisticsUnitCollection(stub shim.ChaincodeStubInterface, unit LogisticsUnit) (string, error) {
+	if len(unit.PurchaseOrderID) > 0 {
+		purchaseOrder, err := getPurchaseOrder(stub, unit.PurchaseOrderID)
+		if err != nil {
+			return "", err
+		}
+		return purchaseOrderCollection(stub, purchaseOrder)
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	return pricingCollection(mspID), nil
+}
+
+// isCollectionMember reports whether an MSP is one of the members a pricing collection is named after
+func isCollectionMember(collection, mspID string) bool {
+	return strings.Contains(collection+"_", "_"+mspID+"_")
+}
+
+// hashPrice is the hex SHA-256 of the private pricing record, as kept on the public record
+func hashPrice(price PrivatePrice) (string, error) {
+	return hashPrivateRecord(price)
+}
+
+// hashPrivateRecord is the hex SHA-256 of a private record, as kept on the public record
+func hashPrivateRecord(record interface{}) (string, error) {
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(recordAsBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// derivedSalt salts a record derived from a private price, such as an escrow or a penalty,
+// so its public hash is as hard to brute force as the price. Every endorser derives the same salt.
+func derivedSalt(stub shim.ChaincodeStubInterface, priceSalt string) string {
+	sum := sha256.Sum256([]byte(priceSalt + ":" + stub.GetTxID()))
+	return hex.EncodeToString(sum[:])
+}
+
+// getTransientPrice decodes a pricing entry of the transient map, nil if the client sent none
+func getTransientPrice(stub shim.ChaincodeStubInterface, key string) (*PrivatePrice, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	priceAsBytes, found := transient[key]
+	if !found {
+		return nil, nil
+	}
+	var price PrivatePrice
+	if err = json.Unmarshal(priceAsBytes, &price); err != nil {
+		return nil, fmt.Errorf("failed to decode transient pricing: %s", err.Error())
+	}
+	if len(price.Salt) <= 0 {
+		return nil, fmt.Errorf("transient pricing must carry a salt")
+	}
+	if price.Price < 0 {
+		return nil, fmt.Errorf("price must not be negative")
+	}
+	for lineID, linePrice := range price.LinePrices {
+		if linePrice < 0 {
+			return nil, fmt.Errorf("price of line %s must not be negative", lineID)
+		}
+	}
+	return &price, nil
+}
+
+// putPrivatePrice writes a pricing record to a collection and returns its hash
+func putPrivatePrice(stub shim.ChaincodeStubInterface, collection, objectType, id string, price PrivatePrice) (string, error) {
+	price.ObjectType = objectType
+	price.ID = id
+	return putPrivateRecord(stub, collection, objectType, id, price)
+}
+
+// getPrivatePrice reads a pricing record and checks it against the public hash.
+// Only peers of the collection members hold the record.
+func getPrivatePrice(stub shim.ChaincodeStubInterface, collection, objectType, id, publicHash string) (PrivatePrice, error) {
+	var price PrivatePrice
+	err := getPrivateRecord(stub, collection, objectType, id, publicHash, &price)
+	return price, err
+}
+
+// putPrivateRecord writes a private record keyed by object type and ID to a collection and returns its hash
+func putPrivateRecord(stub shim.ChaincodeStubInterface, collection, objectType, id string, record interface{}) (string, error) {
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	recordKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return "", err
+	}
+	if err = stub.PutPrivateData(collection, recordKey, recordAsBytes); err != nil {
+		return "", err
+	}
+	return hashPrivateRecord(record)
+}
+
+// getPrivateRecord reads a private record into record and checks it against the public hash
+func getPrivateRecord(stub shim.ChaincodeStubInterface, collection, objectType, id, publicHash string, record interface{}) error {
+	recordKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return err
+	}
+	recordAsBytes, err := stub.GetPrivateData(collection, recordKey)
+	if err != nil {
+		return fmt.Errorf("failed to read private data of %s %s: %s", objectType, id, err.Error())
+	} else if recordAsBytes == nil {
+		return fmt.Errorf("private data of %s %s is not available on this peer", objectType, id)
+	}
+	if err = json.Unmarshal(recordAsBytes, record); err != nil {
+		return err
+	}
+	hash, err := hashPrivateRecord(record)
+	if err != nil {
+		return err
+	}
+	if hash != publicHash {
+		return fmt.Errorf("private data of %s %s does not match its public hash", objectType, id)
+	}
+	return nil
+}
+
+// getPurchaseOrderPrice reads the private amount and line prices of a purchase order.
+// A purchase order created without private pricing keeps its public amount.
+func getPurchaseOrderPrice(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder) (PrivatePrice, error) {
+	if len(purchaseOrder.AmountHash) <= 0 {
+		price := PrivatePrice{ID: purchaseOrder.PurchaseOrderID, Price: purchaseOrder.Amount, LinePrices: map[string]float64{}}
+		for _, line := range purchaseOrder.Product {
+			price.LinePrices[line.LogisticsUnitID] += line.Price
+		}
+		return price, nil
+	}
+	return getPrivatePrice(stub, purchaseOrder.PriceCollection, purchaseOrderObjectType, purchaseOrder.PurchaseOrderID, purchaseOrder.AmountHash)
+}
+
+// lookupPricedObject returns the collection and public hash of a priced purchase order or logistics unit
+func lookupPricedObject(stub shim.ChaincodeStubInterface, objectType, id string) (string, string, error) {
+	if objectType == purchaseOrderObjectType {
+		purchaseOrder, err := getPurchaseOrder(stub, id)
+		return purchaseOrder.PriceCollection, purchaseOrder.AmountHash, err
+	} else if objectType == logisticsUnitObjectType {
+		unit, err := getLogisticsUnit(stub, id)
+		return unit.PriceCollection, unit.PriceHash, err
+	}
+	return "", "", fmt.Errorf("objectType must be %s or %s: %s", purchaseOrderObjectType, logisticsUnitObjectType, objectType)
+}
+
+// ===========================================================================
+// readPrivatePrice - the private price of a purchase order or logistics unit,
+// only answered by peers of the buyer and seller organizations
+// args: objectType (purchaseOrder or logisticsUnit), id
+// ===========================================================================
+func (t *SupplyChainChaincode) readPrivatePrice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting objectType and id")
+	}
+	collection, publicHash, err := lookupPricedObject(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(publicHash) <= 0 {
+		return shim.Error(args[0] + " " + args[1] + " has no private price")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isCollectionMember(collection, mspID) {
+		return shim.Error("the price of " + args[1] + " is private to " + collection)
+	}
+	price, err := getPrivatePrice(stub, collection, args[0], args[1], publicHash)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	priceAsBytes, err := json.Marshal(price)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(priceAsBytes)
+}
+
+// ===========================================================================
+// verifyPrivatePrice - check a price disclosed off-chain against the public hash.
+// The price and salt are passed in the transient map under "pricing", so any
+// organization can verify without being a collection member.
+// args: objectType (purchaseOrder or logisticsUnit), id
+// ===========================================================================
+func (t *SupplyChainChaincode) verifyPrivatePrice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting objectType and id")
+	}
+	_, publicHash, err := lookupPricedObject(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(publicHash) <= 0 {
+		return shim.Error(args[0] + " " + args[1] + " has no private price")
+	}
+	claimed, err := getTransientPrice(stub, pricingTransientKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if claimed == nil {
+		return shim.Error("the price to verify must be passed in the transient map under " + pricingTransientKey)
+	}
+	claimed.ObjectType = args[0]
+	claimed.ID = args[1]
+	hash, err := hashPrice(*claimed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	result := map[string]interface{}{
+		"objectType": args[0],
+		"id":         args[1],
+		"verified":   hash == publicHash,
+	}
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultAsBytes)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// purchaseOrderTransitions is the lifecycle of a purchase order, keyed by the current state.
+// Rejected and Paid are terminal. Pending is a backorder waiting for the missing goods.
+var purchaseOrderTransitions = map[PurchaseOrderState][]PurchaseOrderState{
+	AwaitingValidation: {Validated, Rejected},
+	Validated:          {Prepared, Rejected},
+	Prepared:           {Shipped, Rejected},
+	Shipped:            {Delivered, Pending},
+	Pending:            {Shipped, Delivered},
+	Delivered:          {AwaitingPayment},
+	AwaitingPayment:    {Paid},
+}
+
+// purchaseOrderStateParties lists which party of a purchase order moves it into a state:
+// the seller runs the order, the buyer confirms delivery and either side may reject it.
+var purchaseOrderStateParties = map[PurchaseOrderState][]string{
+	Validated:       {"seller"},
+	Prepared:        {"seller"},
+	Shipped:         {"seller"},
+	Pending:         {"seller"},
+	Delivered:       {"buyer"},
+	Rejected:        {"seller", "buyer"},
+	AwaitingPayment: {"seller"},
+	Paid:            {"seller"},
+}
+
+// isPurchaseOrderParty reports whether a participant is a party allowed to move a purchase order into a state
+func isPurchaseOrderParty(purchaseOrder PurchaseOrder, to PurchaseOrderState, participantID string) bool {
+	if len(participantID) <= 0 {
+		return false
+	}
+	for _, party := range purchaseOrderStateParties[to] {
+		if (party == "seller" && participantID == purchaseOrder.Seller.ParticipantID) ||
+			(party == "buyer" && participantID == purchaseOrder.Buyer.ParticipantID) {
+			return true
+		}
+	}
+	return false
+}
+
+// canTransition reports whether a purchase order may move from one state to another
+func (n PurchaseOrderState) canTransition(to PurchaseOrderState) bool {
+	for _, next := range purchaseOrderTransitions[n] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminal reports whether the purchase order lifecycle is over
+func (n PurchaseOrderState) isTerminal() bool {
+	return n == Rejected || n == Paid
+}
+
+// parsePurchaseOrderState accepts either the state name or its numeric value
+func parsePurchaseOrderState(value string) (PurchaseOrderState, error) {
+	for state := AwaitingValidation; state <= AwaitingPayment; state++ {
+		if state.String() == value {
+			return state, nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < int(AwaitingValidation) || number > int(AwaitingPayment) {
+		return AwaitingValidation, fmt.Errorf("unknown purchase order state: %s", value)
+	}
+	return PurchaseOrderState(number), nil
+}
+
+// purchaseOrderShipmentIndex lists the shipments of a purchase order without scanning every shipment
+const purchaseOrderShipmentIndex = "purchaseOrder~shipment"
+
+// putPurchaseOrderShipment indexes a shipment under its purchase order
+func putPurchaseOrderShipment(stub shim.ChaincodeStubInterface, purchaseOrderID, shipmentID string) error {
+	indexKey, err := stub.CreateCompositeKey(purchaseOrderShipmentIndex, []string{purchaseOrderID, shipmentID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte{0x00})
+}
+
+// deletePurchaseOrderShipment removes a shipment from the index of its purchase order
+func deletePurchaseOrderShipment(stub shim.ChaincodeStubInterface, purchaseOrderID, shipmentID string) error {
+	indexKey, err := stub.CreateCompositeKey(purchaseOrderShipmentIndex, []string{purchaseOrderID, shipmentID})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+// getPurchaseOrderShipmentIDs lists the IDs of the stored shipments of a purchase order, archived or not
+func getPurchaseOrderShipmentIDs(stub shim.ChaincodeStubInterface, purchaseOrderID string) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(purchaseOrderShipmentIndex, []string{purchaseOrderID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var shipmentIDs []string
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		shipmentIDs = append(shipmentIDs, compositeKeyParts[1])
+	}
+	return shipmentIDs, nil
+}
+
+// indexPurchaseOrderShipments indexes every stored shipment under its purchase order,
+// once at upgrade, for shipments created before the index existed
+func indexPurchaseOrderShipments(stub shim.ChaincodeStubInterface) error {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(shipmentObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		var shipment Shipment
+		if err = json.Unmarshal(responseRange.Value, &shipment); err != nil {
+			return err
+		}
+		if len(shipment.PurchaseOrder.PurchaseOrderID) <= 0 {
+			continue
+		}
+		if err = putPurchaseOrderShipment(stub, shipment.PurchaseOrder.PurchaseOrderID, shipment.ShipmentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPurchaseOrder loads a purchase order record
+func getPurchaseOrder(stub shim.ChaincodeStubInterface, purchaseOrderID string) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	purchaseOrderAsBytes, err := getObjectState(stub, purchaseOrderObjectType, purchaseOrderID)
+	if err != nil {
+		return purchaseOrder, fmt.Errorf("failed to get purchase order %s: %s", purchaseOrderID, err.Error())
+	} else if purchaseOrderAsBytes == nil {
+		return purchaseOrder, fmt.Errorf("purchase order does not exist: %s", purchaseOrderID)
+	}
+	err = json.Unmarshal(purchaseOrderAsBytes, &purchaseOrder)
+	return purchaseOrder, err
+}
+
+// shipPurchaseOrder moves the purchase order of a shipment leaving for the buyer to Shipped.
+// A validated order passes through Prepared, an order already shipped or past it is left alone.
+func shipPurchaseOrder(stub shim.ChaincodeStubInterface, purchaseOrderID, shipmentID string) error {
+	if len(purchaseOrderID) <= 0 {
+		return nil
+	}
+	purchaseOrder, err := getPurchaseOrder(stub, purchaseOrderID)
+	if err != nil {
+		return err
+	}
+	path := []PurchaseOrderState{Shipped}
+	if purchaseOrder.State == Validated {
+		path = []PurchaseOrderState{Prepared, Shipped}
+	} else if !purchaseOrder.State.canTransition(Shipped) {
+		return nil
+	}
+	for _, to := range path {
+		transition, err := newStateTransition(stub, purchaseOrder.State, to, "shipment "+shipmentID+" in transit")
+		if err != nil {
+			return err
+		}
+		purchaseOrder.State = to
+		purchaseOrder.History = append(purchaseOrder.History, transition)
+	}
+	_, err = putPurchaseOrder(stub, purchaseOrder)
+	return err
+}
+
+// putPurchaseOrder writes a purchase order record. Archived purchase orders are read-only,
+// only archivePurchaseOrder writes them.
+func putPurchaseOrder(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder) ([]byte, error) {
+	if purchaseOrder.Archived {
+		return nil, fmt.Errorf("purchase order %s is archived and read-only", purchaseOrder.PurchaseOrderID)
+	}
+	purchaseOrderAsBytes, err := json.Marshal(purchaseOrder)
+	if err != nil {
+		return nil, err
+	}
+	return purchaseOrderAsBytes, putObjectState(stub, purchaseOrderObjectType, purchaseOrder.PurchaseOrderID, purchaseOrderAsBytes)
+}
+
+// ===============================================
+// readPurchaseOrder - read a purchase order from chaincode state
+// ===============================================
+func (t *SupplyChainChaincode) readPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID of the purchase order to query")
+	}
+
+	purchaseOrderID := args[0]
+	purchaseOrderAsBytes, err := getObjectState(stub, purchaseOrderObjectType, purchaseOrderID)
+	if err != nil {
+		return shim.Error("{\"Error\":\"Failed to get state for " + purchaseOrderID + "\"}")
+	} else if purchaseOrderAsBytes == nil {
+		return shim.Error("{\"Error\":\"purchase order does not exist: " + purchaseOrderID + "\"}")
+	}
+	return shim.Success(purchaseOrderAsBytes)
+}
+
+// ===========================================================================
+// movePurchaseOrder - move a purchase order to the given state if the
+// transition table allows it and the caller is the party of the order the
+// state requires, recording the submitter and tx timestamp.
+// Validated locks the order amount in escrow, Rejected refunds it.
+// args: purchaseOrderID [, comment]
+// ===========================================================================
+func (t *SupplyChainChaincode) movePurchaseOrder(stub shim.ChaincodeStubInterface, args []string, to PurchaseOrderState) pb.Response {
+	if len(args) < 1 || len(args[0]) <= 0 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	purchaseOrderID := args[0]
+	comment := ""
+	if len(args) > 1 {
+		comment = args[1]
+	}
+	fmt.Println("- start movePurchaseOrder ", purchaseOrderID, to)
+
+	purchaseOrderAsBytes, err := getObjectState(stub, purchaseOrderObjectType, purchaseOrderID)
+	if err != nil {
+		return shim.Error("Failed to get purchaseOrderID: " + err.Error())
+	} else if purchaseOrderAsBytes == nil {
+		return shim.Error("purchaseOrderID does not exist: " + purchaseOrderID)
+	}
+
+	var purchaseOrder PurchaseOrder
+	err = json.Unmarshal(purchaseOrderAsBytes, &purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if purchaseOrder.Archived {
+		return shim.Error("purchase order " + purchaseOrderID + " is archived and read-only")
+	}
+
+	from := purchaseOrder.State
+	if !from.canTransition(to) {
+		return shim.Error("Illegal purchase order state transition for " + purchaseOrderID + ": " + from.String() + " -> " + to.String())
+	}
+
+	// ==== The role check only says what kind of participant called, the order names who may move it ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if c.Participant == nil || !isPurchaseOrderParty(purchaseOrder, to, c.Participant.ParticipantID) {
+		function, _ := stub.GetFunctionAndParameters()
+		return denyAccess(stub, newAccessDenied(c, function, "only the "+strings.Join(purchaseOrderStateParties[to], " or ")+" of purchase order "+purchaseOrderID+" can move it to "+to.String()))
+	}
+
+	transition, err := newStateTransition(stub, from, to, comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	purchaseOrder.State = to
+	purchaseOrder.History = append(purchaseOrder.History, transition)
+
+	purchaseOrderJSONasBytes, err := putPurchaseOrder(stub, purchaseOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Validation locks the buyer's funds, rejection hands them back ====
+	if to == Validated {
+		err = lockEscrow(stub, purchaseOrder)
+	} else if to == Rejected {
+		err = settleEscrow(stub, purchaseOrderID, 0, escrowRefunded, comment)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end movePurchaseOrder (success) ", from.String(), "->", to.String())
+	if err = emitEvent(stub, PurchaseOrderStateChanged, purchaseOrderID, from.String(), to.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(purchaseOrderJSONasBytes)
+}
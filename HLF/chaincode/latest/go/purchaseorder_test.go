@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPurchaseOrderCanTransition(t *testing.T) {
+	tests := []struct {
+		from PurchaseOrderState
+		to   PurchaseOrderState
+		want bool
+	}{
+		{AwaitingValidation, Validated, true},
+		{AwaitingValidation, Rejected, true},
+		{AwaitingValidation, Shipped, false},
+		{Validated, Prepared, true},
+		{Validated, Shipped, false},
+		{Prepared, Shipped, true},
+		{Shipped, Delivered, true},
+		{Shipped, Pending, true},
+		{Shipped, Rejected, false},
+		{Pending, Shipped, true},
+		{Delivered, AwaitingPayment, true},
+		{Delivered, Paid, false},
+		{AwaitingPayment, Paid, true},
+		{Paid, AwaitingPayment, false},
+		{Rejected, Validated, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.canTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: canTransition = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestPurchaseOrderIsTerminal(t *testing.T) {
+	for state := AwaitingValidation; state <= AwaitingPayment; state++ {
+		want := state == Rejected || state == Paid
+		if got := state.isTerminal(); got != want {
+			t.Errorf("%s: isTerminal = %v, want %v", state, got, want)
+		}
+		if want && len(purchaseOrderTransitions[state]) > 0 {
+			t.Errorf("%s is terminal but has transitions %v", state, purchaseOrderTransitions[state])
+		}
+	}
+}
+
+func TestParsePurchaseOrderState(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    PurchaseOrderState
+		wantErr bool
+	}{
+		{"Validated", Validated, false},
+		{"AwaitingPayment", AwaitingPayment, false},
+		{"3", Shipped, false},
+		{"0", AwaitingValidation, false},
+		{"9", AwaitingValidation, true},
+		{"-1", AwaitingValidation, true},
+		{"shipped", AwaitingValidation, true},
+		{"", AwaitingValidation, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePurchaseOrderState(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePurchaseOrderState(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePurchaseOrderState(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsPurchaseOrderParty(t *testing.T) {
+	purchaseOrder := PurchaseOrder{
+		Seller: ParticipantUser{ParticipantID: "seller01"},
+		Buyer:  ParticipantUser{ParticipantID: "buyer01"},
+	}
+	tests := []struct {
+		name          string
+		to            PurchaseOrderState
+		participantID string
+		want          bool
+	}{
+		{"seller validates", Validated, "seller01", true},
+		{"buyer cannot validate", Validated, "buyer01", false},
+		{"seller ships", Shipped, "seller01", true},
+		{"buyer confirms delivery", Delivered, "buyer01", true},
+		{"seller cannot confirm delivery", Delivered, "seller01", false},
+		{"seller rejects", Rejected, "seller01", true},
+		{"buyer rejects", Rejected, "buyer01", true},
+		{"outsider rejects", Rejected, "carrier01", false},
+		{"empty participant", Rejected, "", false},
+		{"no party for the initial state", AwaitingValidation, "seller01", false},
+	}
+	for _, tt := range tests {
+		if got := isPurchaseOrderParty(purchaseOrder, tt.to, tt.participantID); got != tt.want {
+			t.Errorf("%s: isPurchaseOrderParty = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPurchaseOrderLifecycle(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(networkAdmin, "depositFunds", network.buyerOrg, "5000")
+	s.mustInvokeTransient(sellerUser, pricingTransient(1000, "salt01"), "createShipment", "shipment01",
+		orderedShipmentPayload("purchase01", `[{"logisticsUnitID":"unit01","quantity":10}]`))
+
+	// ==== The seller validates the order and locks the buyer's funds in escrow ====
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+	if event := s.lastEvent(); event.EventType != PurchaseOrderStateChanged || event.NewState != Validated.String() {
+		t.Errorf("last event = %+v, want %s to %s", event, PurchaseOrderStateChanged, Validated)
+	}
+
+	// ==== Moving the shipment in transit ships the order ====
+	s.mustInvoke(sellerUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "loaded")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustInvoke(buyerUser, "updateShipmentState", "shipment01", "deliveredComplete")
+
+	// ==== A complete receipt delivers the order and releases the escrow to the seller ====
+	var report ReconciliationReport
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "recordReceipt", "shipment01", `[{"logisticsUnitID":"unit01","quantity":10}]`), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Complete || report.PurchaseOrderState != Delivered.String() {
+		t.Errorf("reconciliation = %+v, want complete and %s", report, Delivered)
+	}
+	var escrow EscrowDisclosure
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "readEscrow", "purchase01"), &escrow); err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Status != escrowReleased || escrow.Amounts == nil || escrow.Amounts.ReleasedAmount != 1000 {
+		t.Errorf("escrow = %+v, want 1000 released", escrow)
+	}
+
+	// ==== The seller collects the payment ====
+	s.mustInvoke(sellerUser, "requestPayment", "purchase01")
+	s.mustInvoke(sellerUser, "markPaid", "purchase01")
+
+	var purchaseOrder PurchaseOrder
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "readPurchaseOrder", "purchase01"), &purchaseOrder); err != nil {
+		t.Fatal(err)
+	}
+	wantHistory := []struct {
+		to       PurchaseOrderState
+		actorMSP string
+	}{
+		{Validated, "Org1MSP"},
+		{Prepared, "Org3MSP"},
+		{Shipped, "Org3MSP"},
+		{Delivered, "Org2MSP"},
+		{AwaitingPayment, "Org1MSP"},
+		{Paid, "Org1MSP"},
+	}
+	if len(purchaseOrder.History) != len(wantHistory) {
+		t.Fatalf("history = %+v, want %d transitions", purchaseOrder.History, len(wantHistory))
+	}
+	for i, want := range wantHistory {
+		if got := purchaseOrder.History[i]; got.To != want.to.String() || got.ActorMSP != want.actorMSP {
+			t.Errorf("history[%d] = %s by %s, want %s by %s", i, got.To, got.ActorMSP, want.to, want.actorMSP)
+		}
+	}
+
+	balances := []struct {
+		by             identity
+		organizationID string
+		want           float64
+	}{
+		{buyerUser, network.buyerOrg, 4000},
+		{sellerUser, network.sellerOrg, 1000},
+	}
+	for _, tt := range balances {
+		var balance AccountBalance
+		if err := json.Unmarshal(s.mustInvoke(tt.by, "getAccountBalance", tt.organizationID), &balance); err != nil {
+			t.Fatal(err)
+		}
+		if balance.Balance != tt.want || balance.Escrowed != 0 {
+			t.Errorf("balance of %s = %+v, want %.2f", tt.organizationID, balance, tt.want)
+		}
+	}
+}
+
+func TestPurchaseOrderDenyPaths(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(networkAdmin, "depositFunds", network.buyerOrg, "5000")
+	s.mustInvokeTransient(sellerUser, pricingTransient(1000, "salt01"), "createShipment", "shipment01",
+		orderedShipmentPayload("purchase01", `[{"logisticsUnitID":"unit01","quantity":10}]`))
+
+	// ==== Only the seller runs the order and only through its transitions ====
+	s.mustDeny(buyerUser, "validatePurchaseOrder", "purchase01")
+	s.mustDeny(driverUser, "validatePurchaseOrder", "purchase01")
+	s.mustFail(sellerUser, "Illegal purchase order state transition", "markPaid", "purchase01")
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+	s.mustFail(sellerUser, "Illegal purchase order state transition", "validatePurchaseOrder", "purchase01")
+
+	// ==== Nobody receives a shipment that has not arrived ====
+	s.mustFail(buyerUser, "has not been delivered", "recordReceipt", "shipment01", `[{"logisticsUnitID":"unit01","quantity":10}]`)
+	s.mustInvoke(sellerUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "loaded")
+	s.mustDeny(buyerDriverUser, "updateShipmentPosition", "shipment01", `{"latitude":"48.8566","longitude":"2.3522"}`)
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustFail(buyerUser, "Illegal purchase order state transition", "rejectPurchaseOrder", "purchase01")
+	s.mustInvoke(buyerUser, "updateShipmentState", "shipment01", "deliveredComplete")
+
+	// ==== Only the buyer's organization records the receipt, and only a well-formed one ====
+	s.mustDeny(sellerUser, "recordReceipt", "shipment01", `[{"logisticsUnitID":"unit01","quantity":10}]`)
+	s.mustDeny(driverUser, "recordReceipt", "shipment01", `[{"logisticsUnitID":"unit01","quantity":10}]`)
+	s.mustFail(buyerUser, "receivedQuantities", "recordReceipt", "shipment01", `[{"logisticsUnitID":"","quantity":-1}]`)
+	s.mustDeny(sellerUser, "deliverPurchaseOrder", "purchase01")
+
+	// ==== None of the denied calls moved the order or the escrow ====
+	var purchaseOrder PurchaseOrder
+	if err := json.Unmarshal(s.mustInvoke(sellerUser, "readPurchaseOrder", "purchase01"), &purchaseOrder); err != nil {
+		t.Fatal(err)
+	}
+	if purchaseOrder.State != Shipped {
+		t.Errorf("purchase order state = %s, want %s", purchaseOrder.State, Shipped)
+	}
+	var escrow EscrowDisclosure
+	if err := json.Unmarshal(s.mustInvoke(sellerUser, "readEscrow", "purchase01"), &escrow); err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Status != escrowLocked {
+		t.Errorf("escrow status = %s, want %s", escrow.Status, escrowLocked)
+	}
+}
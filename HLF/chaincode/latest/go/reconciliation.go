@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// receipts are keyed by purchase order and shipment, the reconciliation report by purchase order
+const (
+	receiptObjectType        = "receipt"
+	reconciliationObjectType = "reconciliation"
+)
+
+// reconciliation status of one purchase order line
+const (
+	lineComplete   = "complete"
+	lineShort      = "short"
+	lineOver       = "over"
+	lineUnexpected = "unexpected"
+)
+
+// ReceivedQuantity is the quantity of one logistics unit counted by the consignee
+type ReceivedQuantity struct {
+	LogisticsUnitID string `json:"logisticsUnitID"`
+	Quantity        int    `json:"quantity"`
+}
+
+// Receipt is what the consignee counted when a shipment arrived
+type Receipt struct {
+	PurchaseOrderID string             `json:"purchaseOrderID"`
+	ShipmentID      string             `json:"shipmentID"`
+	Lines           []ReceivedQuantity `json:"lines"`
+	ReceivedBy      string             `json:"receivedBy"`
+	TxID            string             `json:"txID"`
+	Timestamp       time.Time          `json:"timestamp"`
+}
+
+// ReconciliationLine compares the ordered and received quantity of one purchase order line
+type ReconciliationLine struct {
+	LogisticsUnitID string `json:"logisticsUnitID"`
+	Ordered         int    `json:"ordered"`
+	Received        int    `json:"received"`
+	Shortage        int    `json:"shortage"`
+	Overage         int    `json:"overage"`
+	Status          string `json:"status"`
+}
+
+// ReconciliationReport is the shortage/overage report of a purchase order over all its receipts
+type ReconciliationReport struct {
+	PurchaseOrderID    string               `json:"purchaseOrderID"`
+	ShipmentIDs        []string             `json:"shipmentIDs"`
+	Lines              []ReconciliationLine `json:"lines"`
+	Complete           bool                 `json:"complete"`
+	PurchaseOrderState string               `json:"purchaseOrderState"`
+	TxID               string               `json:"txID"`
+	Timestamp          time.Time            `json:"timestamp"`
+}
+
+// getReceipts loads every receipt recorded for a purchase order
+func getReceipts(stub shim.ChaincodeStubInterface, purchaseOrderID string) ([]Receipt, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(receiptObjectType, []string{purchaseOrderID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	receipts := []Receipt{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var receipt Receipt
+		if err = json.Unmarshal(responseRange.Value, &receipt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// reconcile compares the ordered lines of a purchase order against everything received.
+// Received units that were never ordered are reported as unexpected.
+func reconcile(purchaseOrder PurchaseOrder, receipts []Receipt) ([]ReconciliationLine, bool) {
+	var order []string
+	ordered := map[string]int{}
+	for _, line := range purchaseOrder.Product {
+		if _, seen := ordered[line.LogisticsUnitID]; !seen {
+			order = append(order, line.LogisticsUnitID)
+		}
+		ordered[line.LogisticsUnitID] += line.Quantity
+	}
+	received := map[string]int{}
+	var unexpected []string
+	for _, receipt := range receipts {
+		for _, line := range receipt.Lines {
+			if _, known := ordered[line.LogisticsUnitID]; !known {
+				if _, seen := received[line.LogisticsUnitID]; !seen {
+					unexpected = append(unexpected, line.LogisticsUnitID)
+				}
+			}
+			received[line.LogisticsUnitID] += line.Quantity
+		}
+	}
+	sort.Strings(unexpected)
+
+	complete := true
+	lines := []ReconciliationLine{}
+	for _, logisticsUnitID := range order {
+		line := ReconciliationLine{
+			LogisticsUnitID: logisticsUnitID,
+			Ordered:         ordered[logisticsUnitID],
+			Received:        received[logisticsUnitID],
+			Status:          lineComplete,
+		}
+		if line.Received < line.Ordered {
+			line.Shortage = line.Ordered - line.Received
+			line.Status = lineShort
+			complete = false
+		} else if line.Received > line.Ordered {
+			line.Overage = line.Received - line.Ordered
+			line.Status = lineOver
+		}
+		lines = append(lines, line)
+	}
+	for _, logisticsUnitID := range unexpected {
+		lines = append(lines, ReconciliationLine{
+			LogisticsUnitID: logisticsUnitID,
+			Received:        received[logisticsUnitID],
+			Overage:         received[logisticsUnitID],
+			Status:          lineUnexpected,
+		})
+	}
+	return lines, complete
+}
+
+// validateReceivedQuantities checks the received quantities payload of recordReceipt
+func validateReceivedQuantities(lines []ReceivedQuantity) error {
+	v := newValidator("receivedQuantities")
+	for i, line := range lines {
+		lineField := fmt.Sprintf("[%d]", i)
+		v.required(lineField+".logisticsUnitID", line.LogisticsUnitID)
+		if line.Quantity < 0 {
+			v.add(lineField+".quantity", "must not be negative")
+		}
+	}
+	return v.err()
+}
+
+// ===========================================================================
+// recordReceipt - the consignee records the quantities received per logistics unit
+// of a delivered shipment. The purchase order is reconciled over all its receipts:
+// a shortage puts it back to Pending as a backorder, a complete order moves to Delivered.
+// Once every shipment of the order is received its escrow is settled from the receipts.
+// args: shipmentID, received quantities JSON [{"logisticsUnitID", "quantity"}]
+// ===========================================================================
+func (t *SupplyChainChaincode) recordReceipt(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and received quantities JSON")
+	}
+	shipmentID := args[0]
+	fmt.Println("- start recordReceipt ", shipmentID)
+
+	var lines []ReceivedQuantity
+	if err := decodeInput("receivedQuantities", args[1], &lines); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateReceivedQuantities(lines); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !shipment.ShipmentOrderState.isDelivered() {
+		return shim.Error("shipment " + shipmentID + " has not been delivered, it is " + shipment.ShipmentOrderState.String())
+	}
+	purchaseOrderID := shipment.PurchaseOrder.PurchaseOrderID
+	purchaseOrder, err := getPurchaseOrder(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Only the buyer organization receives the goods ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	buyer, err := getParticipant(stub, purchaseOrder.Buyer.ParticipantID)
+	if err != nil {
+		return shim.Error("buyer of purchase order " + purchaseOrderID + ": " + err.Error())
+	}
+	if c.MSPID != buyer.MSPID {
+		return denyAccess(stub, newAccessDenied(c, "recordReceipt", "only the buyer organization can receive shipment "+shipmentID))
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receipt := Receipt{
+		PurchaseOrderID: purchaseOrderID,
+		ShipmentID:      shipmentID,
+		Lines:           lines,
+		TxID:            stub.GetTxID(),
+		Timestamp:       txTime,
+	}
+	if c.Participant != nil {
+		receipt.ReceivedBy = c.Participant.ParticipantID
+	}
+	receiptAsBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptKey, err := stub.CreateCompositeKey(receiptObjectType, []string{purchaseOrderID, shipmentID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(receiptKey, receiptAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Reconcile over the stored receipts, replacing an earlier receipt of this shipment ====
+	stored, err := getReceipts(stub, purchaseOrderID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receipts := []Receipt{receipt}
+	shipmentIDs := []string{shipmentID}
+	for _, previous := range stored {
+		if previous.ShipmentID != shipmentID {
+			receipts = append(receipts, previous)
+			shipmentIDs = append(shipmentIDs, previous.ShipmentID)
+		}
+	}
+	sort.Strings(shipmentIDs)
+	reconciled, complete := reconcile(purchaseOrder, receipts)
+
+	from := purchaseOrder.State
+	to := Pending
+	if complete {
+		to = Delivered
+	}
+	if from != to {
+		if !from.canTransition(to) {
+			return shim.Error("Illegal purchase order state transition for " + purchaseOrderID + ": " + from.String() + " -> " + to.String())
+		}
+		transition, err := newStateTransition(stub, from, to, "reconciled receipt of shipment "+shipmentID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		purchaseOrder.State = to
+		purchaseOrder.History = append(purchaseOrder.History, transition)
+		if _, err = putPurchaseOrder(stub, purchaseOrder); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err = settleReceivedEscrow(stub, purchaseOrder, shipmentID, receipts, reconciled, complete); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	report := ReconciliationReport{
+		PurchaseOrderID:    purchaseOrderID,
+		ShipmentIDs:        shipmentIDs,
+		Lines:              reconciled,
+		Complete:           complete,
+		PurchaseOrderState: to.String(),
+		TxID:               stub.GetTxID(),
+		Timestamp:          txTime,
+	}
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putObjectState(stub, reconciliationObjectType, purchaseOrderID, reportAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end recordReceipt ", purchaseOrderID, from.String(), "->", to.String())
+	if err = emitEvent(stub, DeliveryReconciled, purchaseOrderID, from.String(), to.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(reportAsBytes)
+}
+
+// ===========================================================================
+// getReconciliationReport - the latest shortage/overage report of a purchase order
+// ===========================================================================
+func (t *SupplyChainChaincode) getReconciliationReport(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	reportAsBytes, err := getObjectState(stub, reconciliationObjectType, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("no reconciliation report for purchase order: " + args[0])
+	}
+	return shim.Success(reportAsBytes)
+}
+
+// ===========================================================================
+// getReceiptsByPurchaseOrder - every receipt recorded against the shipments of a purchase order
+// ===========================================================================
+func (t *SupplyChainChaincode) getReceiptsByPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	receipts, err := getReceipts(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiptsAsBytes, err := json.Marshal(receipts)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(receiptsAsBytes)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestShortReceiptProratesEscrow(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(networkAdmin, "depositFunds", network.buyerOrg, "5000")
+	pricing := map[string][]byte{pricingTransientKey: []byte(`{"price":1000,"linePrices":{"unit01":600,"unit02":400},"salt":"salt01"}`)}
+	s.mustInvokeTransient(sellerUser, pricing, "createShipment", "shipment01",
+		orderedShipmentPayload("purchase01", `[{"logisticsUnitID":"unit01","quantity":10},{"logisticsUnitID":"unit02","quantity":10}]`))
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+	s.mustInvoke(sellerUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "loaded")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustInvoke(buyerUser, "updateShipmentState", "shipment01", "deliveredIncomplete")
+
+	// ==== Half of unit02 is missing: the order goes back to Pending as a backorder ====
+	var report ReconciliationReport
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "recordReceipt", "shipment01",
+		`[{"logisticsUnitID":"unit01","quantity":10},{"logisticsUnitID":"unit02","quantity":5}]`), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Complete || report.PurchaseOrderState != Pending.String() {
+		t.Errorf("reconciliation = %+v, want incomplete and %s", report, Pending)
+	}
+	if len(report.Lines) != 2 || report.Lines[1].Shortage != 5 || report.Lines[1].Status != lineShort {
+		t.Errorf("reconciliation lines = %+v, want unit02 short by 5", report.Lines)
+	}
+
+	// ==== The escrow pays the received share by line price: 600 + 400 * 5/10 ====
+	var escrow EscrowDisclosure
+	if err := json.Unmarshal(s.mustInvoke(sellerUser, "readEscrow", "purchase01"), &escrow); err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Status != escrowProrated || escrow.Amounts == nil ||
+		escrow.Amounts.ReleasedAmount != 800 || escrow.Amounts.RefundedAmount != 200 {
+		t.Errorf("escrow = %+v, want 800 released and 200 refunded", escrow)
+	}
+
+	balances := []struct {
+		by             identity
+		organizationID string
+		want           float64
+	}{
+		{buyerUser, network.buyerOrg, 4200},
+		{sellerUser, network.sellerOrg, 800},
+	}
+	for _, tt := range balances {
+		var balance AccountBalance
+		if err := json.Unmarshal(s.mustInvoke(tt.by, "getAccountBalance", tt.organizationID), &balance); err != nil {
+			t.Fatal(err)
+		}
+		if balance.Balance != tt.want || balance.Escrowed != 0 {
+			t.Errorf("balance of %s = %+v, want %.2f", tt.organizationID, balance, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// =========================================================================================
+// getQueryResultForQueryString executes the passed in query string.
+// Result set is built and returned as a byte array containing the JSON results.
+// =========================================================================================
+func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
+
+	fmt.Printf("- getQueryResultForQueryString queryString:\n%s\n", queryString)
+
+	resultsIterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing QueryRecords
+	buffer, _, err := constructObjectResponseFromIterator(stub, resultsIterator, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("- getQueryResultForQueryString queryResult:\n%s\n", buffer.String())
+
+	return buffer.Bytes(), nil
+}
+
+// queryShipments runs a CouchDB selector restricted to shipment documents.
+// The selector is marshalled rather than formatted so arguments cannot inject query syntax.
+func queryShipments(stub shim.ChaincodeStubInterface, selector map[string]interface{}) pb.Response {
+	selector["docType"] = shipmentObjectType
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	queryResults, err := getQueryResultForQueryString(stub, string(queryString))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// =====================================================
+// queryShipmentsByCarrier - shipments handled by a carrier
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByCarrier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID")
+	}
+	return queryShipments(stub, map[string]interface{}{"carrier.carrierID": args[0]})
+}
+
+// =====================================================
+// queryShipmentsByCustomer - shipments of a customer
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByCustomer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting customerID")
+	}
+	return queryShipments(stub, map[string]interface{}{"customerID.customerID": args[0]})
+}
+
+// =====================================================
+// queryShipmentsByPurchaseOrder - shipments fulfilling a purchase order
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByPurchaseOrder(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	return queryShipments(stub, map[string]interface{}{"purchaseOrder.purchaseOrderID": args[0]})
+}
+
+// =====================================================
+// queryShipmentsByState - shipments in a ShipmentOrderState (name or number)
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentOrderState")
+	}
+	state, err := parseShipmentOrderState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return queryShipments(stub, map[string]interface{}{"shipmentOrderState": state})
+}
+
+// =====================================================
+// queryShipmentsByDispute - shipments with or without an open dispute
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByDispute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting true or false")
+	}
+	dispute, err := strconv.ParseBool(args[0])
+	if err != nil {
+		return shim.Error("dispute flag must be true or false: " + args[0])
+	}
+	return queryShipments(stub, map[string]interface{}{"dispute": dispute})
+}
+
+// =====================================================
+// queryShipmentsByExpectedArrival - shipments expected to arrive within [from, to], RFC3339 dates
+// =====================================================
+func (t *SupplyChainChaincode) queryShipmentsByExpectedArrival(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting from and to dates")
+	}
+	from, err := time.Parse(time.RFC3339, args[0])
+	if err != nil {
+		return shim.Error("from must be an RFC3339 date: " + err.Error())
+	}
+	to, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("to must be an RFC3339 date: " + err.Error())
+	}
+	// stored dates are UTC at second precision, so the RFC3339 strings compare chronologically
+	return queryShipments(stub, map[string]interface{}{
+		"expectedArrivedDate": map[string]string{
+			"$gte": from.UTC().Truncate(time.Second).Format(time.RFC3339),
+			"$lte": to.UTC().Truncate(time.Second).Format(time.RFC3339),
+		},
+	})
+}
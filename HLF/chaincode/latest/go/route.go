@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// position fixes are keyed by shipment, fix time and tx so trackers never write the same key
+const positionObjectType = "position"
+
+// earthRadiusKm is the mean earth radius used for great-circle distances
+const earthRadiusKm = 6371.0088
+
+// Coordinate is a latitude or longitude in decimal degrees.
+// It is read from a JSON number or a quoted number, as sent by invoke.sh.
+type Coordinate float64
+
+// UnmarshalJSON accepts 48.8566 as well as "48.8566"
+func (c *Coordinate) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	degrees, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate %s", string(data))
+	}
+	*c = Coordinate(degrees)
+	return nil
+}
+
+// PositionFix is one GPS position of a shipment
+type PositionFix struct {
+	ShipmentID string     `json:"shipmentID"`
+	DeviceID   string     `json:"deviceID,omitempty"`
+	Latitude   Coordinate `json:"latitude"`
+	Longitude  Coordinate `json:"longitude"`
+	RecordedAt time.Time  `json:"recordedAt"`
+	TxID       string     `json:"txID"`
+}
+
+// ShipmentRoute is the ordered track of a shipment with the distance between consecutive fixes summed up
+type ShipmentRoute struct {
+	ShipmentID      string        `json:"shipmentID"`
+	Track           []PositionFix `json:"track"`
+	TotalDistanceKm float64       `json:"totalDistanceKm"`
+}
+
+// validateCoordinates checks that a latitude and longitude are on the globe
+func validateCoordinates(latitude, longitude Coordinate) error {
+	if latitude < -90 || latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90: %v", float64(latitude))
+	}
+	if longitude < -180 || longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180: %v", float64(longitude))
+	}
+	return nil
+}
+
+// haversineKm is the great-circle distance between two fixes in kilometres
+func haversineKm(from, to PositionFix) float64 {
+	toRadians := func(degrees Coordinate) float64 {
+		return float64(degrees) * math.Pi / 180
+	}
+	dLat := toRadians(to.Latitude - from.Latitude)
+	dLon := toRadians(to.Longitude - from.Longitude)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(from.Latitude))*math.Cos(toRadians(to.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// getPositionFixes loads the fixes of a shipment in fix time order
+func getPositionFixes(stub shim.ChaincodeStubInterface, shipmentID string) ([]PositionFix, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(positionObjectType, []string{shipmentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	fixes := []PositionFix{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var fix PositionFix
+		if err = json.Unmarshal(responseRange.Value, &fix); err != nil {
+			return nil, err
+		}
+		fixes = append(fixes, fix)
+	}
+	return fixes, nil
+}
+
+// ===========================================================================
+// updateShipmentPosition - append a GPS fix to the route of a shipment, sent by a
+// participant of the organization operating its carrier, such as one of its drivers
+// args: shipmentID, fix JSON {"latitude", "longitude" [, "recordedAt", "deviceID"]}
+// ===========================================================================
+func (t *SupplyChainChaincode) updateShipmentPosition(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and position JSON")
+	}
+	shipmentID := args[0]
+
+	var input struct {
+		DeviceID   string      `json:"deviceID"`
+		Latitude   *Coordinate `json:"latitude"`
+		Longitude  *Coordinate `json:"longitude"`
+		RecordedAt time.Time   `json:"recordedAt"`
+	}
+	if err := decodeInput("position", args[1], &input); err != nil {
+		return shim.Error(err.Error())
+	}
+	if input.Latitude == nil || input.Longitude == nil {
+		return shim.Error("position must contain latitude and longitude")
+	}
+	if err := validateCoordinates(*input.Latitude, *input.Longitude); err != nil {
+		return shim.Error(err.Error())
+	}
+	fix := PositionFix{
+		DeviceID:   input.DeviceID,
+		Latitude:   *input.Latitude,
+		Longitude:  *input.Longitude,
+		RecordedAt: input.RecordedAt,
+	}
+	// ==== Trackers report often, so only the status key of the shipment is read ====
+	status, err := checkShipmentWritable(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if !isCallerOrganization(c, status.CarrierOrganizationID) {
+		return denyAccess(stub, newAccessDenied(c, "updateShipmentPosition", "only the carrier of shipment "+shipmentID+" or its drivers can report its position"))
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if fix.RecordedAt.IsZero() {
+		fix.RecordedAt = txTime
+	}
+	fix.RecordedAt = fix.RecordedAt.UTC()
+	fix.ShipmentID = shipmentID
+	fix.TxID = stub.GetTxID()
+
+	fixAsBytes, err := json.Marshal(fix)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fixKey, err := stub.CreateCompositeKey(positionObjectType, []string{shipmentID, fix.RecordedAt.Format(sortableTimeLayout), fix.TxID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(fixKey, fixAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	position := strconv.FormatFloat(float64(fix.Latitude), 'f', -1, 64) + "," + strconv.FormatFloat(float64(fix.Longitude), 'f', -1, 64)
+	if err = emitEvent(stub, ShipmentPositionUpdated, shipmentID, "", position); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(fixAsBytes)
+}
+
+// ===========================================================================
+// getShipmentRoute - the ordered GPS track of a shipment and the total distance travelled
+// ===========================================================================
+func (t *SupplyChainChaincode) getShipmentRoute(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	fixes, err := getPositionFixes(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	route := ShipmentRoute{ShipmentID: args[0], Track: fixes}
+	for i := 1; i < len(fixes); i++ {
+		route.TotalDistanceKm += haversineKm(fixes[i-1], fixes[i])
+	}
+	routeAsBytes, err := json.Marshal(route)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(routeAsBytes)
+}
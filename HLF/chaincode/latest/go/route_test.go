@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	paris := PositionFix{Latitude: 48.8566, Longitude: 2.3522}
+	london := PositionFix{Latitude: 51.5074, Longitude: -0.1278}
+	tests := []struct {
+		name     string
+		from, to PositionFix
+		want     float64
+	}{
+		{"same point", paris, paris, 0},
+		{"paris to london", paris, london, 343.5},
+		{"london to paris", london, paris, 343.5},
+		{"equator to pole", PositionFix{}, PositionFix{Latitude: 90}, earthRadiusKm * math.Pi / 2},
+		{"antipodes", PositionFix{}, PositionFix{Longitude: 180}, earthRadiusKm * math.Pi},
+		{"across the antimeridian", PositionFix{Longitude: 179.5}, PositionFix{Longitude: -179.5}, earthRadiusKm * math.Pi / 180},
+	}
+	for _, tt := range tests {
+		if got := haversineKm(tt.from, tt.to); math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("%s: haversineKm = %.1f, want %.1f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCoordinates(t *testing.T) {
+	tests := []struct {
+		latitude, longitude Coordinate
+		wantErr             bool
+	}{
+		{48.8566, 2.3522, false},
+		{90, 180, false},
+		{-90, -180, false},
+		{90.1, 0, true},
+		{-90.1, 0, true},
+		{0, 180.1, true},
+		{0, -180.1, true},
+	}
+	for _, tt := range tests {
+		if err := validateCoordinates(tt.latitude, tt.longitude); (err != nil) != tt.wantErr {
+			t.Errorf("validateCoordinates(%v, %v) error = %v, wantErr %v", tt.latitude, tt.longitude, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCoordinateUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    Coordinate
+		wantErr bool
+	}{
+		{`48.8566`, 48.8566, false},
+		{`"48.8566"`, 48.8566, false},
+		{`"-0.1278"`, -0.1278, false},
+		{`"north"`, 0, true},
+	}
+	for _, tt := range tests {
+		var got Coordinate
+		err := json.Unmarshal([]byte(tt.payload), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.payload, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: coordinate = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateShipmentPositionParties(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", shipmentPayload("purchase01"))
+
+	// ==== Only the organization operating the carrier tracks the shipment ====
+	s.mustDeny(buyerDriverUser, "updateShipmentPosition", "shipment01", `{"latitude":48.8566,"longitude":2.3522}`)
+	s.mustInvoke(driverUser, "updateShipmentPosition", "shipment01", `{"latitude":48.8566,"longitude":2.3522}`)
+	s.mustInvoke(driverUser, "updateShipmentPosition", "shipment01", `{"latitude":51.5074,"longitude":-0.1278}`)
+
+	var route ShipmentRoute
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "getShipmentRoute", "shipment01"), &route); err != nil {
+		t.Fatal(err)
+	}
+	if len(route.Track) != 2 || math.Abs(route.TotalDistanceKm-343.5) > 0.5 {
+		t.Errorf("route = %d fixes over %.1f km, want 2 fixes over 343.5 km", len(route.Track), route.TotalDistanceKm)
+	}
+}
@@ -0,0 +1,579 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// accounts are keyed by organization, escrows by purchase order and indexed by buyer and seller organization
+const (
+	accountObjectType       = "account"
+	escrowObjectType        = "escrow"
+	organizationEscrowIndex = "organization~escrow"
+)
+
+// EscrowStatus is the state of the funds locked for a purchase order
+type EscrowStatus string
+
+const (
+	escrowLocked   EscrowStatus = "locked"
+	escrowReleased EscrowStatus = "released"
+	escrowRefunded EscrowStatus = "refunded"
+	escrowProrated EscrowStatus = "prorated"
+)
+
+// String returns the name of the escrow status
+func (s EscrowStatus) String() string {
+	return string(s)
+}
+
+// Account is the public account of an organization, the funds deposited by the clearing admin.
+// Escrows reveal purchase order prices, so what they lock and pay is only kept privately and
+// the balance is worked out by getAccountBalance.
+type Account struct {
+	OrganizationID string  `json:"organizationID"`
+	Deposited      float64 `json:"deposited"`
+}
+
+// AccountBalance is an account with its escrows applied.
+// Balance is freely available, Escrowed is locked for validated purchase orders.
+type AccountBalance struct {
+	OrganizationID string  `json:"organizationID"`
+	Deposited      float64 `json:"deposited"`
+	Balance        float64 `json:"balance"`
+	Escrowed       float64 `json:"escrowed"`
+}
+
+// Escrow is the buyer's payment for a purchase order held until every linked shipment is received.
+// Its amounts are kept in the pricing collection of the buyer and seller, the public record only
+// keeps their hash.
+type Escrow struct {
+	PurchaseOrderID      string            `json:"purchaseOrderID"`
+	BuyerOrganizationID  string            `json:"buyerOrganizationID"`
+	SellerOrganizationID string            `json:"sellerOrganizationID"`
+	AmountsHash          string            `json:"amountsHash"`
+	AmountsCollection    string            `json:"amountsCollection"`
+	Status               EscrowStatus      `json:"status"`
+	History              []StateTransition `json:"history"`
+}
+
+// EscrowAmounts is the private record of what an escrow locked, released to the seller and refunded to the buyer
+type EscrowAmounts struct {
+	ObjectType      string  `json:"docType"`
+	PurchaseOrderID string  `json:"purchaseOrderID"`
+	Amount          float64 `json:"amount"`
+	ReleasedAmount  float64 `json:"releasedAmount"`
+	RefundedAmount  float64 `json:"refundedAmount"`
+	Salt            string  `json:"salt"`
+}
+
+// EscrowDisclosure is an escrow as returned to a client, with its amounts when the client's MSP holds them
+type EscrowDisclosure struct {
+	Escrow
+	Amounts *EscrowAmounts `json:"amounts,omitempty"`
+}
+
+// roundAmount rounds an amount to cents
+func roundAmount(amount float64) float64 {
+	return math.Floor(amount*100+0.5) / 100
+}
+
+// getAccount loads the account of an organization, an organization without one starts at zero
+func getAccount(stub shim.ChaincodeStubInterface, organizationID string) (Account, error) {
+	account := Account{OrganizationID: organizationID}
+	accountAsBytes, err := getObjectState(stub, accountObjectType, organizationID)
+	if err != nil {
+		return account, fmt.Errorf("failed to get account %s: %s", organizationID, err.Error())
+	} else if accountAsBytes == nil {
+		_, err = getOrganization(stub, organizationID)
+		return account, err
+	}
+	err = json.Unmarshal(accountAsBytes, &account)
+	return account, err
+}
+
+// putAccount writes the account of an organization
+func putAccount(stub shim.ChaincodeStubInterface, account Account) ([]byte, error) {
+	account.Deposited = roundAmount(account.Deposited)
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return nil, err
+	}
+	return accountAsBytes, putObjectState(stub, accountObjectType, account.OrganizationID, accountAsBytes)
+}
+
+// getEscrow loads the escrow of a purchase order, nil if none was locked
+func getEscrow(stub shim.ChaincodeStubInterface, purchaseOrderID string) (*Escrow, error) {
+	escrowAsBytes, err := getObjectState(stub, escrowObjectType, purchaseOrderID)
+	if err != nil || escrowAsBytes == nil {
+		return nil, err
+	}
+	var escrow Escrow
+	err = json.Unmarshal(escrowAsBytes, &escrow)
+	return &escrow, err
+}
+
+// putEscrow writes the escrow of a purchase order
+func putEscrow(stub shim.ChaincodeStubInterface, escrow Escrow) ([]byte, error) {
+	escrowAsBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return nil, err
+	}
+	return escrowAsBytes, putObjectState(stub, escrowObjectType, escrow.PurchaseOrderID, escrowAsBytes)
+}
+
+// getEscrowAmounts reads the private amounts of an escrow, only peers of its buyer and seller hold them
+func getEscrowAmounts(stub shim.ChaincodeStubInterface, escrow Escrow) (EscrowAmounts, error) {
+	var amounts EscrowAmounts
+	err := getPrivateRecord(stub, escrow.AmountsCollection, escrowObjectType, escrow.PurchaseOrderID, escrow.AmountsHash, &amounts)
+	return amounts, err
+}
+
+// putEscrowAmounts writes the private amounts of an escrow and keeps their hash on the escrow
+func putEscrowAmounts(stub shim.ChaincodeStubInterface, escrow *Escrow, amounts EscrowAmounts) error {
+	amounts.ObjectType = escrowObjectType
+	amounts.PurchaseOrderID = escrow.PurchaseOrderID
+	amounts.Amount = roundAmount(amounts.Amount)
+	amounts.ReleasedAmount = roundAmount(amounts.ReleasedAmount)
+	amounts.RefundedAmount = roundAmount(amounts.RefundedAmount)
+	hash, err := putPrivateRecord(stub, escrow.AmountsCollection, escrowObjectType, escrow.PurchaseOrderID, amounts)
+	if err != nil {
+		return err
+	}
+	escrow.AmountsHash = hash
+	return nil
+}
+
+// discloseEscrow adds the amounts of an escrow for a client of one of its collection members
+func discloseEscrow(stub shim.ChaincodeStubInterface, escrow Escrow, mspID string) (EscrowDisclosure, error) {
+	disclosure := EscrowDisclosure{Escrow: escrow}
+	if !isCollectionMember(escrow.AmountsCollection, mspID) {
+		return disclosure, nil
+	}
+	amounts, err := getEscrowAmounts(stub, escrow)
+	if err != nil {
+		return disclosure, err
+	}
+	disclosure.Amounts = &amounts
+	return disclosure, nil
+}
+
+// participantOrganizationID resolves the organization of a registered participant
+func participantOrganizationID(stub shim.ChaincodeStubInterface, participantID string) (string, error) {
+	participant, err := getParticipant(stub, participantID)
+	if err != nil {
+		return "", err
+	}
+	return participant.Organization.OrganizationID, nil
+}
+
+// lockEscrow locks the purchase order amount of the buyer in escrow.
+// The seller validates the order, and its peers cannot read the escrows the buyer holds with
+// other sellers, so the buyer's balance is not checked here. getAccountBalance shows the
+// balance, negative when the buyer has committed more than it deposited.
+func lockEscrow(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder) error {
+	if existing, err := getEscrow(stub, purchaseOrder.PurchaseOrderID); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("escrow already exists for purchase order %s", purchaseOrder.PurchaseOrderID)
+	}
+	// ==== A privately priced order is read from the pricing collection of buyer and seller ====
+	price, err := getPurchaseOrderPrice(stub, purchaseOrder)
+	if err != nil {
+		return err
+	}
+	if price.Price < 0 {
+		return fmt.Errorf("purchase order %s has a negative amount", purchaseOrder.PurchaseOrderID)
+	}
+	buyerOrganizationID, err := participantOrganizationID(stub, purchaseOrder.Buyer.ParticipantID)
+	if err != nil {
+		return fmt.Errorf("buyer of purchase order %s: %s", purchaseOrder.PurchaseOrderID, err.Error())
+	}
+	sellerOrganizationID, err := participantOrganizationID(stub, purchaseOrder.Seller.ParticipantID)
+	if err != nil {
+		return fmt.Errorf("seller of purchase order %s: %s", purchaseOrder.PurchaseOrderID, err.Error())
+	}
+
+	collection, err := purchaseOrderCollection(stub, purchaseOrder)
+	if err != nil {
+		return err
+	}
+
+	escrow := Escrow{
+		PurchaseOrderID:      purchaseOrder.PurchaseOrderID,
+		BuyerOrganizationID:  buyerOrganizationID,
+		SellerOrganizationID: sellerOrganizationID,
+		AmountsCollection:    collection,
+		Status:               escrowLocked,
+	}
+	amounts := EscrowAmounts{Amount: price.Price, Salt: derivedSalt(stub, price.Salt)}
+	if err = putEscrowAmounts(stub, &escrow, amounts); err != nil {
+		return err
+	}
+	transition, err := newStateTransition(stub, EscrowStatus(""), escrowLocked, "")
+	if err != nil {
+		return err
+	}
+	escrow.History = append(escrow.History, transition)
+	if _, err = putEscrow(stub, escrow); err != nil {
+		return err
+	}
+
+	// ==== Index the escrow under both organizations for the per-organization query ====
+	for _, organizationID := range []string{buyerOrganizationID, sellerOrganizationID} {
+		indexKey, err := stub.CreateCompositeKey(organizationEscrowIndex, []string{organizationID, purchaseOrder.PurchaseOrderID})
+		if err != nil {
+			return err
+		}
+		if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+	fmt.Println("- lockEscrow ", purchaseOrder.PurchaseOrderID)
+	return nil
+}
+
+// settleEscrow pays share of a locked escrow to the seller and refunds the rest to the buyer.
+// A purchase order without escrow, or whose escrow is already settled, is left alone.
+func settleEscrow(stub shim.ChaincodeStubInterface, purchaseOrderID string, share float64, to EscrowStatus, comment string) error {
+	escrow, err := getEscrow(stub, purchaseOrderID)
+	if err != nil {
+		return err
+	} else if escrow == nil {
+		fmt.Println("- settleEscrow: no escrow for purchase order ", purchaseOrderID)
+		return nil
+	}
+	if escrow.Status != escrowLocked {
+		fmt.Println("- settleEscrow: escrow of purchase order ", purchaseOrderID, " is already ", escrow.Status)
+		return nil
+	}
+
+	// ==== The accounts are left alone, getAccountBalance applies the settled amounts ====
+	amounts, err := getEscrowAmounts(stub, *escrow)
+	if err != nil {
+		return err
+	}
+	amounts.ReleasedAmount = roundAmount(amounts.Amount * share)
+	amounts.RefundedAmount = roundAmount(amounts.Amount - amounts.ReleasedAmount)
+	if err = putEscrowAmounts(stub, escrow, amounts); err != nil {
+		return err
+	}
+
+	transition, err := newStateTransition(stub, escrow.Status, to, comment)
+	if err != nil {
+		return err
+	}
+	escrow.Status = to
+	escrow.History = append(escrow.History, transition)
+	if _, err = putEscrow(stub, *escrow); err != nil {
+		return err
+	}
+	fmt.Println("- settleEscrow ", purchaseOrderID, to)
+	return nil
+}
+
+// deliveredShare is the part of a purchase order the buyer received, weighted by line price.
+// Lines without a price are weighted by quantity; each line counts the received quantity of
+// the reconciled receipts, up to the quantity ordered.
+func deliveredShare(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder, reconciled []ReconciliationLine) (float64, error) {
+	price, err := getPurchaseOrderPrice(stub, purchaseOrder)
+	if err != nil {
+		return 0, err
+	}
+	byPrice := false
+	for _, linePrice := range price.LinePrices {
+		if linePrice > 0 {
+			byPrice = true
+			break
+		}
+	}
+
+	var total, delivered float64
+	for _, line := range reconciled {
+		if line.Ordered <= 0 {
+			// ==== Units that were never ordered do not pay for missing ones ====
+			continue
+		}
+		weight := float64(line.Ordered)
+		if byPrice {
+			weight = price.LinePrices[line.LogisticsUnitID]
+		}
+		received := line.Received
+		if received > line.Ordered {
+			received = line.Ordered
+		}
+		total += weight
+		delivered += weight * float64(received) / float64(line.Ordered)
+	}
+	if total <= 0 {
+		return 0, nil
+	}
+	return delivered / total, nil
+}
+
+// settleReceivedEscrow settles the escrow of a purchase order from the receipts of the buyer
+// once every shipment of the order is delivered and received. The escrow is released in full
+// when the order reconciled complete, otherwise pro rata to the received share of the order.
+// receipts include the one of shipmentID recorded by this transaction.
+func settleReceivedEscrow(stub shim.ChaincodeStubInterface, purchaseOrder PurchaseOrder, shipmentID string, receipts []Receipt, reconciled []ReconciliationLine, complete bool) error {
+	purchaseOrderID := purchaseOrder.PurchaseOrderID
+	received := map[string]bool{}
+	for _, receipt := range receipts {
+		received[receipt.ShipmentID] = true
+	}
+	shipmentIDs, err := getPurchaseOrderShipmentIDs(stub, purchaseOrderID)
+	if err != nil {
+		return err
+	}
+	for _, otherID := range shipmentIDs {
+		if received[otherID] {
+			continue
+		}
+		// ==== A shipment archived before it left never reaches the buyer ====
+		other, err := getShipment(stub, otherID)
+		if err != nil {
+			return err
+		}
+		if !other.Archived || other.ShipmentOrderState.isDelivered() {
+			fmt.Println("- settleReceivedEscrow: shipment ", otherID, " of purchase order ", purchaseOrderID, " is not received yet")
+			return nil
+		}
+	}
+	if complete {
+		return settleEscrow(stub, purchaseOrderID, 1, escrowReleased, "receipt of shipment "+shipmentID+", every shipment received, order complete")
+	}
+	share, err := deliveredShare(stub, purchaseOrder, reconciled)
+	if err != nil {
+		return err
+	}
+	return settleEscrow(stub, purchaseOrderID, share, escrowProrated, fmt.Sprintf("receipt of shipment %s, every shipment received, %.4f of the order received", shipmentID, share))
+}
+
+// getOrganizationEscrows loads every escrow where an organization is buyer or seller
+func getOrganizationEscrows(stub shim.ChaincodeStubInterface, organizationID string) ([]Escrow, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(organizationEscrowIndex, []string{organizationID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	escrows := []Escrow{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := stub.SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		escrow, err := getEscrow(stub, compositeKeyParts[1])
+		if err != nil {
+			return nil, err
+		} else if escrow != nil {
+			escrows = append(escrows, *escrow)
+		}
+	}
+	return escrows, nil
+}
+
+// accountBalance applies the escrows of an organization to its deposits: a locked escrow moves its
+// amount from the buyer's balance to escrowed, a settled one pays the released amount to the seller.
+// The amounts are private, so only the organization's own peers can work the balance out.
+func accountBalance(stub shim.ChaincodeStubInterface, account Account, mspID string) (AccountBalance, error) {
+	balance := AccountBalance{OrganizationID: account.OrganizationID, Deposited: account.Deposited, Balance: account.Deposited}
+	escrows, err := getOrganizationEscrows(stub, account.OrganizationID)
+	if err != nil {
+		return balance, err
+	}
+	for _, escrow := range escrows {
+		if !isCollectionMember(escrow.AmountsCollection, mspID) {
+			return balance, fmt.Errorf("the escrow of purchase order %s is private to %s", escrow.PurchaseOrderID, escrow.AmountsCollection)
+		}
+		amounts, err := getEscrowAmounts(stub, escrow)
+		if err != nil {
+			return balance, err
+		}
+		// ==== An organization selling to itself is both debited and credited ====
+		if escrow.BuyerOrganizationID == account.OrganizationID {
+			if escrow.Status == escrowLocked {
+				balance.Balance -= amounts.Amount
+				balance.Escrowed += amounts.Amount
+			} else {
+				balance.Balance -= amounts.ReleasedAmount
+			}
+		}
+		if escrow.SellerOrganizationID == account.OrganizationID && escrow.Status != escrowLocked {
+			balance.Balance += amounts.ReleasedAmount
+		}
+	}
+	balance.Balance = roundAmount(balance.Balance)
+	balance.Escrowed = roundAmount(balance.Escrowed)
+	return balance, nil
+}
+
+// readAccountOrganization checks that the caller may see the account of an organization
+func readAccountOrganization(stub shim.ChaincodeStubInterface, function, organizationID string) (*accessDenied, error) {
+	c, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	if c.Admin {
+		return nil, nil
+	}
+	org, err := getOrganization(stub, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if c.MSPID != org.MSPID {
+		return newAccessDenied(c, function, "the account of "+organizationID+" can only be read from MSP "+org.MSPID), nil
+	}
+	return nil, nil
+}
+
+// ===========================================================================
+// depositFunds - credit the balance account of an organization, by the clearing admin only
+// args: organizationID, amount
+// ===========================================================================
+func (t *SupplyChainChaincode) depositFunds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID and amount")
+	}
+	amount, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || amount <= 0 {
+		return shim.Error("amount must be a positive number")
+	}
+	// ==== Only the clearing admin configured at Init may create funds ====
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	clearingAdmin, err := getConfig(stub, clearingAdminKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !c.Admin || len(clearingAdmin) <= 0 || c.EnrollmentID != clearingAdmin {
+		return denyAccess(stub, newAccessDenied(c, "depositFunds", "funds can only be deposited by the clearing admin"))
+	}
+	fmt.Println("- start depositFunds ", args[0], amount)
+
+	account, err := getAccount(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	oldDeposited := account.Deposited
+	account.Deposited += amount
+	accountAsBytes, err := putAccount(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end depositFunds")
+	if err = emitEvent(stub, FundsDeposited, args[0], strconv.FormatFloat(oldDeposited, 'f', 2, 64), strconv.FormatFloat(roundAmount(account.Deposited), 'f', 2, 64)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(accountAsBytes)
+}
+
+// ===========================================================================
+// getAccountBalance - the balance and escrowed total of an organization,
+// answered by the peers of its own MSP which hold the amounts of its escrows
+// ===========================================================================
+func (t *SupplyChainChaincode) getAccountBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID")
+	}
+	denied, err := readAccountOrganization(stub, "getAccountBalance", args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	account, err := getAccount(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance, err := accountBalance(stub, account, mspID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balanceAsBytes, err := json.Marshal(balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(balanceAsBytes)
+}
+
+// ===========================================================================
+// readEscrow - the escrow of a purchase order, with its amounts for the buyer and seller
+// ===========================================================================
+func (t *SupplyChainChaincode) readEscrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting purchaseOrderID")
+	}
+	escrow, err := getEscrow(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if escrow == nil {
+		return shim.Error("no escrow for purchase order: " + args[0])
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disclosure, err := discloseEscrow(stub, *escrow, mspID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrowAsBytes, err := json.Marshal(disclosure)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(escrowAsBytes)
+}
+
+// ===========================================================================
+// getEscrowsByOrganization - every escrow where the organization is buyer or seller,
+// with the amounts the caller's MSP holds
+// ===========================================================================
+func (t *SupplyChainChaincode) getEscrowsByOrganization(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting organizationID")
+	}
+	denied, err := readAccountOrganization(stub, "getEscrowsByOrganization", args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	escrows, err := getOrganizationEscrows(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	disclosures := []EscrowDisclosure{}
+	for _, escrow := range escrows {
+		disclosure, err := discloseEscrow(stub, escrow, mspID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		disclosures = append(disclosures, disclosure)
+	}
+	escrowsAsBytes, err := json.Marshal(disclosures)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(escrowsAsBytes)
+}
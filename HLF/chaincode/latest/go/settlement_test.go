@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEscrowAmountsArePrivate(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(networkAdmin, "depositFunds", network.buyerOrg, "5000")
+	s.mustInvokeTransient(sellerUser, pricingTransient(1234.56, "salt01"), "createShipment", "shipment01", shipmentPayload("purchase01"))
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+
+	// ==== Neither the escrow nor the accounts carry the price on the public state ====
+	if keys := s.publicKeysContaining("1234.56"); len(keys) > 0 {
+		t.Errorf("public state reveals the price under %q", keys)
+	}
+	if keys := s.publicKeysContaining("3765.44"); len(keys) > 0 {
+		t.Errorf("public state reveals the balance under %q", keys)
+	}
+
+	// ==== The buyer and seller read the amounts, the carrier only the status ====
+	var escrow EscrowDisclosure
+	if err := json.Unmarshal(s.mustInvoke(driverUser, "readEscrow", "purchase01"), &escrow); err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Status != escrowLocked || escrow.Amounts != nil {
+		t.Errorf("escrow read by the carrier = %+v, want locked without amounts", escrow)
+	}
+	if err := json.Unmarshal(s.mustInvoke(sellerUser, "readEscrow", "purchase01"), &escrow); err != nil {
+		t.Fatal(err)
+	}
+	if escrow.Amounts == nil || escrow.Amounts.Amount != 1234.56 {
+		t.Errorf("escrow read by the seller = %+v, want 1234.56 locked", escrow)
+	}
+
+	var balance AccountBalance
+	if err := json.Unmarshal(s.mustInvoke(buyerUser, "getAccountBalance", network.buyerOrg), &balance); err != nil {
+		t.Fatal(err)
+	}
+	if want := (AccountBalance{OrganizationID: network.buyerOrg, Deposited: 5000, Balance: 3765.44, Escrowed: 1234.56}); balance != want {
+		t.Errorf("buyer balance = %+v, want %+v", balance, want)
+	}
+	s.mustDeny(sellerUser, "getAccountBalance", network.buyerOrg)
+}
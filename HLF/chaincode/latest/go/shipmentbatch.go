@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// outcome of each shipment of a batch
+const (
+	shipmentCreated   = "created"
+	shipmentDuplicate = "duplicate"
+	shipmentInvalid   = "invalid"
+)
+
+// shipmentImportError is a shipment refused before anything was written, Status is
+// shipmentDuplicate or shipmentInvalid
+type shipmentImportError struct {
+	Status string
+	Err    error
+}
+
+func (e *shipmentImportError) Error() string {
+	return e.Err.Error()
+}
+
+// rejectShipment wraps the reason a shipment is invalid
+func rejectShipment(err error) error {
+	return &shipmentImportError{Status: shipmentInvalid, Err: err}
+}
+
+// batch modes: bestEffort writes the valid shipments, allOrNothing aborts on the first failure
+const (
+	batchBestEffort   = "bestEffort"
+	batchAllOrNothing = "allOrNothing"
+)
+
+// maxShipmentsBatch bounds the write set of one transaction
+const maxShipmentsBatch = 500
+
+// ShipmentBatchItem is the outcome of one shipment of a batch
+type ShipmentBatchItem struct {
+	Index      int         `json:"index"`
+	ShipmentID string      `json:"shipmentID"`
+	Status     string      `json:"status"`
+	Reason     string      `json:"reason,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// ShipmentBatchResult is returned by createShipmentsBatch, and as the error of an aborted allOrNothing batch
+type ShipmentBatchResult struct {
+	Mode       string              `json:"mode"`
+	Created    int                 `json:"created"`
+	Duplicates int                 `json:"duplicates"`
+	Invalid    int                 `json:"invalid"`
+	Aborted    bool                `json:"aborted"`
+	Items      []ShipmentBatchItem `json:"items"`
+}
+
+// add records the outcome of a shipment, taking the reason from a decoding or import error
+func (result *ShipmentBatchResult) add(item ShipmentBatchItem, err error) {
+	if err != nil {
+		item.Status = shipmentInvalid
+		if rejection, ok := err.(*shipmentImportError); ok {
+			item.Status = rejection.Status
+			err = rejection.Err
+		}
+		if validation, ok := err.(*ValidationError); ok {
+			item.Reason = "invalid " + validation.Object
+			item.Violations = validation.Violations
+		} else {
+			item.Reason = err.Error()
+		}
+	}
+	switch item.Status {
+	case shipmentCreated:
+		result.Created++
+	case shipmentDuplicate:
+		result.Duplicates++
+	default:
+		result.Invalid++
+	}
+	result.Items = append(result.Items, item)
+}
+
+// createdShipmentIDs lists the shipments the batch wrote, in batch order
+func (result *ShipmentBatchResult) createdShipmentIDs() []string {
+	shipmentIDs := []string{}
+	for _, item := range result.Items {
+		if item.Status == shipmentCreated {
+			shipmentIDs = append(shipmentIDs, item.ShipmentID)
+		}
+	}
+	return shipmentIDs
+}
+
+// ===========================================================================
+// createShipmentsBatch - create many shipments in one transaction.
+// Each shipment carries its own shipmentID. The private pricing of a new purchase order
+// is read from the transient map under "pricing:<purchaseOrderID>".
+// args: JSON array of shipments [, mode (bestEffort or allOrNothing, default bestEffort)]
+// ===========================================================================
+func (t *SupplyChainChaincode) createShipmentsBatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipments JSON array and optional mode")
+	}
+	mode := batchBestEffort
+	if len(args) == 2 && len(args[1]) > 0 {
+		mode = args[1]
+	}
+	if mode != batchBestEffort && mode != batchAllOrNothing {
+		return shim.Error("mode must be " + batchBestEffort + " or " + batchAllOrNothing + ": " + mode)
+	}
+	var payloads []json.RawMessage
+	if err := decodeInput("shipments", args[0], &payloads); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(payloads) <= 0 || len(payloads) > maxShipmentsBatch {
+		return shim.Error("a batch must contain between 1 and " + strconv.Itoa(maxShipmentsBatch) + " shipments")
+	}
+	fmt.Println("- start createShipmentsBatch ", mode, len(payloads))
+
+	// ==== The ledger does not return this transaction's own writes, so the batch tracks them ====
+	seen := map[string]bool{}
+	purchaseOrders := map[string]PurchaseOrder{}
+	result := ShipmentBatchResult{Mode: mode, Items: []ShipmentBatchItem{}}
+	for i, payload := range payloads {
+		var shipment Shipment
+		err := decodeInput("shipment", string(payload), &shipment)
+		item := ShipmentBatchItem{Index: i, ShipmentID: shipment.ShipmentID, Status: shipmentCreated}
+		if err == nil && len(shipment.ShipmentID) <= 0 {
+			err = fmt.Errorf("shipmentID must be a non-empty string")
+		} else if err == nil && seen[shipment.ShipmentID] {
+			err = &shipmentImportError{Status: shipmentDuplicate, Err: fmt.Errorf("shipmentID appears more than once in the batch: %s", shipment.ShipmentID)}
+		} else if err == nil {
+			seen[shipment.ShipmentID] = true
+			priceKey := pricingTransientKey + ":" + shipment.PurchaseOrder.PurchaseOrderID
+			_, err = importShipment(stub, shipment.ShipmentID, shipment, priceKey, purchaseOrders)
+			if _, rejected := err.(*shipmentImportError); err != nil && !rejected {
+				return shim.Error(err.Error())
+			}
+		}
+		result.add(item, err)
+		if mode == batchAllOrNothing && err != nil {
+			break
+		}
+	}
+
+	// ==== An error response is never committed, so nothing of an aborted batch is written ====
+	if mode == batchAllOrNothing && result.Created < len(payloads) {
+		result.Aborted = true
+		resultAsBytes, err := json.Marshal(result)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Error(string(resultAsBytes))
+	}
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end createShipmentsBatch ", result.Created, result.Duplicates, result.Invalid)
+	if err = emitBatchEvent(stub, ShipmentsImported, result.createdShipmentIDs(), "", waiting.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultAsBytes)
+}
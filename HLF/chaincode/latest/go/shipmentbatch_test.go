@@ -0,0 +1,23 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShipmentsImportedEvent(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	batch := `[{"shipmentID":"shipment01",` + shipmentPayload("purchase01")[1:] + `,` +
+		`{"shipmentID":"shipment01",` + shipmentPayload("purchase01")[1:] + `,` +
+		`{"shipmentID":"shipment02",` + shipmentPayload("purchase01")[1:] + `]`
+	s.mustInvoke(sellerUser, "createShipmentsBatch", batch, batchBestEffort)
+
+	// ==== The event names every shipment written, the duplicate is left out ====
+	event := s.lastEvent()
+	if event.EventType != ShipmentsImported || event.EntityID != "" || event.NewState != waiting.String() {
+		t.Errorf("last event = %+v, want %s of new %s shipments", event, ShipmentsImported, waiting)
+	}
+	if want := []string{"shipment01", "shipment02"}; !reflect.DeepEqual(event.EntityIDs, want) {
+		t.Errorf("entityIDs = %v, want %v", event.EntityIDs, want)
+	}
+}
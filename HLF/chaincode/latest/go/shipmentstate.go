@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// shipmentTransitions is the lifecycle of a shipment, keyed by the current state.
+// deliveredComplete and deliveredIncomplete are terminal.
+var shipmentTransitions = map[ShipmentOrderState][]ShipmentOrderState{
+	waiting:   {loading},
+	loading:   {loaded},
+	loaded:    {inTransit},
+	inTransit: {deliveredComplete, deliveredIncomplete},
+}
+
+// canTransition reports whether a shipment may move from one state to another
+func (n ShipmentOrderState) canTransition(to ShipmentOrderState) bool {
+	for _, next := range shipmentTransitions[n] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isDelivered reports whether the shipment has reached one of the delivered states
+func (n ShipmentOrderState) isDelivered() bool {
+	return n == deliveredComplete || n == deliveredIncomplete
+}
+
+// parseShipmentOrderState accepts either the state name or its numeric value
+func parseShipmentOrderState(value string) (ShipmentOrderState, error) {
+	for state := waiting; state <= deliveredIncomplete; state++ {
+		if state.String() == value {
+			return state, nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < int(waiting) || number > int(deliveredIncomplete) {
+		return waiting, fmt.Errorf("unknown shipmentOrderState: %s", value)
+	}
+	return ShipmentOrderState(number), nil
+}
+
+// getShipment loads a shipment record
+func getShipment(stub shim.ChaincodeStubInterface, shipmentID string) (Shipment, error) {
+	var shipment Shipment
+	shipmentAsBytes, err := getObjectState(stub, shipmentObjectType, shipmentID)
+	if err != nil {
+		return shipment, fmt.Errorf("failed to get shipment %s: %s", shipmentID, err.Error())
+	} else if shipmentAsBytes == nil {
+		return shipment, fmt.Errorf("shipment does not exist: %s", shipmentID)
+	}
+	err = json.Unmarshal(shipmentAsBytes, &shipment)
+	return shipment, err
+}
+
+// getWritableShipment loads a shipment that is about to change, refusing archived shipments
+func getWritableShipment(stub shim.ChaincodeStubInterface, shipmentID string) (Shipment, error) {
+	shipment, err := getShipment(stub, shipmentID)
+	if err != nil {
+		return shipment, err
+	}
+	if shipment.Archived {
+		return shipment, fmt.Errorf("shipment %s is archived and read-only", shipmentID)
+	}
+	return shipment, nil
+}
+
+// shipment status keys hold the few lifecycle flags and parties that high-frequency writers such
+// as telemetry check, so they do not put the whole shipment document in their read set
+const shipmentStatusObjectType = "shipmentStatus"
+
+// ShipmentStatus changes only when a shipment is created, transferred, archived or deleted
+type ShipmentStatus struct {
+	ShipmentID            string `json:"shipmentID"`
+	Archived              bool   `json:"archived"`
+	SellerOrganizationID  string `json:"sellerOrganizationID,omitempty"`
+	CarrierOrganizationID string `json:"carrierOrganizationID,omitempty"`
+}
+
+// newShipmentStatus resolves the status of a shipment: the organization of the seller
+// of its purchase order and the one operating its current carrier
+func newShipmentStatus(stub shim.ChaincodeStubInterface, shipment Shipment) (ShipmentStatus, error) {
+	status := ShipmentStatus{ShipmentID: shipment.ShipmentID, Archived: shipment.Archived}
+	sellerOrganizationID, err := participantOrganizationID(stub, shipment.PurchaseOrder.Seller.ParticipantID)
+	if err != nil {
+		return status, err
+	}
+	carrierOrganizationID, err := carrierOrganizationID(stub, currentOwner(shipment).CarrierID)
+	if err != nil {
+		return status, err
+	}
+	status.SellerOrganizationID = sellerOrganizationID
+	status.CarrierOrganizationID = carrierOrganizationID
+	return status, nil
+}
+
+// putShipmentStatus writes the status key of a shipment
+func putShipmentStatus(stub shim.ChaincodeStubInterface, shipment Shipment) error {
+	status, err := newShipmentStatus(stub, shipment)
+	if err != nil {
+		return err
+	}
+	statusAsBytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return putObjectState(stub, shipmentStatusObjectType, shipment.ShipmentID, statusAsBytes)
+}
+
+// checkShipmentWritable fails unless a shipment exists and is not archived, reading only its
+// status key. Shipments whose status key predates the parties fall back to the shipment document.
+func checkShipmentWritable(stub shim.ChaincodeStubInterface, shipmentID string) (ShipmentStatus, error) {
+	var status ShipmentStatus
+	statusAsBytes, err := getObjectState(stub, shipmentStatusObjectType, shipmentID)
+	if err != nil {
+		return status, fmt.Errorf("failed to get shipment %s: %s", shipmentID, err.Error())
+	} else if statusAsBytes != nil {
+		if err = json.Unmarshal(statusAsBytes, &status); err != nil {
+			return status, err
+		}
+	}
+	if status.Archived {
+		return status, fmt.Errorf("shipment %s is archived and read-only", shipmentID)
+	}
+	if statusAsBytes != nil && len(status.SellerOrganizationID) > 0 {
+		return status, nil
+	}
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return status, err
+	}
+	return newShipmentStatus(stub, shipment)
+}
+
+// putShipment writes a shipment record. Archived shipments are read-only, only
+// archiveShipment writes them.
+func putShipment(stub shim.ChaincodeStubInterface, shipment Shipment) ([]byte, error) {
+	if shipment.Archived {
+		return nil, fmt.Errorf("shipment %s is archived and read-only", shipment.ShipmentID)
+	}
+	shipment.ObjectType = shipmentObjectType
+	shipmentAsBytes, err := json.Marshal(shipment)
+	if err != nil {
+		return nil, err
+	}
+	return shipmentAsBytes, putObjectState(stub, shipmentObjectType, shipment.ShipmentID, shipmentAsBytes)
+}
+
+// ===========================================================================
+// updateShipmentState - move a shipment to a new ShipmentOrderState. The real
+// departure and arrival dates are taken from the transaction timestamp.
+// Participants of the owner's or carrier's organization move it up to the transit,
+// participants of the buyer's or customer's organization confirm the delivery.
+// Going in transit ships the linked purchase order, delivery checks the carrier SLA.
+// The escrow is settled later, from the receipts recorded by the buyer.
+// args: shipmentID, shipmentOrderState [, comment]
+// ===========================================================================
+func (t *SupplyChainChaincode) updateShipmentState(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and shipmentOrderState")
+	}
+	shipmentID := args[0]
+	to, err := parseShipmentOrderState(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	comment := ""
+	if len(args) > 2 {
+		comment = args[2]
+	}
+	fmt.Println("- start updateShipmentState ", shipmentID, to)
+
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	if denied := checkShipmentStateAccess(c, to); denied != nil {
+		return denyAccess(stub, denied)
+	}
+
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment.Dispute {
+		return shim.Error("shipment " + shipmentID + " is frozen by open dispute " + shipment.DisputeID)
+	}
+
+	// ==== The role says what kind of participant called, the shipment names whose participants may move it ====
+	parties := "owner or carrier"
+	partyOrganizationIDs, err := custodianOrganizationIDs(stub, shipment)
+	if to.isDelivered() {
+		parties = "buyer or customer"
+		partyOrganizationIDs, err = recipientOrganizationIDs(stub, shipment)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isCallerOrganization(c, partyOrganizationIDs...) {
+		return denyAccess(stub, newAccessDenied(c, "updateShipmentState", "only the "+parties+" of shipment "+shipmentID+" can move it to "+to.String()))
+	}
+
+	from := shipment.ShipmentOrderState
+	if !from.canTransition(to) {
+		return shim.Error("Illegal shipment state transition for " + shipmentID + ": " + from.String() + " -> " + to.String())
+	}
+
+	transition, err := newStateTransition(stub, from, to, comment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if to == inTransit {
+		shipment.RealDepartureDate = transition.Timestamp
+	} else if to.isDelivered() {
+		shipment.RealArrivedDate = transition.Timestamp
+	}
+	shipment.ShipmentOrderState = to
+	shipment.History = append(shipment.History, transition)
+
+	shipmentJSONasBytes, err := putShipment(stub, shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if to == inTransit {
+		if err = shipPurchaseOrder(stub, shipment.PurchaseOrder.PurchaseOrderID, shipmentID); err != nil {
+			return shim.Error(err.Error())
+		}
+	} else if to.isDelivered() {
+		if err = recordSLAViolation(stub, shipment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	fmt.Println("- end updateShipmentState (success) ", from.String(), "->", to.String())
+	if err = emitEvent(stub, ShipmentStateChanged, shipmentID, from.String(), to.String()); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(shipmentJSONasBytes)
+}
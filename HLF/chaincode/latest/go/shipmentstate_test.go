@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestShipmentCanTransition(t *testing.T) {
+	tests := []struct {
+		from ShipmentOrderState
+		to   ShipmentOrderState
+		want bool
+	}{
+		{waiting, loading, true},
+		{waiting, loaded, false},
+		{waiting, inTransit, false},
+		{loading, loaded, true},
+		{loading, waiting, false},
+		{loaded, inTransit, true},
+		{inTransit, deliveredComplete, true},
+		{inTransit, deliveredIncomplete, true},
+		{inTransit, loaded, false},
+		{deliveredComplete, deliveredIncomplete, false},
+		{deliveredIncomplete, inTransit, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.canTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: canTransition = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestShipmentIsDelivered(t *testing.T) {
+	for state := waiting; state <= deliveredIncomplete; state++ {
+		want := state == deliveredComplete || state == deliveredIncomplete
+		if got := state.isDelivered(); got != want {
+			t.Errorf("%s: isDelivered = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestParseShipmentOrderState(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ShipmentOrderState
+		wantErr bool
+	}{
+		{"loading", loading, false},
+		{"deliveredIncomplete", deliveredIncomplete, false},
+		{"3", inTransit, false},
+		{"0", waiting, false},
+		{"6", waiting, true},
+		{"-1", waiting, true},
+		{"InTransit", waiting, true},
+		{"", waiting, true},
+	}
+	for _, tt := range tests {
+		got, err := parseShipmentOrderState(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseShipmentOrderState(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseShipmentOrderState(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateShipmentStateParties(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", shipmentPayload("purchase01"))
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+
+	// ==== The owner's and carrier's organizations move the shipment up to the transit ====
+	s.mustDeny(buyerDriverUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(sellerUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "loaded")
+	s.mustDeny(sellerUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustDeny(buyerDriverUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "inTransit")
+
+	// ==== The buyer's and customer's organizations confirm the delivery ====
+	s.mustDeny(carrierReceiverUser, "updateShipmentState", "shipment01", "deliveredComplete")
+	s.mustInvoke(buyerUser, "updateShipmentState", "shipment01", "deliveredComplete")
+	if event := s.lastEvent(); event.EventType != ShipmentStateChanged || event.NewState != deliveredComplete.String() {
+		t.Errorf("last event = %+v, want %s to %s", event, ShipmentStateChanged, deliveredComplete)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// contracts are keyed by carrier, violations by carrier, arrival time and shipment so a
+// carrier's violations come back in arrival order
+const (
+	slaContractObjectType  = "sla"
+	slaViolationObjectType = "slaViolation"
+)
+
+// penalty rules of an SLA contract
+const (
+	penaltyPercentage = "percentage"
+	penaltyPerHour    = "perHour"
+)
+
+// SLAContract is the delivery commitment of a carrier. A shipment arriving later than
+// the expected arrival date plus the grace period is penalized by a percentage of the
+// purchase order amount or by a flat amount per started hour late.
+// PartyID is the participant that last set the contract, empty when the network admin did.
+type SLAContract struct {
+	CarrierID          string  `json:"carrierID"`
+	PartyID            string  `json:"partyID"`
+	GracePeriodMinutes int     `json:"gracePeriodMinutes"`
+	PenaltyType        string  `json:"penaltyType"`
+	PenaltyRate        float64 `json:"penaltyRate"`
+	MaxPenalty         float64 `json:"maxPenalty,omitempty"`
+	TxID               string  `json:"txID"`
+}
+
+// SLAViolation is a late delivery with the penalty computed when the shipment was delivered.
+// A percentage penalty reveals the purchase order price, so every penalty is kept in the
+// pricing collection of the purchase order and the public record only keeps its hash.
+type SLAViolation struct {
+	ShipmentID          string    `json:"shipmentID"`
+	CarrierID           string    `json:"carrierID"`
+	PurchaseOrderID     string    `json:"purchaseOrderID"`
+	ExpectedArrivedDate time.Time `json:"expectedArrivedDate"`
+	RealArrivedDate     time.Time `json:"realArrivedDate"`
+	MinutesLate         int       `json:"minutesLate"`
+	PenaltyType         string    `json:"penaltyType"`
+	PenaltyRate         float64   `json:"penaltyRate"`
+	PenaltyHash         string    `json:"penaltyHash"`
+	PenaltyCollection   string    `json:"penaltyCollection"`
+	TxID                string    `json:"txID"`
+}
+
+// SLAViolationDisclosure is a violation as returned to a client, with its penalty when the client's MSP holds it
+type SLAViolationDisclosure struct {
+	SLAViolation
+	Penalty *float64 `json:"penalty,omitempty"`
+}
+
+// getSLAContract loads the contract of a carrier, nil if it has none
+func getSLAContract(stub shim.ChaincodeStubInterface, carrierID string) (*SLAContract, error) {
+	contractAsBytes, err := getObjectState(stub, slaContractObjectType, carrierID)
+	if err != nil || contractAsBytes == nil {
+		return nil, err
+	}
+	var contract SLAContract
+	err = json.Unmarshal(contractAsBytes, &contract)
+	return &contract, err
+}
+
+// penalty computes what a delivery late by the given duration past the grace period costs
+func (contract SLAContract) penalty(late time.Duration, amount float64) float64 {
+	var penalty float64
+	if contract.PenaltyType == penaltyPercentage {
+		penalty = amount * contract.PenaltyRate / 100
+	} else {
+		penalty = contract.PenaltyRate * math.Ceil(late.Hours())
+	}
+	if contract.MaxPenalty > 0 && penalty > contract.MaxPenalty {
+		penalty = contract.MaxPenalty
+	}
+	return roundAmount(penalty)
+}
+
+// recordSLAViolation checks a delivered shipment against the SLA of its carrier
+// and stores a violation with the computed penalty if it arrived late
+func recordSLAViolation(stub shim.ChaincodeStubInterface, shipment Shipment) error {
+	if shipment.ExpectedArrivedDate.IsZero() || len(shipment.Carrier.CarrierID) <= 0 {
+		return nil
+	}
+	contract, err := getSLAContract(stub, shipment.Carrier.CarrierID)
+	if err != nil || contract == nil {
+		return err
+	}
+	deadline := shipment.ExpectedArrivedDate.Add(time.Duration(contract.GracePeriodMinutes) * time.Minute)
+	if !shipment.RealArrivedDate.After(deadline) {
+		return nil
+	}
+	late := shipment.RealArrivedDate.Sub(deadline)
+
+	purchaseOrder, err := getPurchaseOrder(stub, shipment.PurchaseOrder.PurchaseOrderID)
+	if err != nil {
+		return err
+	}
+	collection, err := purchaseOrderCollection(stub, purchaseOrder)
+	if err != nil {
+		return err
+	}
+	// ==== A penalty per hour follows from public terms and is salted from the transaction alone ====
+	var price PrivatePrice
+	if contract.PenaltyType == penaltyPercentage {
+		if price, err = getPurchaseOrderPrice(stub, purchaseOrder); err != nil {
+			return err
+		}
+	}
+	penalty := PrivatePrice{Price: contract.penalty(late, price.Price), Salt: derivedSalt(stub, price.Salt)}
+
+	violation := SLAViolation{
+		ShipmentID:          shipment.ShipmentID,
+		CarrierID:           shipment.Carrier.CarrierID,
+		PurchaseOrderID:     shipment.PurchaseOrder.PurchaseOrderID,
+		ExpectedArrivedDate: shipment.ExpectedArrivedDate,
+		RealArrivedDate:     shipment.RealArrivedDate,
+		MinutesLate:         int(math.Ceil(late.Minutes())),
+		PenaltyType:         contract.PenaltyType,
+		PenaltyRate:         contract.PenaltyRate,
+		PenaltyCollection:   collection,
+		TxID:                stub.GetTxID(),
+	}
+	violation.PenaltyHash, err = putPrivatePrice(stub, collection, slaViolationObjectType, violation.ShipmentID, penalty)
+	if err != nil {
+		return err
+	}
+	violationAsBytes, err := json.Marshal(violation)
+	if err != nil {
+		return err
+	}
+	violationKey, err := stub.CreateCompositeKey(slaViolationObjectType, []string{violation.CarrierID, violation.RealArrivedDate.Format(sortableTimeLayout), violation.ShipmentID})
+	if err != nil {
+		return err
+	}
+	fmt.Println("- recordSLAViolation ", violation.ShipmentID, violation.MinutesLate)
+	return stub.PutState(violationKey, violationAsBytes)
+}
+
+// validateSLAContract checks a contract payload of setSLAContract
+func validateSLAContract(contract SLAContract) error {
+	v := newValidator("slaContract")
+	if contract.PenaltyType != penaltyPercentage && contract.PenaltyType != penaltyPerHour {
+		v.add("penaltyType", "must be %s or %s: %s", penaltyPercentage, penaltyPerHour, contract.PenaltyType)
+	}
+	if contract.GracePeriodMinutes < 0 {
+		v.add("gracePeriodMinutes", "must not be negative")
+	}
+	v.nonNegative("penaltyRate", contract.PenaltyRate)
+	if contract.PenaltyType == penaltyPercentage && contract.PenaltyRate > 100 {
+		v.add("penaltyRate", "must not exceed 100 for a percentage")
+	}
+	v.nonNegative("maxPenalty", contract.MaxPenalty)
+	return v.err()
+}
+
+// ===========================================================================
+// setSLAContract - create or replace the SLA contract of an active carrier,
+// by the network admin or a participant of the organization operating the carrier
+// args: carrierID, contract JSON {"gracePeriodMinutes", "penaltyType", "penaltyRate" [, "maxPenalty"]}
+// ===========================================================================
+func (t *SupplyChainChaincode) setSLAContract(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID and contract JSON")
+	}
+	carrierID := args[0]
+	if len(carrierID) <= 0 {
+		return shim.Error("carrierID must be a non-empty string")
+	}
+	fmt.Println("- start setSLAContract ", carrierID)
+
+	var contract SLAContract
+	if err := decodeInput("slaContract", args[1], &contract); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateSLAContract(contract); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== The carrier must be registered and active, its contract is kept by its own organization ====
+	carrier, err := getCarrier(stub, carrierID)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !carrier.Active {
+		return shim.Error("carrier is deactivated: " + carrierID)
+	}
+	if denied, err := checkOrganizationMaintainer(stub, "setSLAContract", carrier.OrganizationID); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	c, err := getCaller(stub)
+	if err != nil {
+		return shim.Error("Failed to resolve caller identity: " + err.Error())
+	}
+	previous, err := getSLAContract(stub, carrierID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	oldState := ""
+	if previous != nil {
+		oldState = previous.TxID
+	}
+	contract.CarrierID = carrierID
+	contract.PartyID = ""
+	if c.Participant != nil {
+		contract.PartyID = c.Participant.ParticipantID
+	}
+	contract.TxID = stub.GetTxID()
+	contractAsBytes, err := json.Marshal(contract)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putObjectState(stub, slaContractObjectType, carrierID, contractAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end setSLAContract")
+	if err = emitEvent(stub, SLAContractSet, carrierID, oldState, contract.TxID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(contractAsBytes)
+}
+
+// ===========================================================================
+// readSLAContract - the SLA contract of a carrier
+// ===========================================================================
+func (t *SupplyChainChaincode) readSLAContract(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID")
+	}
+	contractAsBytes, err := getObjectState(stub, slaContractObjectType, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if contractAsBytes == nil {
+		return shim.Error("no SLA contract for carrier: " + args[0])
+	}
+	return shim.Success(contractAsBytes)
+}
+
+// ===========================================================================
+// querySLAViolations - late deliveries of a carrier that arrived within [from, to].
+// An empty bound is open. Penalties are disclosed and totalled only where the caller's
+// MSP is a member of the pricing collection of the purchase order.
+// args: carrierID, from (RFC3339), to (RFC3339)
+// ===========================================================================
+func (t *SupplyChainChaincode) querySLAViolations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting carrierID, from and to")
+	}
+	var from, to time.Time
+	var err error
+	if len(args[1]) > 0 {
+		if from, err = time.Parse(time.RFC3339, args[1]); err != nil {
+			return shim.Error("from must be an RFC3339 date: " + err.Error())
+		}
+	}
+	if len(args[2]) > 0 {
+		if to, err = time.Parse(time.RFC3339, args[2]); err != nil {
+			return shim.Error("to must be an RFC3339 date: " + err.Error())
+		}
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(slaViolationObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Keys are in arrival order, stop at the first violation past the window ====
+	violations := []SLAViolationDisclosure{}
+	var totalPenalty float64
+	undisclosed := 0
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var violation SLAViolation
+		if err = json.Unmarshal(responseRange.Value, &violation); err != nil {
+			return shim.Error(err.Error())
+		}
+		if !from.IsZero() && violation.RealArrivedDate.Before(from) {
+			continue
+		}
+		if !to.IsZero() && violation.RealArrivedDate.After(to) {
+			break
+		}
+		disclosure := SLAViolationDisclosure{SLAViolation: violation}
+		if isCollectionMember(violation.PenaltyCollection, mspID) {
+			penalty, err := getPrivatePrice(stub, violation.PenaltyCollection, slaViolationObjectType, violation.ShipmentID, violation.PenaltyHash)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			disclosure.Penalty = &penalty.Price
+			totalPenalty += penalty.Price
+		} else {
+			undisclosed++
+		}
+		violations = append(violations, disclosure)
+	}
+
+	result := map[string]interface{}{
+		"carrierID":    args[0],
+		"from":         args[1],
+		"to":           args[2],
+		"violations":   violations,
+		"totalPenalty": roundAmount(totalPenalty),
+		"undisclosed":  undisclosed,
+	}
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(resultAsBytes)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateSLAContract(t *testing.T) {
+	tests := []struct {
+		contract SLAContract
+		want     []string
+	}{
+		{SLAContract{GracePeriodMinutes: 30, PenaltyType: penaltyPerHour, PenaltyRate: 250}, nil},
+		{SLAContract{PenaltyType: penaltyPercentage, PenaltyRate: 100, MaxPenalty: 500}, nil},
+		{SLAContract{PenaltyType: penaltyPercentage, PenaltyRate: 120}, []string{"penaltyRate"}},
+		{SLAContract{PenaltyType: "flat", GracePeriodMinutes: -5, PenaltyRate: -1, MaxPenalty: -1},
+			[]string{"penaltyType", "gracePeriodMinutes", "penaltyRate", "maxPenalty"}},
+	}
+	for _, tt := range tests {
+		if got := violationFields(t, validateSLAContract(tt.contract)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateSLAContract(%+v) violations = %v, want %v", tt.contract, got, tt.want)
+		}
+	}
+}
+
+func TestSLAContractParties(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	fleetManager := identity{MSPID: "Org3MSP", EnrollmentID: "User3@org3.example.com"}
+	s.mustCreateParticipant(networkAdmin, "manager03", network.carrierOrg, LogisticManager, fleetManager)
+	contract := `{"gracePeriodMinutes":30,"penaltyType":"perHour","penaltyRate":25}`
+
+	// ==== The seller cannot bind the carrier, the network admin and the carrier's organization can ====
+	s.mustDeny(sellerUser, "setSLAContract", "carrier01", contract)
+	s.mustInvoke(networkAdmin, "setSLAContract", "carrier01", contract)
+	payload := s.mustInvoke(fleetManager, "setSLAContract", "carrier01", `{"gracePeriodMinutes":60,"penaltyType":"perHour","penaltyRate":20}`)
+
+	var got SLAContract
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PartyID != "manager03" || got.GracePeriodMinutes != 60 {
+		t.Errorf("contract = %+v, want the 60 minutes grace period set by manager03", got)
+	}
+	s.mustDeny(sellerUser, "setSLAContract", "carrier01", contract)
+}
+
+func TestSLAPenaltyIsPrivate(t *testing.T) {
+	s, _ := newSupplyChainStub(t)
+	s.mustInvoke(networkAdmin, "setSLAContract", "carrier01", `{"gracePeriodMinutes":30,"penaltyType":"percentage","penaltyRate":10}`)
+	late := strings.Replace(shipmentPayload("purchase01"), "2019-03-03T08:00:00Z", "2019-02-28T20:00:00Z", 1)
+	late = strings.Replace(late, "2019-03-02T08:00:00Z", "2019-02-28T08:00:00Z", 1)
+	s.mustInvokeTransient(sellerUser, pricingTransient(1234.56, "salt01"), "createShipment", "shipment01", late)
+	s.mustInvoke(sellerUser, "validatePurchaseOrder", "purchase01")
+	s.mustInvoke(sellerUser, "updateShipmentState", "shipment01", "loading")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "loaded")
+	s.mustInvoke(driverUser, "updateShipmentState", "shipment01", "inTransit")
+	s.mustInvoke(buyerUser, "updateShipmentState", "shipment01", "deliveredComplete")
+
+	// ==== A 10% penalty would reveal the price, it is only disclosed to the buyer and seller ====
+	if keys := s.publicKeysContaining("123.46"); len(keys) > 0 {
+		t.Errorf("public state reveals the penalty under %q", keys)
+	}
+	tests := []struct {
+		by          identity
+		wantPenalty float64
+		undisclosed int
+	}{
+		{buyerUser, 123.46, 0},
+		{driverUser, 0, 1},
+	}
+	for _, tt := range tests {
+		var result struct {
+			Violations   []SLAViolationDisclosure `json:"violations"`
+			TotalPenalty float64                  `json:"totalPenalty"`
+			Undisclosed  int                      `json:"undisclosed"`
+		}
+		if err := json.Unmarshal(s.mustInvoke(tt.by, "querySLAViolations", "carrier01", "", ""), &result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Violations) != 1 || result.TotalPenalty != tt.wantPenalty || result.Undisclosed != tt.undisclosed {
+			t.Errorf("violations read by %s = %+v, want a total penalty of %.2f with %d undisclosed", tt.by.MSPID, result, tt.wantPenalty, tt.undisclosed)
+		}
+	}
+}
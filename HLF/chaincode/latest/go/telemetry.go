@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// readings are keyed by shipment, reading time and tx so concurrent devices never write the same key.
+// Thresholds are kept apart from the shipment document for the same reason.
+const (
+	telemetryObjectType  = "telemetry"
+	thresholdsObjectType = "thresholds"
+)
+
+// ComplianceThresholds are the limits a shipment must stay within. An unset bound is not checked.
+type ComplianceThresholds struct {
+	ShipmentID     string   `json:"shipmentID"`
+	MinTemperature *float64 `json:"minTemperature,omitempty"`
+	MaxTemperature *float64 `json:"maxTemperature,omitempty"`
+	MinHumidity    *float64 `json:"minHumidity,omitempty"`
+	MaxHumidity    *float64 `json:"maxHumidity,omitempty"`
+	MaxShock       *float64 `json:"maxShock,omitempty"`
+	SealRequired   bool     `json:"sealRequired"`
+}
+
+// TelemetryReading is one sensor sample of a shipment. Sensors that are not fitted are left out.
+type TelemetryReading struct {
+	ShipmentID  string    `json:"shipmentID"`
+	DeviceID    string    `json:"deviceID"`
+	ReadAt      time.Time `json:"readAt"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Humidity    *float64  `json:"humidity,omitempty"`
+	Shock       *float64  `json:"shock,omitempty"`
+	SealIntact  *bool     `json:"sealIntact,omitempty"`
+	Breaches    []string  `json:"breaches,omitempty"`
+	TxID        string    `json:"txID"`
+}
+
+// getComplianceThresholds loads the thresholds of a shipment, nil if none were configured
+func getComplianceThresholds(stub shim.ChaincodeStubInterface, shipmentID string) (*ComplianceThresholds, error) {
+	thresholdsAsBytes, err := getObjectState(stub, thresholdsObjectType, shipmentID)
+	if err != nil || thresholdsAsBytes == nil {
+		return nil, err
+	}
+	var thresholds ComplianceThresholds
+	err = json.Unmarshal(thresholdsAsBytes, &thresholds)
+	return &thresholds, err
+}
+
+// checkRange reports a breach when a value lies outside its configured bounds
+func checkRange(name string, value, min, max *float64) []string {
+	var breaches []string
+	if value == nil {
+		return breaches
+	}
+	if min != nil && *value < *min {
+		breaches = append(breaches, fmt.Sprintf("%s %.2f below minimum %.2f", name, *value, *min))
+	}
+	if max != nil && *value > *max {
+		breaches = append(breaches, fmt.Sprintf("%s %.2f above maximum %.2f", name, *value, *max))
+	}
+	return breaches
+}
+
+// breaches lists every threshold the reading violates
+func (thresholds ComplianceThresholds) breaches(reading TelemetryReading) []string {
+	var breaches []string
+	breaches = append(breaches, checkRange("temperature", reading.Temperature, thresholds.MinTemperature, thresholds.MaxTemperature)...)
+	breaches = append(breaches, checkRange("humidity", reading.Humidity, thresholds.MinHumidity, thresholds.MaxHumidity)...)
+	breaches = append(breaches, checkRange("shock", reading.Shock, nil, thresholds.MaxShock)...)
+	if thresholds.SealRequired && reading.SealIntact != nil && !*reading.SealIntact {
+		breaches = append(breaches, "seal broken")
+	}
+	return breaches
+}
+
+// checkShipmentMonitor checks that the caller may monitor a shipment: a participant of the
+// organization of its seller or of the one operating its carrier, whose devices report on it
+func checkShipmentMonitor(stub shim.ChaincodeStubInterface, function string, status ShipmentStatus) (*accessDenied, error) {
+	c, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	if !isCallerOrganization(c, status.SellerOrganizationID, status.CarrierOrganizationID) {
+		return newAccessDenied(c, function, "only the seller or carrier of shipment "+status.ShipmentID+" can monitor it"), nil
+	}
+	return nil, nil
+}
+
+// validateComplianceThresholds checks a thresholds payload, each lower bound must not exceed its upper bound
+func validateComplianceThresholds(thresholds ComplianceThresholds) error {
+	v := newValidator("thresholds")
+	if thresholds.MinTemperature != nil && thresholds.MaxTemperature != nil && *thresholds.MinTemperature > *thresholds.MaxTemperature {
+		v.add("minTemperature", "must not exceed maxTemperature")
+	}
+	if thresholds.MinHumidity != nil && thresholds.MaxHumidity != nil && *thresholds.MinHumidity > *thresholds.MaxHumidity {
+		v.add("minHumidity", "must not exceed maxHumidity")
+	}
+	if thresholds.MaxShock != nil {
+		v.nonNegative("maxShock", *thresholds.MaxShock)
+	}
+	return v.err()
+}
+
+// validateTelemetryReading checks a reading payload of recordTelemetry, which must carry at least one sensor
+func validateTelemetryReading(reading TelemetryReading) error {
+	v := newValidator("reading")
+	if reading.Temperature == nil && reading.Humidity == nil && reading.Shock == nil && reading.SealIntact == nil {
+		v.add("", "must contain temperature, humidity, shock or sealIntact")
+	}
+	if reading.Shock != nil {
+		v.nonNegative("shock", *reading.Shock)
+	}
+	return v.err()
+}
+
+// ===========================================================================
+// setComplianceThresholds - configure the compliance limits of a shipment,
+// by its seller or carrier
+// args: shipmentID, thresholds JSON
+// ===========================================================================
+func (t *SupplyChainChaincode) setComplianceThresholds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and thresholds JSON")
+	}
+	shipmentID := args[0]
+	fmt.Println("- start setComplianceThresholds ", shipmentID)
+
+	var thresholds ComplianceThresholds
+	if err := decodeInput("thresholds", args[1], &thresholds); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateComplianceThresholds(thresholds); err != nil {
+		return shim.Error(err.Error())
+	}
+	status, err := checkShipmentWritable(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if denied, err := checkShipmentMonitor(stub, "setComplianceThresholds", status); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	thresholds.ShipmentID = shipmentID
+
+	thresholdsAsBytes, err := json.Marshal(thresholds)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putObjectState(stub, thresholdsObjectType, shipmentID, thresholdsAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	fmt.Println("- end setComplianceThresholds")
+	if err = emitEvent(stub, ComplianceThresholdsSet, shipmentID, "", "configured"); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(thresholdsAsBytes)
+}
+
+// ===========================================================================
+// recordTelemetry - store one sensor reading of a shipment, sent by its seller or carrier.
+// A reading outside the thresholds marks the shipment non-compliant and opens a dispute on it.
+// args: shipmentID, reading JSON {"deviceID", "readAt", "temperature", "humidity", "shock", "sealIntact"}
+// ===========================================================================
+func (t *SupplyChainChaincode) recordTelemetry(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID and reading JSON")
+	}
+	shipmentID := args[0]
+
+	var reading TelemetryReading
+	if err := decodeInput("reading", args[1], &reading); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateTelemetryReading(reading); err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if reading.ReadAt.IsZero() {
+		reading.ReadAt = txTime
+	}
+	reading.ReadAt = reading.ReadAt.UTC()
+	reading.ShipmentID = shipmentID
+	reading.TxID = stub.GetTxID()
+
+	// ==== Devices report concurrently, the hot path reads the status and threshold keys, never the shipment ====
+	status, err := checkShipmentWritable(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if denied, err := checkShipmentMonitor(stub, "recordTelemetry", status); err != nil {
+		return shim.Error(err.Error())
+	} else if denied != nil {
+		return denyAccess(stub, denied)
+	}
+	thresholds, err := getComplianceThresholds(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if thresholds != nil {
+		reading.Breaches = thresholds.breaches(reading)
+	}
+
+	readingAsBytes, err := json.Marshal(reading)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	readingKey, err := stub.CreateCompositeKey(telemetryObjectType, []string{shipmentID, reading.ReadAt.Format(sortableTimeLayout), reading.TxID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(readingKey, readingAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(reading.Breaches) <= 0 {
+		if err = emitEvent(stub, TelemetryRecorded, shipmentID, "", reading.ReadAt.Format(time.RFC3339Nano)); err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(readingAsBytes)
+	}
+
+	// ==== Breach: mark the shipment and open a dispute unless one is already open ====
+	reason := "compliance breach: " + strings.Join(reading.Breaches, ", ")
+	fmt.Println("- recordTelemetry ", shipmentID, reason)
+	shipment, err := getWritableShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	oldState := complianceState(shipment.NonCompliant)
+	if !shipment.Dispute {
+		shipment.NonCompliant = true
+		if _, err = openDispute(stub, shipment, reason, ""); err != nil {
+			return shim.Error(err.Error())
+		}
+	} else if !shipment.NonCompliant {
+		// ==== Repeated breaches leave the shipment document alone so devices do not conflict on it ====
+		shipment.NonCompliant = true
+		if _, err = putShipment(stub, shipment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err = emitEvent(stub, ComplianceBreached, shipmentID, oldState, complianceState(true)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(readingAsBytes)
+}
+
+// complianceState names the compliance flag of a shipment in events
+func complianceState(nonCompliant bool) string {
+	if nonCompliant {
+		return "nonCompliant"
+	}
+	return "compliant"
+}
+
+// ===========================================================================
+// getTelemetry - the readings of a shipment in reading time order
+// args: shipmentID
+// ===========================================================================
+func (t *SupplyChainChaincode) getTelemetry(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(telemetryObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	readings := []TelemetryReading{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var reading TelemetryReading
+		if err = json.Unmarshal(responseRange.Value, &reading); err != nil {
+			return shim.Error(err.Error())
+		}
+		readings = append(readings, reading)
+	}
+	readingsAsBytes, err := json.Marshal(readings)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(readingsAsBytes)
+}
+
+// ===========================================================================
+// readComplianceThresholds - the compliance limits configured for a shipment
+// ===========================================================================
+func (t *SupplyChainChaincode) readComplianceThresholds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	thresholdsAsBytes, err := getObjectState(stub, thresholdsObjectType, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if thresholdsAsBytes == nil {
+		return shim.Error("no compliance thresholds for shipment: " + args[0])
+	}
+	return shim.Success(thresholdsAsBytes)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateComplianceThresholds(t *testing.T) {
+	low, high, negative := 2.0, 8.0, -1.0
+	tests := []struct {
+		thresholds ComplianceThresholds
+		want       []string
+	}{
+		{ComplianceThresholds{MinTemperature: &low, MaxTemperature: &high, MaxShock: &high}, nil},
+		{ComplianceThresholds{MinHumidity: &high}, nil},
+		{ComplianceThresholds{MinTemperature: &high, MaxTemperature: &low, MinHumidity: &high, MaxHumidity: &low, MaxShock: &negative},
+			[]string{"minTemperature", "minHumidity", "maxShock"}},
+	}
+	for _, tt := range tests {
+		if got := violationFields(t, validateComplianceThresholds(tt.thresholds)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateComplianceThresholds(%+v) violations = %v, want %v", tt.thresholds, got, tt.want)
+		}
+	}
+}
+
+func TestTelemetryParties(t *testing.T) {
+	s, network := newSupplyChainStub(t)
+	s.mustInvoke(sellerUser, "createShipment", "shipment01", shipmentPayload("purchase01"))
+	reading := `{"deviceID":"sensor01","temperature":4.5}`
+
+	// ==== The seller configures the limits, the devices of the carrier's organization report ====
+	s.mustDeny(buyerUser, "setComplianceThresholds", "shipment01", `{"maxTemperature":8}`)
+	s.mustInvoke(sellerUser, "setComplianceThresholds", "shipment01", `{"maxTemperature":8}`)
+	s.mustDeny(buyerDriverUser, "recordTelemetry", "shipment01", reading)
+	s.mustInvoke(driverUser, "recordTelemetry", "shipment01", reading)
+
+	// ==== Handing the shipment to another carrier hands the monitoring over with it ====
+	s.mustInvoke(networkAdmin, "createCarrier", `{"carrierID":"carrier02","organizationID":"`+network.buyerOrg+`","name":"Buyer Fleet","scac":"BFLT","modes":["road"]}`)
+	s.mustInvoke(sellerUser, "transferShipment", "shipment01", `{"carrierID":"carrier02"}`)
+	s.mustDeny(driverUser, "recordTelemetry", "shipment01", reading)
+	s.mustInvoke(buyerDriverUser, "recordTelemetry", "shipment01", reading)
+	if event := s.lastEvent(); event.EventType != TelemetryRecorded || event.ActorMSP != buyerDriverUser.MSPID {
+		t.Errorf("last event = %+v, want %s by %s", event, TelemetryRecorded, buyerDriverUser.MSPID)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ShipmentVersion is one ledger version of a shipment, Shipment is nil for a delete
+type ShipmentVersion struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Shipment  *Shipment `json:"shipment,omitempty"`
+}
+
+// LogisticsUnitVersion is one ledger version of a logistics unit, Unit is nil for a delete
+type LogisticsUnitVersion struct {
+	TxID      string         `json:"txID"`
+	Timestamp time.Time      `json:"timestamp"`
+	IsDelete  bool           `json:"isDelete"`
+	Unit      *LogisticsUnit `json:"unit,omitempty"`
+}
+
+// LogisticsUnitTrace is the history of one logistics unit of a shipment: its packaging
+// (parentID) and location changes
+type LogisticsUnitTrace struct {
+	LogisticsUnitID string                 `json:"logisticsUnitID"`
+	History         []LogisticsUnitVersion `json:"history"`
+}
+
+// ShipmentTraceability gathers what is on the ledger about the movements of a shipment,
+// the input of the off-chain EPCIS converter (HLF/tools/epcis)
+type ShipmentTraceability struct {
+	ShipmentID     string               `json:"shipmentID"`
+	History        []ShipmentVersion    `json:"history"`
+	LogisticsUnits []LogisticsUnitTrace `json:"logisticsUnits"`
+	Route          []PositionFix        `json:"route"`
+}
+
+// objectVersion is one entry of the ledger history of an object
+type objectVersion struct {
+	TxID      string
+	Timestamp time.Time
+	IsDelete  bool
+	Value     []byte
+}
+
+// getObjectHistory reads every version of an object, oldest first
+func getObjectHistory(stub shim.ChaincodeStubInterface, objectType, id string) ([]objectVersion, error) {
+	objectKey, err := stub.CreateCompositeKey(objectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := stub.GetHistoryForKey(objectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	versions := []objectVersion{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		version := objectVersion{TxID: response.TxId, IsDelete: response.IsDelete, Value: response.Value}
+		if response.Timestamp != nil {
+			version.Timestamp = time.Unix(response.Timestamp.Seconds, int64(response.Timestamp.Nanos)).UTC()
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// getShipmentUnitIDs lists the logistics units of a shipment: the units created for it and
+// the product lines of its purchase order, in that order and without duplicates
+func getShipmentUnitIDs(stub shim.ChaincodeStubInterface, shipment Shipment) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(logisticsUnitObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	unitIDs := []string{}
+	seen := map[string]bool{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var unit LogisticsUnit
+		if err = json.Unmarshal(responseRange.Value, &unit); err != nil {
+			return nil, err
+		}
+		if unit.ShipmentID == shipment.ShipmentID && !seen[unit.LogisticsUnitID] {
+			seen[unit.LogisticsUnitID] = true
+			unitIDs = append(unitIDs, unit.LogisticsUnitID)
+		}
+	}
+	for _, line := range shipment.PurchaseOrder.Product {
+		if len(line.LogisticsUnitID) <= 0 || seen[line.LogisticsUnitID] {
+			continue
+		}
+		unitAsBytes, err := getObjectState(stub, logisticsUnitObjectType, line.LogisticsUnitID)
+		if err != nil {
+			return nil, err
+		} else if unitAsBytes != nil {
+			seen[line.LogisticsUnitID] = true
+			unitIDs = append(unitIDs, line.LogisticsUnitID)
+		}
+	}
+	return unitIDs, nil
+}
+
+// ===========================================================================
+// getShipmentTraceability - ledger history of a shipment, of its logistics units and its GPS track,
+// converted off-chain into GS1 EPCIS events by HLF/tools/epcis
+// args: shipmentID
+// ===========================================================================
+func (t *SupplyChainChaincode) getShipmentTraceability(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting shipmentID")
+	}
+	shipmentID := args[0]
+	fmt.Println("- start getShipmentTraceability ", shipmentID)
+
+	shipment, err := getShipment(stub, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	trace := ShipmentTraceability{ShipmentID: shipmentID, History: []ShipmentVersion{}, LogisticsUnits: []LogisticsUnitTrace{}}
+
+	versions, err := getObjectHistory(stub, shipmentObjectType, shipmentID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, version := range versions {
+		entry := ShipmentVersion{TxID: version.TxID, Timestamp: version.Timestamp, IsDelete: version.IsDelete}
+		if !version.IsDelete {
+			entry.Shipment = &Shipment{}
+			if err = json.Unmarshal(version.Value, entry.Shipment); err != nil {
+				return shim.Error("failed to decode shipment version " + version.TxID + ": " + err.Error())
+			}
+		}
+		trace.History = append(trace.History, entry)
+	}
+
+	unitIDs, err := getShipmentUnitIDs(stub, shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, unitID := range unitIDs {
+		versions, err := getObjectHistory(stub, logisticsUnitObjectType, unitID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		unitTrace := LogisticsUnitTrace{LogisticsUnitID: unitID, History: []LogisticsUnitVersion{}}
+		for _, version := range versions {
+			entry := LogisticsUnitVersion{TxID: version.TxID, Timestamp: version.Timestamp, IsDelete: version.IsDelete}
+			if !version.IsDelete {
+				entry.Unit = &LogisticsUnit{}
+				if err = json.Unmarshal(version.Value, entry.Unit); err != nil {
+					return shim.Error("failed to decode logistics unit version " + version.TxID + ": " + err.Error())
+				}
+			}
+			unitTrace.History = append(unitTrace.History, entry)
+		}
+		trace.LogisticsUnits = append(trace.LogisticsUnits, unitTrace)
+	}
+
+	if trace.Route, err = getPositionFixes(stub, shipmentID); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	traceAsBytes, err := json.Marshal(trace)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(traceAsBytes)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Violation is one invalid field of an input payload. Field is the JSON path of the field.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned to the client as JSON so every invalid field can be reported at once
+type ValidationError struct {
+	Object     string      `json:"object"`
+	Violations []Violation `json:"violations"`
+}
+
+// Error renders the violations as a JSON document
+func (e *ValidationError) Error() string {
+	errorAsBytes, err := json.Marshal(e)
+	if err != nil {
+		return "invalid " + e.Object
+	}
+	return string(errorAsBytes)
+}
+
+// fieldError is returned by the enum decoders so decoding failures name the offending field
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// validator collects the violations of one payload
+type validator struct {
+	object     string
+	violations []Violation
+}
+
+func newValidator(object string) *validator {
+	return &validator{object: object}
+}
+
+// add records a violation
+func (v *validator) add(field, format string, a ...interface{}) {
+	v.violations = append(v.violations, Violation{Field: field, Message: fmt.Sprintf(format, a...)})
+}
+
+// required checks that a string field is not empty
+func (v *validator) required(field, value string) {
+	if len(value) <= 0 {
+		v.add(field, "is required")
+	}
+}
+
+// requiredDate checks that a date field was supplied
+func (v *validator) requiredDate(field string, value time.Time) {
+	if value.IsZero() {
+		v.add(field, "is required as an RFC3339 date")
+	}
+}
+
+// nonNegative checks that a number field is zero or more
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+// location checks the coordinates of a location, which are optional but come in pairs
+func (v *validator) location(field string, location Location) {
+	if (location.Latitude == nil) != (location.Longitude == nil) {
+		v.add(field, "latitude and longitude must be given together")
+		return
+	}
+	if location.Latitude == nil {
+		return
+	}
+	if *location.Latitude < -90 || *location.Latitude > 90 {
+		v.add(field+".latitude", "must be between -90 and 90")
+	}
+	if *location.Longitude < -180 || *location.Longitude > 180 {
+		v.add(field+".longitude", "must be between -180 and 180")
+	}
+}
+
+// err returns the collected violations as a ValidationError, nil if there are none
+func (v *validator) err() error {
+	if len(v.violations) <= 0 {
+		return nil
+	}
+	return &ValidationError{Object: v.object, Violations: v.violations}
+}
+
+// decodeInput decodes a JSON argument, turning any decoding failure into a ValidationError
+func decodeInput(object, payload string, target interface{}) error {
+	err := json.Unmarshal([]byte(payload), target)
+	if err == nil {
+		return nil
+	}
+	v := newValidator(object)
+	switch cause := err.(type) {
+	case *json.SyntaxError:
+		v.add("", "malformed JSON at offset %d: %s", cause.Offset, cause.Error())
+	case *json.UnmarshalTypeError:
+		v.add(cause.Field, "expected %s, got JSON %s", cause.Type.String(), cause.Value)
+	case *fieldError:
+		v.add(cause.Field, "%s", cause.Message)
+	case *time.ParseError:
+		v.add("", "dates must be RFC3339 such as 2018-06-05T17:00:00Z, got %s", cause.Value)
+	default:
+		v.add("", "%s", err.Error())
+	}
+	return v.err()
+}
+
+// enumValue is the raw text of a JSON enum, a name or a number either quoted or not
+func enumValue(data []byte) string {
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	return value
+}
+
+// UnmarshalJSON accepts the state name, e.g. "loaded", as well as its number
+func (n *ShipmentOrderState) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	state, err := parseShipmentOrderState(enumValue(data))
+	if err != nil {
+		return &fieldError{Field: "shipmentOrderState", Message: err.Error()}
+	}
+	*n = state
+	return nil
+}
+
+// UnmarshalJSON accepts the state name, e.g. "Validated", as well as its number
+func (n *PurchaseOrderState) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	state, err := parsePurchaseOrderState(enumValue(data))
+	if err != nil {
+		return &fieldError{Field: "state", Message: err.Error()}
+	}
+	*n = state
+	return nil
+}
+
+// UnmarshalJSON accepts the role name, e.g. "seller", as well as its number
+func (r *Role) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	role, err := parseRole(enumValue(data))
+	if err != nil {
+		return &fieldError{Field: "role", Message: err.Error()}
+	}
+	*r = role
+	return nil
+}
+
+// validateShipment checks a shipment payload of createShipment
+func validateShipment(shipment Shipment) error {
+	v := newValidator("shipment")
+	v.required("carrier.carrierID", shipment.Carrier.CarrierID)
+	v.required("customerID.customerID", shipment.Customer.CustomerID)
+	v.requiredDate("expectedDepartureDate", shipment.ExpectedDepartureDate)
+	v.requiredDate("expectedArrivedDate", shipment.ExpectedArrivedDate)
+	if shipment.ExpectedArrivedDate.Before(shipment.ExpectedDepartureDate) {
+		v.add("expectedArrivedDate", "must not be before expectedDepartureDate")
+	}
+	if !shipment.RealDepartureDate.IsZero() {
+		v.add("realDepartureDate", "is set by the ledger and must not be supplied")
+	}
+	if !shipment.RealArrivedDate.IsZero() {
+		v.add("realArrivedDate", "is set by the ledger and must not be supplied")
+	}
+	v.location("location", shipment.Location)
+	v.purchaseOrder("purchaseOrder", shipment.PurchaseOrder)
+	return v.err()
+}
+
+// purchaseOrder checks a purchase order embedded in a shipment
+func (v *validator) purchaseOrder(field string, purchaseOrder PurchaseOrder) {
+	v.required(field+".purchaseOrderID", purchaseOrder.PurchaseOrderID)
+	v.location(field+".shipTO", purchaseOrder.ShipTO)
+	for i, line := range purchaseOrder.Product {
+		lineField := fmt.Sprintf("%s.product[%d]", field, i)
+		v.required(lineField+".logisticsUnitID", line.LogisticsUnitID)
+		if line.Quantity <= 0 {
+			v.add(lineField+".quantity", "must be at least 1")
+		}
+	}
+}
+
+// validateLogisticsUnit checks a logistics unit payload of createLogisticUnit
+func validateLogisticsUnit(unit LogisticsUnit) error {
+	v := newValidator("logisticsUnit")
+	v.required("logisticsUnitID", unit.LogisticsUnitID)
+	if _, known := packagingLevels[unit.Type]; !known {
+		v.add("type", "must be one of unit, pallet or container: %s", unit.Type)
+	}
+	v.nonNegative("size", unit.Size)
+	v.nonNegative("weight", unit.Weight)
+	if unit.Quantity < 0 {
+		v.add("quantity", "must not be negative")
+	}
+	v.location("location", unit.Location)
+	return v.err()
+}
+
+// validateLocation checks a location payload
+func validateLocation(location Location) error {
+	v := newValidator("location")
+	v.location("location", location)
+	return v.err()
+}
+
+// validateOrganization checks an organization payload
+func validateOrganization(org Organization) error {
+	v := newValidator("organization")
+	v.required("name", org.Name)
+	v.required("mspID", org.MSPID)
+	return v.err()
+}
+
+// validateParticipant checks a participant payload of createParticipantUser
+func validateParticipant(participant ParticipantUser) error {
+	v := newValidator("participant")
+	v.required("participantID", participant.ParticipantID)
+	v.required("organization.organizationID", participant.Organization.OrganizationID)
+	v.required("mspID", participant.MSPID)
+	v.required("enrollmentID", participant.EnrollmentID)
+	if participant.Role < customer || participant.Role > LogisticManager {
+		v.add("role", "unknown role: %d", int(participant.Role))
+	}
+	return v.err()
+}
+
+// validateTransfer checks a transferShipment payload, which must name a new owner, a new carrier or both
+func validateTransfer(transfer ShipmentTransfer) error {
+	v := newValidator("transfer")
+	if len(transfer.OwnerID) <= 0 && len(transfer.CarrierID) <= 0 {
+		v.add("ownerID", "is required unless carrierID is given")
+	}
+	return v.err()
+}
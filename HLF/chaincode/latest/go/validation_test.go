@@ -0,0 +1,178 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// violationFields lists the fields reported by a validation error, nil when err is nil
+func violationFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError, got %T: %v", err, err)
+	}
+	var fields []string
+	for _, violation := range validationErr.Violations {
+		fields = append(fields, violation.Field)
+	}
+	return fields
+}
+
+func validShipment() Shipment {
+	latitude, longitude := Coordinate(48.8566), Coordinate(2.3522)
+	departure := time.Date(2018, 6, 5, 8, 0, 0, 0, time.UTC)
+	return Shipment{
+		Carrier:               Carrier{CarrierID: "3rdPartyLogistic"},
+		Customer:              Customer{CustomerID: "customerID01"},
+		Location:              Location{Latitude: &latitude, Longitude: &longitude},
+		ExpectedDepartureDate: departure,
+		ExpectedArrivedDate:   departure.Add(9 * time.Hour),
+		PurchaseOrder: PurchaseOrder{
+			PurchaseOrderID: "purchase01",
+			Product:         []LogisticsUnit{{LogisticsUnitID: "unit01", Quantity: 2}},
+		},
+	}
+}
+
+func TestValidateShipment(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Shipment)
+		want   []string
+	}{
+		{"valid", func(s *Shipment) {}, nil},
+		{"missing carrier and customer", func(s *Shipment) {
+			s.Carrier.CarrierID = ""
+			s.Customer.CustomerID = ""
+		}, []string{"carrier.carrierID", "customerID.customerID"}},
+		{"arrival before departure", func(s *Shipment) {
+			s.ExpectedArrivedDate = s.ExpectedDepartureDate.Add(-time.Hour)
+		}, []string{"expectedArrivedDate"}},
+		{"missing departure", func(s *Shipment) {
+			s.ExpectedDepartureDate = time.Time{}
+		}, []string{"expectedDepartureDate"}},
+		{"real dates supplied", func(s *Shipment) {
+			s.RealDepartureDate = s.ExpectedDepartureDate
+			s.RealArrivedDate = s.ExpectedArrivedDate
+		}, []string{"realDepartureDate", "realArrivedDate"}},
+		{"latitude without longitude", func(s *Shipment) {
+			s.Location.Longitude = nil
+		}, []string{"location"}},
+		{"coordinates off the globe", func(s *Shipment) {
+			latitude, longitude := Coordinate(91), Coordinate(-181)
+			s.Location.Latitude, s.Location.Longitude = &latitude, &longitude
+		}, []string{"location.latitude", "location.longitude"}},
+		{"invalid product line", func(s *Shipment) {
+			s.PurchaseOrder.PurchaseOrderID = ""
+			s.PurchaseOrder.Product = []LogisticsUnit{{Quantity: 0}}
+		}, []string{"purchaseOrder.purchaseOrderID", "purchaseOrder.product[0].logisticsUnitID", "purchaseOrder.product[0].quantity"}},
+	}
+	for _, tt := range tests {
+		shipment := validShipment()
+		tt.mutate(&shipment)
+		if got := violationFields(t, validateShipment(shipment)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateParticipant(t *testing.T) {
+	valid := ParticipantUser{
+		ParticipantID: "seller01",
+		Organization:  Organization{OrganizationID: "org01"},
+		Role:          seller,
+		MSPID:         "Org1MSP",
+		EnrollmentID:  "User1@org1.example.com",
+	}
+	tests := []struct {
+		name   string
+		mutate func(*ParticipantUser)
+		want   []string
+	}{
+		{"valid", func(p *ParticipantUser) {}, nil},
+		{"missing identity", func(p *ParticipantUser) {
+			p.MSPID = ""
+			p.EnrollmentID = ""
+		}, []string{"mspID", "enrollmentID"}},
+		{"missing organization", func(p *ParticipantUser) {
+			p.Organization.OrganizationID = ""
+		}, []string{"organization.organizationID"}},
+		{"unknown role", func(p *ParticipantUser) {
+			p.Role = LogisticManager + 1
+		}, []string{"role"}},
+	}
+	for _, tt := range tests {
+		participant := valid
+		tt.mutate(&participant)
+		if got := violationFields(t, validateParticipant(participant)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTransfer(t *testing.T) {
+	tests := []struct {
+		transfer ShipmentTransfer
+		want     []string
+	}{
+		{ShipmentTransfer{OwnerID: "buyer01"}, nil},
+		{ShipmentTransfer{CarrierID: "3rdPartyLogistic"}, nil},
+		{ShipmentTransfer{}, []string{"ownerID"}},
+	}
+	for _, tt := range tests {
+		if got := violationFields(t, validateTransfer(tt.transfer)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateTransfer(%+v) violations = %v, want %v", tt.transfer, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		{"valid", `{"shipmentOrderState":"loaded","expectedDepartureDate":"2018-06-05T17:00:00Z"}`, nil},
+		{"numeric state", `{"shipmentOrderState":2}`, nil},
+		{"malformed JSON", `{"shipmentID":`, []string{""}},
+		{"wrong type", `{"shipmentID":12}`, []string{"shipmentID"}},
+		{"unknown state", `{"shipmentOrderState":"lost"}`, []string{"shipmentOrderState"}},
+		{"non RFC3339 date", `{"expectedDepartureDate":"05/06/2018"}`, []string{""}},
+	}
+	for _, tt := range tests {
+		var shipment Shipment
+		if got := violationFields(t, decodeInput("shipment", tt.payload, &shipment)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnumUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    PurchaseOrderState
+		wantErr bool
+	}{
+		{`{"state":"Shipped"}`, Shipped, false},
+		{`{"state":"3"}`, Shipped, false},
+		{`{"state":3}`, Shipped, false},
+		{`{"state":null}`, AwaitingValidation, false},
+		{`{"state":"Lost"}`, AwaitingValidation, true},
+	}
+	for _, tt := range tests {
+		var purchaseOrder PurchaseOrder
+		err := decodeInput("purchaseOrder", tt.payload, &purchaseOrder)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.payload, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && purchaseOrder.State != tt.want {
+			t.Errorf("%s: state = %s, want %s", tt.payload, purchaseOrder.State, tt.want)
+		}
+	}
+}
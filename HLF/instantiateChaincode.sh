@@ -16,6 +16,11 @@ export CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/pee
 export CORE_PEER_LOCALMSPID="Org1MSP"
 export CORE_PEER_ADDRESS="dev-peer0-xyz:7051"
 export CHANNEL_NAME="mychannel"
+# MSP whose supplychain.admin=true identities administer the chaincode
+export ADMIN_MSP="Org1MSP"
+# enrollment ID of the admin of ADMIN_MSP allowed to deposit funds
+export CLEARING_ADMIN="clearing-admin"
+export COLLECTIONS_CONFIG=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/crypto-config/opensource.com/HLF/chaincode/latest/go/collections_config.json
 #instantiating chaincode
 
-kubectl exec $CLI_POD_ID -it -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_MSPCONFIGPATH=$CORE_PEER_MSPCONFIGPATH && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode instantiate -o $ORDERER_ADDR -C $CHANNEL_NAME -n supplychain -v 1.0 -c '{\"Args\":[\"init\",\" \"]}' -P \"OR ('Org1MSP.peer','Org2MSP.peer')\""
+kubectl exec $CLI_POD_ID -it -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_MSPCONFIGPATH=$CORE_PEER_MSPCONFIGPATH && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode instantiate -o $ORDERER_ADDR -C $CHANNEL_NAME -n supplychain -v 1.0 -c '{\"Args\":[\"init\",\"$ADMIN_MSP\",\"$CLEARING_ADMIN\"]}' -P \"OR ('Org1MSP.peer','Org2MSP.peer')\" --collections-config $COLLECTIONS_CONFIG"
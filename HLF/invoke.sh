@@ -12,13 +12,40 @@ export GENESIS_BLOCK=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/c
 export CLI_POD_ID=`kubectl get pod | grep cli | cut -f1 -d' '`
 export ORDERER_ADDR="dev-orderer-g746q:7050"
 export ORG_DOMAIN="org1.example.com"
+# the buyer's organization, registered by the network admin of Org1MSP
+export BUYER_ORG_DOMAIN="org2.example.com"
 export CHAINCODE_PATH=github.com/hyperledger/fabric/peer/crypto/crypto-config/opensource.com/HLF/chaincode/chaincode_example02/go
 export CORE_PEER_MSPCONFIGPATH=/etc/crypto-config/opensource.com/HLF/crypto-config/peerOrganizations/$ORG_DOMAIN/users/Admin@$ORG_DOMAIN/msp
 export CORE_PEER_LOCALMSPID="Org1MSP"
 export CORE_PEER_ADDRESS="dev-peer0-xyz:7051"
 export CHANNEL_NAME="mychannel"
-# invoke 
+# registry maintainer of the admin MSP, enrolled from the Org1 CA with the admin attribute:
+# fabric-ca-client register --id.name supplychain-admin --id.attrs 'supplychain.admin=true:ecert'
+export ADMIN_MSPCONFIGPATH=/etc/crypto-config/opensource.com/HLF/crypto-config/peerOrganizations/$ORG_DOMAIN/users/supplychain-admin@$ORG_DOMAIN/msp
+# the seller signs createShipment, its participant is bound to the User1 certificate
+export SELLER_MSPCONFIGPATH=/etc/crypto-config/opensource.com/HLF/crypto-config/peerOrganizations/$ORG_DOMAIN/users/User1@$ORG_DOMAIN/msp
+
+# invoke <msp config path> <chaincode input JSON>, waiting for the commit so the next call sees it
+invoke() {
+	kubectl exec $CLI_POD_ID -it -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_MSPCONFIGPATH=$1 && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode invoke -o $ORDERER_ADDR -C $CHANNEL_NAME -n supplychain --waitForEvent -c '$2'"
+}
+
+# query <msp config path> <chaincode input JSON>
+query() {
+	kubectl exec $CLI_POD_ID -i -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_MSPCONFIGPATH=$1 && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode query -C $CHANNEL_NAME -n supplychain -c '$2'"
+}
 
 set -x
-kubectl exec $CLI_POD_ID -it -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode invoke -o $ORDERER_ADDR -C $CHANNEL_NAME -n supplychain -v 1.0 -c '{\"Args\":[\"createShipment\",\"shipment01\",\"{\\\"objectType\\\": \\\"shipment\\\",\\\"shipmentID\\\": \\\"shipment01\\\",\\\"purchaseOrder\\\": {\\\"purchaseOrderID\\\": \\\"purchase01\\\", \\\"ref\\\": \\\"987667eye56728yx87q80j\\\", \\\"shipmentOrderedState\\\": \\\"deliverywaiting\\\", \\\"orderDate\\\": \\\"2018-06-05T17:00:00Z\\\" }, \\\"customer\\\": { \\\"customerID\\\": \\\"customerID01\\\" }, \\\"carrier\\\": { \\\"carrierID\\\": \\\"3rdPartyLogistic\\\" }, \\\"location\\\": { \\\"latitude\\\": \\\"48.8566\\\", \\\"longitude\\\": \\\"2.3522\\\", \\\"address\\\": \\\"paris\\\", \\\"dock\\\": \\\"ns\\\" }, \\\"expectedDepartureDate\\\": \\\"2018-06-05T17:00:00Z\\\", \\\"expectedArrivedDate\\\": \\\"2018-06-05T17:00:00Z\\\", \\\"realDepartureDate\\\": \\\"2018-06-05T17:00:00Z\\\", \\\"realArrivedDate\\\": \\\"2018-06-05T17:00:00Z\\\", \\\"shipmentOrderedState\\\": \\\"loaded\\\", \\\"dispute\\\": false, \\\"reasonDispute\\\": \\\"na\\\" }\"]}'"
+# ==== register the seller and buyer organizations with their participants, the carrier and the customer the shipment references ====
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createOrganization","{\"name\":\"Org1\",\"mspID\":\"Org1MSP\"}"]}'
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createOrganization","{\"name\":\"Org2\",\"mspID\":\"Org2MSP\"}"]}'
+ORGANIZATION_ID=`query $ADMIN_MSPCONFIGPATH '{"Args":["getOrganizationbyName","Org1"]}' | sed -n 's/.*"organizationID":"\([^"]*\)".*/\1/p'`
+BUYER_ORGANIZATION_ID=`query $ADMIN_MSPCONFIGPATH '{"Args":["getOrganizationbyName","Org2"]}' | sed -n 's/.*"organizationID":"\([^"]*\)".*/\1/p'`
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createParticipantUser","{\"participantID\":\"seller01\",\"name\":\"Seller\",\"organization\":{\"organizationID\":\"'$ORGANIZATION_ID'\"},\"role\":\"seller\",\"mspID\":\"Org1MSP\",\"enrollmentID\":\"User1@'$ORG_DOMAIN'\"}"]}'
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createParticipantUser","{\"participantID\":\"buyer01\",\"name\":\"Buyer\",\"organization\":{\"organizationID\":\"'$BUYER_ORGANIZATION_ID'\"},\"role\":\"customer\",\"mspID\":\"Org2MSP\",\"enrollmentID\":\"User1@'$BUYER_ORG_DOMAIN'\"}"]}'
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createCarrier","{\"carrierID\":\"3rdPartyLogistic\",\"organizationID\":\"'$ORGANIZATION_ID'\",\"name\":\"Third Party Logistic\",\"scac\":\"TPLG\",\"modes\":[\"road\"]}"]}'
+invoke $ADMIN_MSPCONFIGPATH '{"Args":["createCustomer","{\"customerID\":\"customerID01\",\"organizationID\":\"'$BUYER_ORGANIZATION_ID'\",\"name\":\"Customer\",\"billingAddress\":{\"address\":\"paris\",\"city\":\"Paris\",\"country\":\"FR\"},\"shippingAddresses\":[{\"address\":\"paris\",\"city\":\"Paris\",\"country\":\"FR\",\"dock\":\"ns\"}]}"]}'
+
+# ==== the seller creates the shipment of a new purchase order between seller01 and buyer01 ====
+invoke $SELLER_MSPCONFIGPATH '{"Args":["createShipment","shipment01","{\"purchaseOrder\":{\"purchaseOrderID\":\"purchase01\",\"seller\":{\"participantID\":\"seller01\"},\"buyer\":{\"participantID\":\"buyer01\"}},\"customerID\":{\"customerID\":\"customerID01\"},\"carrier\":{\"carrierID\":\"3rdPartyLogistic\"},\"location\":{\"latitude\":\"48.8566\",\"longitude\":\"2.3522\",\"address\":\"paris\",\"dock\":\"ns\"},\"expectedDepartureDate\":\"2018-06-05T17:00:00Z\",\"expectedArrivedDate\":\"2018-06-05T17:00:00Z\"}"]}'
 set +x
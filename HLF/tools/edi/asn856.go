@@ -0,0 +1,253 @@
+package edi
+
+import (
+	"math"
+	"strconv"
+)
+
+// HL hierarchical level codes of an 856
+const (
+	levelShipment = "S"
+	levelOrder    = "O"
+	levelTare     = "T"
+	levelPack     = "P"
+	levelItem     = "I"
+)
+
+// chaincode packaging types of the HL levels that become logistics units
+var levelTypes = map[string]string{
+	levelTare: "pallet",
+	levelPack: "unit",
+	levelItem: "unit",
+}
+
+// Options tune the translation of ship notices
+type Options struct {
+	// CarrierIDs maps a TD503 SCAC to the carrierID registered on the ledger, the SCAC is used as is otherwise
+	CarrierIDs map[string]string
+}
+
+// ShipNoticeDocument is an 856 translated for the chaincode: one shipment per order level
+// and the packs, pallets and loose items as logistics units, parents before their children
+type ShipNoticeDocument struct {
+	ControlNumber  string          `json:"controlNumber"`
+	Shipments      []Shipment      `json:"shipments"`
+	LogisticsUnits []LogisticsUnit `json:"logisticsUnits"`
+}
+
+// hierarchicalLevel is one HL loop with its place in the hierarchy
+type hierarchicalLevel struct {
+	ID      string
+	Code    string
+	Parent  *hierarchicalLevel
+	Segment Segment
+	OrderID string
+	Unit    *LogisticsUnit
+}
+
+// order walks up to the order level a level belongs to
+func (level *hierarchicalLevel) order() *hierarchicalLevel {
+	for current := level; current != nil; current = current.Parent {
+		if current.Code == levelOrder {
+			return current
+		}
+	}
+	return nil
+}
+
+// enclosingUnit is the closest ancestor that became a logistics unit
+func (level *hierarchicalLevel) enclosingUnit() *LogisticsUnit {
+	for current := level.Parent; current != nil; current = current.Parent {
+		if current.Unit != nil {
+			return current.Unit
+		}
+	}
+	return nil
+}
+
+// ParseShipNotice translates an 856 transaction set. The shipment level gives the carrier (TD503),
+// the ship and estimated delivery dates (DTM*011 and DTM*017), the ship-from location and the customer
+// (N104 of N1*BY, or N1*ST). Each order level (PRF01) becomes a shipment, suffixed with the purchase
+// order number when the notice covers several orders. Tare and pack levels identified by their SSCC
+// (MAN*GM) become pallets and units, and the items (LIN, SN1) add their quantity to the enclosing pack.
+// Items outside a pack become units named after the shipment and their HL number.
+func ParseShipNotice(transaction Transaction, options Options) (*ShipNoticeDocument, error) {
+	var errs ErrorList
+	if transaction.Code != "856" {
+		errs.add(transaction.Start, 1, "expected an 856 transaction set, got %s", transaction.Code)
+		return nil, errs
+	}
+	document := &ShipNoticeDocument{ControlNumber: transaction.ControlNumber}
+	var template Shipment
+	var bsn *Segment
+	var shipmentLevel *hierarchicalLevel
+	var orders []*hierarchicalLevel
+	var units []*hierarchicalLevel
+	levels := map[string]*hierarchicalLevel{}
+	var current *hierarchicalLevel
+	parties := newPartyLoop()
+
+	for _, segment := range transaction.Segments {
+		if current != nil && current.Code == levelShipment && parties.read(segment) {
+			continue
+		}
+		switch segment.ID() {
+		case "BSN":
+			found := segment
+			bsn = &found
+			template.ShipmentID = segment.Element(2)
+			if len(template.ShipmentID) <= 0 {
+				errs.add(segment, 2, "shipment identification is required")
+			}
+		case "HL":
+			level := &hierarchicalLevel{ID: segment.Element(1), Code: segment.Element(3), Segment: segment}
+			if _, duplicate := levels[level.ID]; duplicate || len(level.ID) <= 0 {
+				errs.add(segment, 1, "hierarchical ID must be unique and non-empty: %s", level.ID)
+			}
+			if parentID := segment.Element(2); len(parentID) > 0 {
+				if level.Parent = levels[parentID]; level.Parent == nil {
+					errs.add(segment, 2, "parent %s is not a preceding HL", parentID)
+				}
+			}
+			levels[level.ID] = level
+			current = level
+			switch level.Code {
+			case levelShipment:
+				if shipmentLevel != nil {
+					errs.add(segment, 3, "an 856 carries a single shipment level")
+				}
+				shipmentLevel = level
+			case levelOrder:
+				orders = append(orders, level)
+			case levelTare, levelPack, levelItem:
+				units = append(units, level)
+			default:
+				errs.add(segment, 3, "unsupported hierarchical level code: %s", level.Code)
+			}
+		case "TD5":
+			if current == nil || current.Code != levelShipment {
+				continue
+			}
+			scac := segment.Element(3)
+			if len(scac) <= 0 {
+				errs.add(segment, 3, "carrier SCAC is required")
+				continue
+			}
+			template.Carrier.CarrierID = scac
+			if carrierID, mapped := options.CarrierIDs[scac]; mapped {
+				template.Carrier.CarrierID = carrierID
+			}
+		case "DTM":
+			if current == nil || current.Code != levelShipment {
+				continue
+			}
+			date, err := parseDate(segment.Element(2), segment.Element(3))
+			if err != nil {
+				errs.add(segment, 2, "%s", err.Error())
+				continue
+			}
+			if segment.Element(1) == "011" {
+				template.ExpectedDepartureDate = date
+			} else if segment.Element(1) == "017" {
+				template.ExpectedArrivedDate = date
+			}
+		case "PRF":
+			if current == nil || current.Code != levelOrder {
+				errs.add(segment, 0, "PRF must follow an order level HL")
+				continue
+			}
+			current.OrderID = segment.Element(1)
+			if len(current.OrderID) <= 0 {
+				errs.add(segment, 1, "purchase order number is required")
+			}
+		case "MAN":
+			if current == nil || (current.Code != levelTare && current.Code != levelPack) {
+				continue
+			}
+			if segment.Element(1) != "GM" || len(segment.Element(2)) <= 0 {
+				errs.add(segment, 2, "tare and pack levels must be identified by an SSCC in MAN*GM")
+				continue
+			}
+			current.Unit = &LogisticsUnit{LogisticsUnitID: segment.Element(2), Type: levelTypes[current.Code]}
+		case "SN1":
+			if current == nil || current.Code != levelItem {
+				errs.add(segment, 0, "SN1 must follow an item level HL")
+				continue
+			}
+			quantity, err := strconv.ParseFloat(segment.Element(2), 64)
+			if err != nil || quantity <= 0 || quantity != math.Trunc(quantity) {
+				errs.add(segment, 2, "shipped quantity must be a positive whole number: %s", segment.Element(2))
+				continue
+			}
+			if pack := current.enclosingUnit(); pack != nil && pack.Type == levelTypes[levelPack] {
+				pack.Quantity += int(quantity)
+			} else {
+				current.Unit = &LogisticsUnit{LogisticsUnitID: template.ShipmentID + "-" + current.ID, Type: levelTypes[levelItem], Quantity: int(quantity)}
+			}
+		}
+	}
+
+	if bsn == nil {
+		errs.add(transaction.Start, 0, "856 has no BSN segment")
+	}
+	if shipmentLevel == nil {
+		errs.add(transaction.Start, 0, "856 has no shipment level HL")
+		return document, errs.err()
+	}
+	if len(template.Carrier.CarrierID) <= 0 {
+		errs.add(shipmentLevel.Segment, 0, "shipment level has no TD5 carrier")
+	}
+	if template.ExpectedDepartureDate.IsZero() {
+		errs.add(shipmentLevel.Segment, 0, "shipment level has no DTM*011 ship date")
+	}
+	if template.ExpectedArrivedDate.IsZero() {
+		errs.add(shipmentLevel.Segment, 0, "shipment level has no DTM*017 estimated delivery date")
+	}
+	customer, ok := parties.parties[entityBuyer]
+	if !ok {
+		customer, ok = parties.parties[entityShipTo]
+	}
+	if !ok || len(customer.ID) <= 0 {
+		errs.add(shipmentLevel.Segment, 0, "shipment level needs an N1*BY or N1*ST with an identification code for the customer")
+	} else {
+		template.Customer.CustomerID = customer.ID
+	}
+	if shipFrom, ok := parties.parties[entityShipFrom]; ok {
+		location := shipFrom.Location
+		template.Location = &location
+	}
+	if len(orders) <= 0 {
+		errs.add(shipmentLevel.Segment, 0, "856 has no order level HL")
+	}
+
+	shipmentIDs := map[*hierarchicalLevel]string{}
+	for _, order := range orders {
+		shipment := template
+		shipment.PurchaseOrder = PurchaseOrder{PurchaseOrderID: order.OrderID}
+		if len(orders) > 1 {
+			shipment.ShipmentID = template.ShipmentID + "-" + order.OrderID
+		}
+		shipmentIDs[order] = shipment.ShipmentID
+		document.Shipments = append(document.Shipments, shipment)
+	}
+	for _, level := range units {
+		if level.Unit == nil {
+			if level.Code != levelItem {
+				errs.add(level.Segment, 0, "%s level has no MAN*GM SSCC", level.Code)
+			}
+			continue
+		}
+		order := level.order()
+		if order == nil {
+			errs.add(level.Segment, 2, "%s level is not below an order level", level.Code)
+			continue
+		}
+		level.Unit.ShipmentID = shipmentIDs[order]
+		level.Unit.PurchaseOrderID = order.OrderID
+		if parent := level.enclosingUnit(); parent != nil {
+			level.Unit.ParentID = parent.LogisticsUnitID
+		}
+		document.LogisticsUnits = append(document.LogisticsUnits, *level.Unit)
+	}
+	return document, errs.err()
+}
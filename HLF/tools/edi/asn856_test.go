@@ -0,0 +1,117 @@
+package edi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseShipNotice(t *testing.T) {
+	header := []string{
+		"BSN*00*ASN1*20180605*1700",
+		"HL*1**S",
+		"TD5**2*TPLG",
+		"DTM*011*20180605*0800",
+		"DTM*017*20180606*1200",
+		"N1*BY*Buyer Inc*92*customerID01",
+		"N1*SF*Lyon Depot*92*DEP01",
+		"N4*Lyon**69001*FR",
+	}
+	levels := func(segments ...string) []string {
+		return append(append([]string{}, header...), segments...)
+	}
+	tests := []struct {
+		name          string
+		segments      []string
+		wantShipments map[string]string
+		wantUnits     []LogisticsUnit
+		wantErrs      []string
+	}{
+		{
+			name: "pallet, pack and loose item of one order",
+			segments: levels(
+				"HL*2*1*O", "PRF*PO1",
+				"HL*3*2*T", "MAN*GM*SSCC-PALLET",
+				"HL*4*3*P", "MAN*GM*SSCC-PACK",
+				"HL*5*4*I", "LIN**BP*SKU-1", "SN1**6*EA",
+				"HL*6*2*I", "LIN**BP*SKU-2", "SN1**2*EA"),
+			wantShipments: map[string]string{"ASN1": "PO1"},
+			wantUnits: []LogisticsUnit{
+				{LogisticsUnitID: "SSCC-PALLET", ShipmentID: "ASN1", Type: "pallet", PurchaseOrderID: "PO1"},
+				{LogisticsUnitID: "SSCC-PACK", ParentID: "SSCC-PALLET", ShipmentID: "ASN1", Type: "unit", PurchaseOrderID: "PO1", Quantity: 6},
+				{LogisticsUnitID: "ASN1-6", ShipmentID: "ASN1", Type: "unit", PurchaseOrderID: "PO1", Quantity: 2},
+			},
+		},
+		{
+			name: "one shipment per order",
+			segments: levels(
+				"HL*2*1*O", "PRF*PO1",
+				"HL*3*2*P", "MAN*GM*SSCC-1",
+				"HL*4*1*O", "PRF*PO2",
+				"HL*5*4*P", "MAN*GM*SSCC-2"),
+			wantShipments: map[string]string{"ASN1-PO1": "PO1", "ASN1-PO2": "PO2"},
+			wantUnits: []LogisticsUnit{
+				{LogisticsUnitID: "SSCC-1", ShipmentID: "ASN1-PO1", Type: "unit", PurchaseOrderID: "PO1"},
+				{LogisticsUnitID: "SSCC-2", ShipmentID: "ASN1-PO2", Type: "unit", PurchaseOrderID: "PO2"},
+			},
+		},
+		{
+			name: "pack without SSCC, unknown parent and fractional quantity",
+			segments: levels(
+				"HL*2*1*O", "PRF*PO1",
+				"HL*3*2*P",
+				"HL*4*9*I", "SN1**1.5*EA"),
+			wantShipments: map[string]string{"ASN1": "PO1"},
+			wantErrs:      []string{"13 HL02", "14 SN102", "12 HL00"},
+		},
+		{
+			name:     "no shipment level",
+			segments: []string{"BSN*00*ASN1*20180605*1700", "HL*1**O", "PRF*PO1"},
+			wantErrs: []string{"1 ST00"},
+		},
+		{
+			name:          "shipment level without carrier, dates or customer",
+			segments:      []string{"BSN*00*ASN1*20180605*1700", "HL*1**S", "HL*2*1*O", "PRF*PO1"},
+			wantShipments: map[string]string{"ASN1": "PO1"},
+			wantErrs:      []string{"3 HL00", "3 HL00", "3 HL00", "3 HL00"},
+		},
+	}
+	options := Options{CarrierIDs: map[string]string{"TPLG": "3rdPartyLogistic"}}
+	for _, tt := range tests {
+		document, err := ParseShipNotice(transactionSet("856", tt.segments...), options)
+		if got := errorPositions(t, err); !reflect.DeepEqual(got, tt.wantErrs) {
+			t.Errorf("%s: errors = %v, want %v\n%v", tt.name, got, tt.wantErrs, err)
+		}
+		shipments := map[string]string{}
+		for _, shipment := range document.Shipments {
+			shipments[shipment.ShipmentID] = shipment.PurchaseOrder.PurchaseOrderID
+		}
+		if len(tt.wantShipments) <= 0 {
+			tt.wantShipments = map[string]string{}
+		}
+		if !reflect.DeepEqual(shipments, tt.wantShipments) {
+			t.Errorf("%s: shipments = %v, want %v", tt.name, shipments, tt.wantShipments)
+		}
+		if len(tt.wantErrs) > 0 {
+			continue
+		}
+		if !reflect.DeepEqual(document.LogisticsUnits, tt.wantUnits) {
+			t.Errorf("%s: logistics units = %+v, want %+v", tt.name, document.LogisticsUnits, tt.wantUnits)
+		}
+		for _, shipment := range document.Shipments {
+			if shipment.Carrier.CarrierID != "3rdPartyLogistic" || shipment.Customer.CustomerID != "customerID01" {
+				t.Errorf("%s: shipment %s carrier %q customer %q", tt.name, shipment.ShipmentID, shipment.Carrier.CarrierID, shipment.Customer.CustomerID)
+			}
+			if want := time.Date(2018, 6, 5, 8, 0, 0, 0, time.UTC); !shipment.ExpectedDepartureDate.Equal(want) {
+				t.Errorf("%s: departure = %v, want %v", tt.name, shipment.ExpectedDepartureDate, want)
+			}
+			if want := time.Date(2018, 6, 6, 12, 0, 0, 0, time.UTC); !shipment.ExpectedArrivedDate.Equal(want) {
+				t.Errorf("%s: arrival = %v, want %v", tt.name, shipment.ExpectedArrivedDate, want)
+			}
+			wantFrom := Location{LocationID: "DEP01", PostalCode: "69001", City: "Lyon", Country: "FR", Address: "Lyon, 69001, FR"}
+			if shipment.Location == nil || *shipment.Location != wantFrom {
+				t.Errorf("%s: ship from = %+v, want %+v", tt.name, shipment.Location, wantFrom)
+			}
+		}
+	}
+}
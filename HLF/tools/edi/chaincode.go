@@ -0,0 +1,153 @@
+package edi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// pricingTransientKey is the transient map entry createShipment reads the private pricing from
+const pricingTransientKey = "pricing"
+
+// Invocation is one chaincode transaction. Transient values are marshalled as base64,
+// the format expected by peer chaincode invoke --transient.
+type Invocation struct {
+	Function  string            `json:"function"`
+	Args      []string          `json:"args"`
+	Transient map[string][]byte `json:"transient,omitempty"`
+}
+
+// PeerArgs renders the -c argument of peer chaincode invoke
+func (invocation Invocation) PeerArgs() (string, error) {
+	argsAsBytes, err := json.Marshal(map[string][]string{"Args": append([]string{invocation.Function}, invocation.Args...)})
+	return string(argsAsBytes), err
+}
+
+// PeerTransient renders the --transient argument of peer chaincode invoke, empty if there is none
+func (invocation Invocation) PeerTransient() (string, error) {
+	if len(invocation.Transient) <= 0 {
+		return "", nil
+	}
+	transientAsBytes, err := json.Marshal(invocation.Transient)
+	return string(transientAsBytes), err
+}
+
+// Result is the translation of one or more interchanges
+type Result struct {
+	PurchaseOrders []PurchaseOrderDocument `json:"purchaseOrders"`
+	ShipNotices    []ShipNoticeDocument    `json:"shipNotices"`
+	Invocations    []Invocation            `json:"invocations"`
+}
+
+// Translator turns interchanges into chaincode invocations. Purchase orders are not created on their
+// own: the chaincode creates a purchase order with the first shipment that references it, so an 850
+// is held until an 856 ships against it and is then embedded in that shipment with its pricing.
+// An 856 for an order the translator has not seen references the order by number only, which
+// must then already exist on the ledger.
+type Translator struct {
+	Options Options
+	// Salt generates the salt of the private pricing hash, random 16 bytes by default
+	Salt   func() (string, error)
+	orders map[string]*PurchaseOrderDocument
+}
+
+// NewTranslator returns a translator with random pricing salts
+func NewTranslator(options Options) *Translator {
+	return &Translator{Options: options, Salt: randomSalt, orders: map[string]*PurchaseOrderDocument{}}
+}
+
+// randomSalt is 16 random bytes in hex
+func randomSalt() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// Translate parses the transaction sets of an interchange. Transaction sets with errors are left
+// out of the result and their errors returned together as an ErrorList.
+func (t *Translator) Translate(interchange *Interchange) (*Result, error) {
+	var errs ErrorList
+	result := &Result{}
+	for _, transaction := range interchange.Transactions {
+		switch transaction.Code {
+		case "850":
+			document, err := ParsePurchaseOrder(transaction)
+			if err != nil {
+				errs = append(errs, err.(ErrorList)...)
+				continue
+			}
+			if document.Pricing.Salt, err = t.Salt(); err != nil {
+				return nil, err
+			}
+			t.orders[document.PurchaseOrder.PurchaseOrderID] = document
+			result.PurchaseOrders = append(result.PurchaseOrders, *document)
+		case "856":
+			document, err := ParseShipNotice(transaction, t.Options)
+			if err != nil {
+				errs = append(errs, err.(ErrorList)...)
+				continue
+			}
+			invocations, err := t.shipNoticeInvocations(document)
+			if err != nil {
+				return nil, err
+			}
+			result.ShipNotices = append(result.ShipNotices, *document)
+			result.Invocations = append(result.Invocations, invocations...)
+		default:
+			errs.add(transaction.Start, 1, "unsupported transaction set %s, expecting 850 or 856", transaction.Code)
+		}
+	}
+	return result, errs.err()
+}
+
+// shipNoticeInvocations creates the logistics units, packs them, then creates the shipments.
+// Each invocation is its own transaction and must be submitted in order.
+func (t *Translator) shipNoticeInvocations(document *ShipNoticeDocument) ([]Invocation, error) {
+	var invocations []Invocation
+	for _, unit := range document.LogisticsUnits {
+		unit.ParentID = ""
+		unitAsBytes, err := json.Marshal(unit)
+		if err != nil {
+			return nil, err
+		}
+		invocations = append(invocations, Invocation{Function: "createLogisticUnit", Args: []string{string(unitAsBytes)}})
+	}
+	for _, unit := range document.LogisticsUnits {
+		if len(unit.ParentID) > 0 {
+			invocations = append(invocations, Invocation{Function: "packageLogistic", Args: []string{unit.LogisticsUnitID, unit.ParentID}})
+		}
+	}
+	for _, shipment := range document.Shipments {
+		invocation := Invocation{Function: "createShipment"}
+		if order, known := t.orders[shipment.PurchaseOrder.PurchaseOrderID]; known {
+			shipment.PurchaseOrder = order.PurchaseOrder
+			pricingAsBytes, err := json.Marshal(order.Pricing)
+			if err != nil {
+				return nil, err
+			}
+			invocation.Transient = map[string][]byte{pricingTransientKey: pricingAsBytes}
+			// ==== Only the first shipment creates the order, the next ones reference it ====
+			delete(t.orders, shipment.PurchaseOrder.PurchaseOrderID)
+		}
+		shipmentAsBytes, err := json.Marshal(shipment)
+		if err != nil {
+			return nil, err
+		}
+		invocation.Args = []string{shipment.ShipmentID, string(shipmentAsBytes)}
+		invocations = append(invocations, invocation)
+	}
+	return invocations, nil
+}
+
+// Pending lists the purchase orders translated so far that no ship notice has referenced yet
+func (t *Translator) Pending() []string {
+	var pending []string
+	for purchaseOrderID := range t.orders {
+		pending = append(pending, purchaseOrderID)
+	}
+	sort.Strings(pending)
+	return pending
+}
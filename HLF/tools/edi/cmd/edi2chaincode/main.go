@@ -0,0 +1,132 @@
+// Command edi2chaincode translates X12 850 and 856 interchanges into supplychain chaincode invocations.
+//
+//	edi2chaincode [-format json|peer] [-carrier SCAC=carrierID]... [file...]
+//
+// Files are read in order, standard input if none is given, so the 850 purchase orders should come
+// before the 856 ship notices that reference them. Segment errors are printed to standard error and
+// the exit status is 1; the invocations of the transaction sets without errors are still printed.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/fabric/peer/crypto/crypto-config/opensource.com/HLF/tools/edi"
+)
+
+// carrierFlag collects repeated -carrier SCAC=carrierID mappings
+type carrierFlag map[string]string
+
+func (c carrierFlag) String() string {
+	var pairs []string
+	for scac, carrierID := range c {
+		pairs = append(pairs, scac+"="+carrierID)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (c carrierFlag) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 || len(pair[0]) <= 0 || len(pair[1]) <= 0 {
+		return fmt.Errorf("expecting SCAC=carrierID, got %s", value)
+	}
+	c[pair[0]] = pair[1]
+	return nil
+}
+
+// shellQuote wraps a value in single quotes for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func main() {
+	carriers := carrierFlag{}
+	format := flag.String("format", "json", "output format: json (one invocation per line) or peer (peer chaincode invoke commands)")
+	channel := flag.String("channel", "$CHANNEL_NAME", "channel of the peer commands")
+	name := flag.String("name", "supplychain", "chaincode name of the peer commands")
+	flag.Var(carriers, "carrier", "map a TD5 SCAC to a registered carrierID, SCAC=carrierID, repeatable")
+	flag.Parse()
+	if *format != "json" && *format != "peer" {
+		fmt.Fprintln(os.Stderr, "format must be json or peer")
+		os.Exit(2)
+	}
+
+	inputs := flag.Args()
+	if len(inputs) <= 0 {
+		inputs = []string{"-"}
+	}
+	translator := edi.NewTranslator(edi.Options{CarrierIDs: carriers})
+	failed := false
+	for _, input := range inputs {
+		var data []byte
+		var err error
+		if input == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(input)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		interchange, err := edi.Parse(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%s\n", input, err)
+			failed = true
+			if interchange == nil {
+				continue
+			}
+		}
+		result, err := translator.Translate(interchange)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%s\n", input, err)
+			failed = true
+			if result == nil {
+				os.Exit(2)
+			}
+		}
+		for _, invocation := range result.Invocations {
+			if err = printInvocation(invocation, *format, *channel, *name); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		}
+	}
+	if pending := translator.Pending(); len(pending) > 0 {
+		fmt.Fprintf(os.Stderr, "purchase orders without a ship notice, nothing was generated for them: %s\n", strings.Join(pending, ", "))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printInvocation writes one invocation as a JSON line or a peer command
+func printInvocation(invocation edi.Invocation, format, channel, name string) error {
+	if format == "json" {
+		invocationAsBytes, err := json.Marshal(invocation)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(invocationAsBytes))
+		return nil
+	}
+	args, err := invocation.PeerArgs()
+	if err != nil {
+		return err
+	}
+	command := "peer chaincode invoke -C " + channel + " -n " + name + " -c " + shellQuote(args)
+	transient, err := invocation.PeerTransient()
+	if err != nil {
+		return err
+	}
+	if len(transient) > 0 {
+		command += " --transient " + shellQuote(transient)
+	}
+	fmt.Println(command)
+	return nil
+}
@@ -0,0 +1,70 @@
+package edi
+
+import "time"
+
+// The types below mirror the JSON of the chaincode inputs. States are left out since the
+// chaincode starts every new purchase order and shipment in its initial state.
+
+// Participant references a registered buyer or seller
+type Participant struct {
+	ParticipantID string `json:"participantID"`
+}
+
+// CustomerRef references a registered customer
+type CustomerRef struct {
+	CustomerID string `json:"customerID"`
+}
+
+// CarrierRef references a registered carrier
+type CarrierRef struct {
+	CarrierID string `json:"carrierID"`
+}
+
+// Location is an N1/N3/N4 party address
+type Location struct {
+	LocationID string `json:"locationID,omitempty"`
+	Street     string `json:"street,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	City       string `json:"city,omitempty"`
+	Country    string `json:"country,omitempty"`
+	Address    string `json:"address,omitempty"`
+}
+
+// LogisticsUnit is a purchase order line, or a pack, pallet or loose item of a ship notice
+type LogisticsUnit struct {
+	LogisticsUnitID string `json:"logisticsUnitID"`
+	ParentID        string `json:"parentID,omitempty"`
+	ShipmentID      string `json:"shipmentID,omitempty"`
+	Type            string `json:"type,omitempty"`
+	PurchaseOrderID string `json:"purchaseOrderID,omitempty"`
+	Quantity        int    `json:"quantity"`
+}
+
+// PurchaseOrder is the purchase order embedded in a shipment. Prices are not part of it,
+// they travel in the transient map as Pricing.
+type PurchaseOrder struct {
+	PurchaseOrderID string          `json:"purchaseOrderID"`
+	Seller          *Participant    `json:"seller,omitempty"`
+	Buyer           *Participant    `json:"buyer,omitempty"`
+	ExpectedDelDate *time.Time      `json:"expectedDelDate,omitempty"`
+	ShipTO          *Location       `json:"shipTO,omitempty"`
+	Product         []LogisticsUnit `json:"product,omitempty"`
+}
+
+// Pricing is the private amount and line prices of a purchase order, keyed by line logisticsUnitID
+type Pricing struct {
+	Price      float64            `json:"price"`
+	LinePrices map[string]float64 `json:"linePrices,omitempty"`
+	Salt       string             `json:"salt"`
+}
+
+// Shipment is the createShipment payload
+type Shipment struct {
+	ShipmentID            string        `json:"shipmentID"`
+	PurchaseOrder         PurchaseOrder `json:"purchaseOrder"`
+	Customer              CustomerRef   `json:"customerID"`
+	Carrier               CarrierRef    `json:"carrier"`
+	Location              *Location     `json:"location,omitempty"`
+	ExpectedDepartureDate time.Time     `json:"expectedDepartureDate"`
+	ExpectedArrivedDate   time.Time     `json:"expectedArrivedDate"`
+}
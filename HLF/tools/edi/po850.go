@@ -0,0 +1,189 @@
+package edi
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// N1 entity identifier codes
+const (
+	entityBuyer    = "BY"
+	entitySeller   = "SE"
+	entityShipTo   = "ST"
+	entityShipFrom = "SF"
+)
+
+// party is an N1 loop: the N1 name and ID with the N3/N4 address that follows it
+type party struct {
+	ID       string
+	Location Location
+	Segment  Segment
+}
+
+// partyLoop collects the N1 loops of a transaction set or of one HL level
+type partyLoop struct {
+	parties map[string]*party
+	current *party
+}
+
+func newPartyLoop() *partyLoop {
+	return &partyLoop{parties: map[string]*party{}}
+}
+
+// read consumes N1, N3 and N4 segments and reports whether the segment belonged to the loop
+func (p *partyLoop) read(segment Segment) bool {
+	switch segment.ID() {
+	case "N1":
+		p.current = &party{ID: segment.Element(4), Segment: segment}
+		p.current.Location.LocationID = segment.Element(4)
+		p.parties[segment.Element(1)] = p.current
+	case "N3":
+		if p.current != nil {
+			p.current.Location.Street = strings.TrimSpace(segment.Element(1) + " " + segment.Element(2))
+		}
+	case "N4":
+		if p.current != nil {
+			p.current.Location.City = segment.Element(1)
+			p.current.Location.PostalCode = segment.Element(3)
+			p.current.Location.Country = segment.Element(4)
+			fields := []string{p.current.Location.Street, segment.Element(1), segment.Element(2), segment.Element(3), segment.Element(4)}
+			var address []string
+			for _, field := range fields {
+				if len(field) > 0 {
+					address = append(address, field)
+				}
+			}
+			p.current.Location.Address = strings.Join(address, ", ")
+		}
+	default:
+		p.current = nil
+		return false
+	}
+	return true
+}
+
+// PurchaseOrderDocument is an 850 translated for the chaincode
+type PurchaseOrderDocument struct {
+	ControlNumber string        `json:"controlNumber"`
+	PurchaseOrder PurchaseOrder `json:"purchaseOrder"`
+	Pricing       Pricing       `json:"pricing"`
+}
+
+// ParsePurchaseOrder translates an 850 transaction set. Buyer and seller are the N104 codes of the
+// N1*BY and N1*SE loops, which must be the participantIDs registered on the ledger. Each PO1 line
+// becomes a product line identified by its buyer or vendor part number (PO107), or the line number.
+func ParsePurchaseOrder(transaction Transaction) (*PurchaseOrderDocument, error) {
+	var errs ErrorList
+	if transaction.Code != "850" {
+		errs.add(transaction.Start, 1, "expected an 850 transaction set, got %s", transaction.Code)
+		return nil, errs
+	}
+	document := &PurchaseOrderDocument{ControlNumber: transaction.ControlNumber}
+	purchaseOrder := &document.PurchaseOrder
+	document.Pricing.LinePrices = map[string]float64{}
+	parties := newPartyLoop()
+
+	var lineCount int
+	var total *float64
+	for _, segment := range transaction.Segments {
+		if parties.read(segment) {
+			continue
+		}
+		switch segment.ID() {
+		case "BEG":
+			purchaseOrder.PurchaseOrderID = segment.Element(3)
+			if len(purchaseOrder.PurchaseOrderID) <= 0 {
+				errs.add(segment, 3, "purchase order number is required")
+			}
+		case "DTM":
+			if segment.Element(1) != "002" {
+				continue
+			}
+			date, err := parseDate(segment.Element(2), segment.Element(3))
+			if err != nil {
+				errs.add(segment, 2, "%s", err.Error())
+				continue
+			}
+			purchaseOrder.ExpectedDelDate = &date
+		case "PO1":
+			lineCount++
+			line := LogisticsUnit{LogisticsUnitID: segment.Element(7)}
+			if len(line.LogisticsUnitID) <= 0 {
+				line.LogisticsUnitID = segment.Element(1)
+			}
+			if len(line.LogisticsUnitID) <= 0 {
+				errs.add(segment, 7, "line needs a part number or a line number in PO101")
+			}
+			quantity, err := strconv.ParseFloat(segment.Element(2), 64)
+			if err != nil || quantity <= 0 || quantity != math.Trunc(quantity) {
+				errs.add(segment, 2, "quantity must be a positive whole number: %s", segment.Element(2))
+			}
+			line.Quantity = int(quantity)
+			if len(segment.Element(4)) > 0 {
+				unitPrice, err := strconv.ParseFloat(segment.Element(4), 64)
+				if err != nil || unitPrice < 0 {
+					errs.add(segment, 4, "unit price must be a non-negative number: %s", segment.Element(4))
+				}
+				document.Pricing.LinePrices[line.LogisticsUnitID] += roundAmount(unitPrice * quantity)
+			}
+			purchaseOrder.Product = append(purchaseOrder.Product, line)
+		case "AMT":
+			if segment.Element(1) != "TT" {
+				continue
+			}
+			amount, err := strconv.ParseFloat(segment.Element(2), 64)
+			if err != nil || amount < 0 {
+				errs.add(segment, 2, "total amount must be a non-negative number: %s", segment.Element(2))
+				continue
+			}
+			total = &amount
+		case "CTT":
+			if count, err := strconv.Atoi(segment.Element(1)); err != nil || count != lineCount {
+				errs.add(segment, 1, "transaction totals declare %s lines, found %d", segment.Element(1), lineCount)
+			}
+		}
+	}
+
+	if len(purchaseOrder.PurchaseOrderID) <= 0 && len(errs) <= 0 {
+		errs.add(transaction.Start, 0, "850 has no BEG segment")
+	}
+	if len(purchaseOrder.Product) <= 0 {
+		errs.add(transaction.Start, 0, "850 has no PO1 lines")
+	}
+	for _, required := range []struct{ code, role string }{{entityBuyer, "buyer"}, {entitySeller, "seller"}} {
+		found, ok := parties.parties[required.code]
+		if !ok {
+			errs.add(transaction.Start, 0, "850 has no N1*%s %s party", required.code, required.role)
+		} else if len(found.ID) <= 0 {
+			errs.add(found.Segment, 4, "%s identification code is required", required.role)
+		}
+	}
+	if buyer, ok := parties.parties[entityBuyer]; ok {
+		purchaseOrder.Buyer = &Participant{ParticipantID: buyer.ID}
+	}
+	if seller, ok := parties.parties[entitySeller]; ok {
+		purchaseOrder.Seller = &Participant{ParticipantID: seller.ID}
+	}
+	if shipTo, ok := parties.parties[entityShipTo]; ok {
+		location := shipTo.Location
+		purchaseOrder.ShipTO = &location
+	}
+
+	for _, linePrice := range document.Pricing.LinePrices {
+		document.Pricing.Price += linePrice
+	}
+	document.Pricing.Price = roundAmount(document.Pricing.Price)
+	if total != nil {
+		document.Pricing.Price = *total
+	}
+	if len(document.Pricing.LinePrices) <= 0 {
+		document.Pricing.LinePrices = nil
+	}
+	return document, errs.err()
+}
+
+// roundAmount rounds a monetary amount to cents
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
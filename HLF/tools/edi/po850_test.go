@@ -0,0 +1,94 @@
+package edi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePurchaseOrder(t *testing.T) {
+	header := []string{
+		"BEG*00*SA*PO1**20180601",
+		"DTM*002*20180605*1700",
+		"N1*BY*Buyer Inc*92*buyer01",
+		"N1*SE*Seller Inc*92*seller01",
+		"N1*ST*Paris Warehouse*92*WH01",
+		"N3*1 rue de Rivoli",
+		"N4*Paris**75001*FR",
+	}
+	lines := func(segments ...string) []string {
+		return append(append([]string{}, header...), segments...)
+	}
+	tests := []struct {
+		name       string
+		segments   []string
+		wantLines  []LogisticsUnit
+		wantPrice  float64
+		wantPrices map[string]float64
+		wantErrs   []string
+	}{
+		{
+			name:       "priced lines",
+			segments:   lines("PO1*1*2*EA*10.5**BP*SKU-1", "PO1*2*3*EA*1.25", "CTT*2"),
+			wantLines:  []LogisticsUnit{{LogisticsUnitID: "SKU-1", Quantity: 2}, {LogisticsUnitID: "2", Quantity: 3}},
+			wantPrice:  24.75,
+			wantPrices: map[string]float64{"SKU-1": 21, "2": 3.75},
+		},
+		{
+			name:       "total amount overrides the line prices",
+			segments:   lines("PO1*1*2*EA*10.5**BP*SKU-1", "AMT*TT*20"),
+			wantLines:  []LogisticsUnit{{LogisticsUnitID: "SKU-1", Quantity: 2}},
+			wantPrice:  20,
+			wantPrices: map[string]float64{"SKU-1": 21},
+		},
+		{
+			name:      "unpriced line",
+			segments:  lines("PO1*1*4*EA"),
+			wantLines: []LogisticsUnit{{LogisticsUnitID: "1", Quantity: 4}},
+		},
+		{
+			name:      "invalid quantity, price and line count",
+			segments:  lines("PO1*1*2.5*EA*-1", "CTT*2"),
+			wantLines: []LogisticsUnit{{LogisticsUnitID: "1", Quantity: 2}},
+			wantErrs:  []string{"9 PO102", "9 PO104", "10 CTT01"},
+		},
+		{
+			name:     "missing parties and lines",
+			segments: []string{"BEG*00*SA*PO1", "N1*BY*Buyer Inc"},
+			wantErrs: []string{"1 ST00", "3 N104", "1 ST00"},
+		},
+	}
+	for _, tt := range tests {
+		document, err := ParsePurchaseOrder(transactionSet("850", tt.segments...))
+		if got := errorPositions(t, err); !reflect.DeepEqual(got, tt.wantErrs) {
+			t.Errorf("%s: errors = %v, want %v\n%v", tt.name, got, tt.wantErrs, err)
+		}
+		purchaseOrder := document.PurchaseOrder
+		if !reflect.DeepEqual(purchaseOrder.Product, tt.wantLines) {
+			t.Errorf("%s: lines = %+v, want %+v", tt.name, purchaseOrder.Product, tt.wantLines)
+		}
+		if len(tt.wantErrs) > 0 {
+			continue
+		}
+		if document.Pricing.Price != tt.wantPrice || !reflect.DeepEqual(document.Pricing.LinePrices, tt.wantPrices) {
+			t.Errorf("%s: pricing = %+v, want %v %v", tt.name, document.Pricing, tt.wantPrice, tt.wantPrices)
+		}
+		if purchaseOrder.PurchaseOrderID != "PO1" || purchaseOrder.Buyer.ParticipantID != "buyer01" || purchaseOrder.Seller.ParticipantID != "seller01" {
+			t.Errorf("%s: purchase order %+v", tt.name, purchaseOrder)
+		}
+		if want := time.Date(2018, 6, 5, 17, 0, 0, 0, time.UTC); purchaseOrder.ExpectedDelDate == nil || !purchaseOrder.ExpectedDelDate.Equal(want) {
+			t.Errorf("%s: expected delivery date = %v, want %v", tt.name, purchaseOrder.ExpectedDelDate, want)
+		}
+		wantShipTo := Location{LocationID: "WH01", Street: "1 rue de Rivoli", PostalCode: "75001", City: "Paris", Country: "FR", Address: "1 rue de Rivoli, Paris, 75001, FR"}
+		if purchaseOrder.ShipTO == nil || *purchaseOrder.ShipTO != wantShipTo {
+			t.Errorf("%s: ship to = %+v, want %+v", tt.name, purchaseOrder.ShipTO, wantShipTo)
+		}
+	}
+}
+
+func TestParsePurchaseOrderWrongTransactionSet(t *testing.T) {
+	document, err := ParsePurchaseOrder(transactionSet("856"))
+	if document != nil || err == nil {
+		t.Fatalf("an 856 was translated as a purchase order: %+v", document)
+	}
+}
@@ -0,0 +1,231 @@
+// Package edi translates ANSI X12 850 purchase orders and 856 advance ship notices
+// into the purchase orders, shipments and logistics units of the supply chain chaincode.
+package edi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isaLength is the fixed length of the ISA segment including its terminator
+const isaLength = 106
+
+// Segment is one X12 segment. Elements[0] is the segment ID so Element(n) follows X12 numbering.
+type Segment struct {
+	Position int
+	Elements []string
+}
+
+// ID is the segment identifier, e.g. BEG or HL
+func (s Segment) ID() string {
+	return s.Elements[0]
+}
+
+// Element returns the n-th element trimmed, empty if the segment is shorter
+func (s Segment) Element(n int) string {
+	if n < len(s.Elements) {
+		return strings.TrimSpace(s.Elements[n])
+	}
+	return ""
+}
+
+// SegmentError locates a problem in an interchange. Position is the 1-based segment position
+// in the interchange and Element the 1-based element, 0 when the whole segment is at fault.
+type SegmentError struct {
+	Position  int
+	SegmentID string
+	Element   int
+	Message   string
+}
+
+func (e *SegmentError) Error() string {
+	if e.Element > 0 {
+		return fmt.Sprintf("segment %d %s%02d: %s", e.Position, e.SegmentID, e.Element, e.Message)
+	}
+	return fmt.Sprintf("segment %d %s: %s", e.Position, e.SegmentID, e.Message)
+}
+
+// ErrorList collects every segment error of an interchange instead of stopping at the first
+type ErrorList []*SegmentError
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// add records an error against a segment
+func (l *ErrorList) add(segment Segment, element int, format string, a ...interface{}) {
+	*l = append(*l, &SegmentError{Position: segment.Position, SegmentID: segment.ID(), Element: element, Message: fmt.Sprintf(format, a...)})
+}
+
+// err returns the list as an error, nil when empty
+func (l ErrorList) err() error {
+	if len(l) <= 0 {
+		return nil
+	}
+	return l
+}
+
+// Transaction is one ST/SE transaction set, Segments excludes the ST and SE segments
+type Transaction struct {
+	Code          string
+	ControlNumber string
+	SenderID      string
+	ReceiverID    string
+	Start         Segment
+	Segments      []Segment
+}
+
+// Interchange is a parsed ISA/IEA envelope with the transaction sets of all its functional groups
+type Interchange struct {
+	SenderID      string
+	ReceiverID    string
+	ControlNumber string
+	Transactions  []Transaction
+}
+
+// Parse splits an interchange into transaction sets and checks the ISA/GS/ST envelopes,
+// their control numbers and counts. The separators are read from the ISA segment.
+func Parse(data []byte) (*Interchange, error) {
+	data = bytes.TrimLeft(data, "\ufeff \t\r\n")
+	if len(data) < isaLength || string(data[:3]) != "ISA" {
+		return nil, ErrorList{{Position: 1, SegmentID: "ISA", Message: "interchange must start with a 106 character ISA segment"}}
+	}
+	elementSeparator := string(data[3])
+	segmentTerminator := string(data[isaLength-1])
+
+	var segments []Segment
+	for _, raw := range strings.Split(string(data), segmentTerminator) {
+		raw = strings.Trim(raw, "\r\n")
+		if len(strings.TrimSpace(raw)) <= 0 {
+			continue
+		}
+		segments = append(segments, Segment{Position: len(segments) + 1, Elements: strings.Split(raw, elementSeparator)})
+	}
+
+	var errs ErrorList
+	interchange := &Interchange{}
+	isa := segments[0]
+	if len(isa.Elements) != 17 {
+		errs.add(isa, 0, "ISA must have 16 elements, found %d", len(isa.Elements)-1)
+	}
+	interchange.SenderID = isa.Element(6)
+	interchange.ReceiverID = isa.Element(8)
+	interchange.ControlNumber = isa.Element(13)
+
+	var groups int
+	var group, transaction *Segment
+	var groupTransactions int
+	var current *Transaction
+	for _, segment := range segments[1:] {
+		switch segment.ID() {
+		case "GS":
+			if group != nil {
+				errs.add(segment, 0, "functional group started before GS at segment %d was closed", group.Position)
+			}
+			start := segment
+			group = &start
+			groupTransactions = 0
+			groups++
+		case "GE":
+			if group == nil {
+				errs.add(segment, 0, "GE without GS")
+				continue
+			}
+			if segment.Element(2) != group.Element(6) {
+				errs.add(segment, 2, "group control number %s does not match GS06 %s", segment.Element(2), group.Element(6))
+			}
+			if count, err := strconv.Atoi(segment.Element(1)); err != nil || count != groupTransactions {
+				errs.add(segment, 1, "group declares %s transaction sets, found %d", segment.Element(1), groupTransactions)
+			}
+			group = nil
+		case "ST":
+			if group == nil {
+				errs.add(segment, 0, "transaction set outside of a functional group")
+			}
+			if transaction != nil {
+				errs.add(segment, 0, "transaction set started before ST at segment %d was closed", transaction.Position)
+			}
+			start := segment
+			transaction = &start
+			current = &Transaction{
+				Code:          segment.Element(1),
+				ControlNumber: segment.Element(2),
+				SenderID:      interchange.SenderID,
+				ReceiverID:    interchange.ReceiverID,
+				Start:         segment,
+			}
+		case "SE":
+			if transaction == nil {
+				errs.add(segment, 0, "SE without ST")
+				continue
+			}
+			if segment.Element(2) != transaction.Element(2) {
+				errs.add(segment, 2, "transaction set control number %s does not match ST02 %s", segment.Element(2), transaction.Element(2))
+			}
+			included := segment.Position - transaction.Position + 1
+			if count, err := strconv.Atoi(segment.Element(1)); err != nil || count != included {
+				errs.add(segment, 1, "transaction set declares %s segments, found %d", segment.Element(1), included)
+			}
+			interchange.Transactions = append(interchange.Transactions, *current)
+			groupTransactions++
+			transaction = nil
+			current = nil
+		case "IEA":
+			if segment.Element(2) != interchange.ControlNumber {
+				errs.add(segment, 2, "interchange control number %s does not match ISA13 %s", segment.Element(2), interchange.ControlNumber)
+			}
+			if count, err := strconv.Atoi(segment.Element(1)); err != nil || count != groups {
+				errs.add(segment, 1, "interchange declares %s functional groups, found %d", segment.Element(1), groups)
+			}
+			if segment.Position != len(segments) {
+				errs.add(segment, 0, "segments found after IEA")
+			}
+		default:
+			if current == nil {
+				errs.add(segment, 0, "segment outside of a transaction set")
+				continue
+			}
+			current.Segments = append(current.Segments, segment)
+		}
+	}
+	last := segments[len(segments)-1]
+	if transaction != nil {
+		errs.add(last, 0, "transaction set ST at segment %d is not closed by SE", transaction.Position)
+	}
+	if group != nil {
+		errs.add(last, 0, "functional group GS at segment %d is not closed by GE", group.Position)
+	}
+	if last.ID() != "IEA" {
+		errs.add(last, 0, "interchange is not closed by IEA")
+	}
+	return interchange, errs.err()
+}
+
+// parseDate reads an X12 date (CCYYMMDD or YYMMDD) with an optional time (HHMM or HHMMSS) as UTC
+func parseDate(date, clock string) (time.Time, error) {
+	layout := "20060102"
+	if len(date) == 6 {
+		layout = "060102"
+	}
+	switch len(clock) {
+	case 0:
+	case 4:
+		layout += "1504"
+	case 6:
+		layout += "150405"
+	default:
+		return time.Time{}, fmt.Errorf("time must be HHMM or HHMMSS: %s", clock)
+	}
+	parsed, err := time.Parse(layout, date+clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be CCYYMMDD: %s", date)
+	}
+	return parsed.UTC(), nil
+}
@@ -0,0 +1,155 @@
+package edi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isa is an ISA segment from SENDER to RECEIVER with control number 000000001,
+// "*" separating elements and "~" terminating segments
+var isa = fmt.Sprintf("ISA*00*%-10s*00*%-10s*ZZ*%-15s*ZZ*%-15s*180605*1700*U*00401*000000001*0*P*>~", "", "", "SENDER", "RECEIVER")
+
+// interchange joins an ISA header and the following segments, each given without its terminator
+func interchange(segments ...string) []byte {
+	return []byte(isa + "\n" + strings.Join(segments, "~\n") + "~\n")
+}
+
+// transactionSet builds a transaction set as Parse would, the ST segment at position 1
+// and the given segments numbered after it
+func transactionSet(code string, segments ...string) Transaction {
+	transaction := Transaction{Code: code, ControlNumber: "0001", Start: Segment{Position: 1, Elements: []string{"ST", code, "0001"}}}
+	for i, raw := range segments {
+		transaction.Segments = append(transaction.Segments, Segment{Position: i + 2, Elements: strings.Split(raw, "*")})
+	}
+	return transaction
+}
+
+// errorPositions lists the segment position and element of every error in err
+func errorPositions(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got %T: %v", err, err)
+	}
+	var positions []string
+	for _, segmentErr := range errs {
+		positions = append(positions, fmt.Sprintf("%d %s%02d", segmentErr.Position, segmentErr.SegmentID, segmentErr.Element))
+	}
+	return positions
+}
+
+func TestISAHeaderLength(t *testing.T) {
+	if len(isa) != isaLength {
+		t.Fatalf("test ISA segment is %d characters, want %d", len(isa), isaLength)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		transactions []string
+		wantErrs     []string
+	}{
+		{
+			name: "one group of two transaction sets",
+			data: interchange(
+				"GS*PO*SENDER*RECEIVER*20180605*1700*1*X*004010",
+				"ST*850*0001", "BEG*00*SA*PO1", "SE*3*0001",
+				"ST*856*0002", "BSN*00*ASN1*20180605*1700", "SE*3*0002",
+				"GE*2*1",
+				"IEA*1*000000001"),
+			transactions: []string{"850 0001", "856 0002"},
+		},
+		{
+			name: "byte order mark and blank lines",
+			data: append([]byte("\ufeff\r\n"), interchange(
+				"GS*PO*SENDER*RECEIVER*20180605*1700*1*X*004010",
+				"ST*850*0001", "SE*2*0001",
+				"GE*1*1",
+				"IEA*1*000000001")...),
+			transactions: []string{"850 0001"},
+		},
+		{
+			name:     "not an interchange",
+			data:     []byte("GS*PO*SENDER*RECEIVER~"),
+			wantErrs: []string{"1 ISA00"},
+		},
+		{
+			name: "mismatched control numbers and counts",
+			data: interchange(
+				"GS*PO*SENDER*RECEIVER*20180605*1700*1*X*004010",
+				"ST*850*0001", "BEG*00*SA*PO1", "SE*2*0009",
+				"GE*3*2",
+				"IEA*2*000000002"),
+			transactions: []string{"850 0001"},
+			wantErrs:     []string{"5 SE02", "5 SE01", "6 GE02", "6 GE01", "7 IEA02", "7 IEA01"},
+		},
+		{
+			name: "transaction set outside a group and never closed",
+			data: interchange(
+				"ST*850*0001", "BEG*00*SA*PO1",
+				"IEA*0*000000001"),
+			wantErrs: []string{"2 ST00", "4 IEA00"},
+		},
+		{
+			name: "segment outside a transaction set and missing IEA",
+			data: interchange(
+				"GS*PO*SENDER*RECEIVER*20180605*1700*1*X*004010",
+				"BEG*00*SA*PO1",
+				"GE*0*1"),
+			wantErrs: []string{"3 BEG00", "4 GE00"},
+		},
+	}
+	for _, tt := range tests {
+		parsed, err := Parse(tt.data)
+		if got := errorPositions(t, err); !reflect.DeepEqual(got, tt.wantErrs) {
+			t.Errorf("%s: errors = %v, want %v\n%v", tt.name, got, tt.wantErrs, err)
+		}
+		if parsed == nil {
+			continue
+		}
+		var transactions []string
+		for _, transaction := range parsed.Transactions {
+			transactions = append(transactions, transaction.Code+" "+transaction.ControlNumber)
+			if transaction.SenderID != "SENDER" || transaction.ReceiverID != "RECEIVER" {
+				t.Errorf("%s: transaction %s from %q to %q", tt.name, transaction.ControlNumber, transaction.SenderID, transaction.ReceiverID)
+			}
+		}
+		if !reflect.DeepEqual(transactions, tt.transactions) {
+			t.Errorf("%s: transactions = %v, want %v", tt.name, transactions, tt.transactions)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		date, clock string
+		want        time.Time
+		wantErr     bool
+	}{
+		{"20180605", "", time.Date(2018, 6, 5, 0, 0, 0, 0, time.UTC), false},
+		{"180605", "", time.Date(2018, 6, 5, 0, 0, 0, 0, time.UTC), false},
+		{"20180605", "1700", time.Date(2018, 6, 5, 17, 0, 0, 0, time.UTC), false},
+		{"20180605", "170030", time.Date(2018, 6, 5, 17, 0, 30, 0, time.UTC), false},
+		{"20180605", "17", time.Time{}, true},
+		{"20181305", "", time.Time{}, true},
+		{"2018-06-05", "", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.date, tt.clock)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDate(%q, %q) error = %v, wantErr %v", tt.date, tt.clock, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q, %q) = %v, want %v", tt.date, tt.clock, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Command shipment2epcis converts the ledger history of a shipment into a GS1 EPCIS 2.0 JSON-LD document.
+//
+//	peer chaincode query -C $CHANNEL_NAME -n supplychain -c '{"Args":["getShipmentTraceability","SHIP1"]}' | shipment2epcis
+//
+// The input is the result of getShipmentTraceability, or of getHistoryForShipment for the shipment
+// events alone, read from the file given as argument or standard input.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hyperledger/fabric/peer/crypto/crypto-config/opensource.com/HLF/tools/epcis"
+)
+
+func main() {
+	namespace := flag.String("namespace", epcis.DefaultNamespace, "URI prefix of the ledger identifiers that are not GS1 keys")
+	flag.Parse()
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: shipment2epcis [-namespace uri] [file]")
+		os.Exit(2)
+	}
+
+	var data []byte
+	var err error
+	if flag.NArg() == 0 || flag.Arg(0) == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var trace *epcis.ShipmentTraceability
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		trace, err = epcis.ParseHistory(trimmed)
+	} else {
+		trace = &epcis.ShipmentTraceability{}
+		err = json.Unmarshal(data, trace)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid shipment history:", err)
+		os.Exit(1)
+	}
+
+	documentAsBytes, err := json.MarshalIndent(epcis.Convert(trace, epcis.Options{Namespace: *namespace}), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(documentAsBytes))
+}
@@ -0,0 +1,357 @@
+// Package epcis converts the ledger history of a supply chain shipment into a GS1 EPCIS 2.0
+// JSON-LD document: ObjectEvents for the shipment lifecycle, its location changes and GPS fixes,
+// and AggregationEvents for the packaging of its logistics units.
+package epcis
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EPCIS 2.0 JSON-LD context and schema version
+const (
+	ContextURL    = "https://ref.gs1.org/standards/epcis/2.0.0/epcis-context.jsonld"
+	SchemaVersion = "2.0"
+)
+
+// DefaultNamespace prefixes the URIs of ledger identifiers that are not GS1 keys
+const DefaultNamespace = "urn:supplychain:"
+
+// event types and actions
+const (
+	objectEvent      = "ObjectEvent"
+	aggregationEvent = "AggregationEvent"
+
+	actionAdd     = "ADD"
+	actionObserve = "OBSERVE"
+	actionDelete  = "DELETE"
+)
+
+// Step is the CBV business step and disposition of an event
+type Step struct {
+	BizStep     string
+	Disposition string
+}
+
+// ShipmentSteps maps the shipment lifecycle onto CBV 2.0 business steps and dispositions
+var ShipmentSteps = map[ShipmentOrderState]Step{
+	Waiting:             {"staging_outbound", "in_progress"},
+	Loading:             {"loading", "in_progress"},
+	Loaded:              {"departing", "in_transit"},
+	InTransit:           {"transporting", "in_transit"},
+	DeliveredComplete:   {"receiving", "in_progress"},
+	DeliveredIncomplete: {"receiving", "mismatch_quantity"},
+}
+
+// steps of the events that do not come from a shipment state
+var (
+	routeStep          = Step{"transporting", "in_transit"}
+	voidShipmentStep   = Step{"void_shipping", ""}
+	commissionUnitStep = Step{"commissioning", "active"}
+	moveUnitStep       = Step{"transporting", ""}
+	packStep           = Step{"packing", ""}
+	unpackStep         = Step{"unpacking", ""}
+	removeUnitStep     = Step{"decommissioning", "inactive"}
+)
+
+// CBV business transaction types of the shipment references
+const (
+	bizTransactionPO     = "po"
+	bizTransactionDesadv = "desadv"
+)
+
+// Document is an EPCISDocument
+type Document struct {
+	Context       []interface{} `json:"@context"`
+	Type          string        `json:"type"`
+	SchemaVersion string        `json:"schemaVersion"`
+	CreationDate  time.Time     `json:"creationDate"`
+	Body          Body          `json:"epcisBody"`
+}
+
+// Body holds the events of a document in time order
+type Body struct {
+	EventList []Event `json:"eventList"`
+}
+
+// Event is an ObjectEvent or an AggregationEvent. The ledger transaction that recorded it is kept
+// in the supplychain:txID extension.
+type Event struct {
+	Type                string           `json:"type"`
+	EventTime           time.Time        `json:"eventTime"`
+	EventTimeZoneOffset string           `json:"eventTimeZoneOffset"`
+	ParentID            string           `json:"parentID,omitempty"`
+	EPCList             []string         `json:"epcList,omitempty"`
+	ChildEPCs           []string         `json:"childEPCs,omitempty"`
+	Action              string           `json:"action"`
+	BizStep             string           `json:"bizStep,omitempty"`
+	Disposition         string           `json:"disposition,omitempty"`
+	ReadPoint           *Place           `json:"readPoint,omitempty"`
+	BizLocation         *Place           `json:"bizLocation,omitempty"`
+	BizTransactionList  []BizTransaction `json:"bizTransactionList,omitempty"`
+	TxID                string           `json:"supplychain:txID,omitempty"`
+}
+
+// Place is a read point or business location
+type Place struct {
+	ID string `json:"id"`
+}
+
+// BizTransaction references a business document
+type BizTransaction struct {
+	Type           string `json:"type"`
+	BizTransaction string `json:"bizTransaction"`
+}
+
+// Options tune the conversion
+type Options struct {
+	// Namespace prefixes the URIs of ledger identifiers that are not GS1 keys, DefaultNamespace if empty
+	Namespace string
+	// CreationDate of the document, the current time if zero
+	CreationDate time.Time
+}
+
+// GS1 keys recognised in ledger identifiers, rendered as GS1 Digital Link URIs
+var (
+	ssccPattern = regexp.MustCompile(`^[0-9]{18}$`)
+	gsinPattern = regexp.MustCompile(`^[0-9]{17}$`)
+	glnPattern  = regexp.MustCompile(`^[0-9]{13}$`)
+)
+
+// converter builds the events of one shipment
+type converter struct {
+	namespace string
+	events    []Event
+	merged    map[string]int
+}
+
+func (c *converter) unitURI(logisticsUnitID string) string {
+	if ssccPattern.MatchString(logisticsUnitID) {
+		return "https://id.gs1.org/00/" + logisticsUnitID
+	}
+	return c.namespace + "logisticsUnit:" + logisticsUnitID
+}
+
+func (c *converter) shipmentURI(shipmentID string) string {
+	if gsinPattern.MatchString(shipmentID) {
+		return "https://id.gs1.org/402/" + shipmentID
+	}
+	return c.namespace + "shipment:" + shipmentID
+}
+
+// places renders a location as a business location and, when it has coordinates, a geo read point
+func (c *converter) places(location Location) (readPoint, bizLocation *Place) {
+	if location.Latitude != nil && location.Longitude != nil {
+		readPoint = geoPlace(*location.Latitude, *location.Longitude)
+	}
+	if glnPattern.MatchString(location.LocationID) {
+		bizLocation = &Place{ID: "https://id.gs1.org/414/" + location.LocationID}
+	} else if len(location.LocationID) > 0 {
+		bizLocation = &Place{ID: c.namespace + "location:" + location.LocationID}
+	}
+	return readPoint, bizLocation
+}
+
+// geoPlace is an RFC 5870 geo URI
+func geoPlace(latitude, longitude float64) *Place {
+	return &Place{ID: "geo:" + strconv.FormatFloat(latitude, 'f', -1, 64) + "," + strconv.FormatFloat(longitude, 'f', -1, 64)}
+}
+
+// add appends an event, or adds its EPCs to an event of the same transaction that only
+// differs by them, so moving or packing a whole tree gives one event rather than one per unit
+func (c *converter) add(event Event) {
+	event.EventTime = event.EventTime.UTC()
+	event.EventTimeZoneOffset = "+00:00"
+	key := event.Type + "|" + event.Action + "|" + event.TxID + "|" + event.ParentID + "|" + event.BizStep + "|" + event.Disposition
+	if event.ReadPoint != nil {
+		key += "|" + event.ReadPoint.ID
+	}
+	if event.BizLocation != nil {
+		key += "|" + event.BizLocation.ID
+	}
+	if len(event.TxID) > 0 {
+		if index, found := c.merged[key]; found {
+			c.events[index].EPCList = append(c.events[index].EPCList, event.EPCList...)
+			c.events[index].ChildEPCs = append(c.events[index].ChildEPCs, event.ChildEPCs...)
+			return
+		}
+		c.merged[key] = len(c.events)
+	}
+	// ==== Copy the EPCs, events share the shipment EPC list and merging appends to it ====
+	event.EPCList = append([]string(nil), event.EPCList...)
+	event.ChildEPCs = append([]string(nil), event.ChildEPCs...)
+	c.events = append(c.events, event)
+}
+
+// Convert builds the EPCIS document of a shipment. Each shipment version that creates the shipment,
+// changes its state or its location gives an ObjectEvent with the business step of the state
+// (ShipmentSteps); a deleted shipment is voided. GPS fixes are transporting observations at a geo
+// read point. Logistics units are commissioned, observed when they move, and packed into or unpacked
+// from their parent with AggregationEvents. The shipment events cover the outermost units of the
+// shipment, or the shipment itself when it has none.
+func Convert(trace *ShipmentTraceability, options Options) *Document {
+	c := &converter{namespace: options.Namespace, merged: map[string]int{}}
+	if len(c.namespace) <= 0 {
+		c.namespace = DefaultNamespace
+	}
+	document := &Document{
+		Context:       []interface{}{ContextURL, map[string]string{"supplychain": c.namespace}},
+		Type:          "EPCISDocument",
+		SchemaVersion: SchemaVersion,
+		CreationDate:  options.CreationDate,
+	}
+	if document.CreationDate.IsZero() {
+		document.CreationDate = time.Now().UTC()
+	}
+
+	epcs := c.outermostUnits(trace)
+	if len(epcs) <= 0 && len(trace.ShipmentID) > 0 {
+		epcs = []string{c.shipmentURI(trace.ShipmentID)}
+	}
+
+	history := append([]ShipmentVersion(nil), trace.History...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Timestamp.Before(history[j].Timestamp) })
+	var previous *Shipment
+	var transactions []BizTransaction
+	for _, version := range history {
+		event := Event{Type: objectEvent, EventTime: version.Timestamp, EPCList: epcs, TxID: version.TxID}
+		if version.IsDelete {
+			event.Action = actionDelete
+			event.BizStep = voidShipmentStep.BizStep
+			event.BizTransactionList = transactions
+			c.add(event)
+			previous = nil
+			continue
+		}
+		shipment := version.Shipment
+		if previous != nil && previous.ShipmentOrderState == shipment.ShipmentOrderState && previous.Location.sameAs(shipment.Location) {
+			previous = shipment
+			continue
+		}
+		event.Action = actionObserve
+		if previous == nil {
+			event.Action = actionAdd
+		}
+		step := ShipmentSteps[shipment.ShipmentOrderState]
+		event.BizStep, event.Disposition = step.BizStep, step.Disposition
+		event.ReadPoint, event.BizLocation = c.places(shipment.Location)
+		transactions = []BizTransaction{{Type: bizTransactionDesadv, BizTransaction: c.shipmentURI(shipment.ShipmentID)}}
+		if len(shipment.PurchaseOrder.PurchaseOrderID) > 0 {
+			transactions = append(transactions, BizTransaction{Type: bizTransactionPO, BizTransaction: c.namespace + "purchaseOrder:" + shipment.PurchaseOrder.PurchaseOrderID})
+		}
+		event.BizTransactionList = transactions
+		c.add(event)
+		previous = shipment
+	}
+
+	for _, fix := range trace.Route {
+		c.add(Event{
+			Type:               objectEvent,
+			EventTime:          fix.RecordedAt,
+			EPCList:            epcs,
+			Action:             actionObserve,
+			BizStep:            routeStep.BizStep,
+			Disposition:        routeStep.Disposition,
+			ReadPoint:          geoPlace(fix.Latitude, fix.Longitude),
+			BizTransactionList: transactions,
+			TxID:               fix.TxID,
+		})
+	}
+
+	for _, unit := range trace.LogisticsUnits {
+		c.addUnitEvents(unit)
+	}
+
+	sort.SliceStable(c.events, func(i, j int) bool { return c.events[i].EventTime.Before(c.events[j].EventTime) })
+	document.Body.EventList = c.events
+	if document.Body.EventList == nil {
+		document.Body.EventList = []Event{}
+	}
+	return document
+}
+
+// outermostUnits lists the units whose latest version is not packed into another unit of the shipment
+func (c *converter) outermostUnits(trace *ShipmentTraceability) []string {
+	latest := map[string]*LogisticsUnit{}
+	for _, unit := range trace.LogisticsUnits {
+		latest[unit.LogisticsUnitID] = nil
+		var newest time.Time
+		for i, version := range unit.History {
+			if !version.Timestamp.Before(newest) {
+				newest = version.Timestamp
+				latest[unit.LogisticsUnitID] = unit.History[i].Unit
+			}
+		}
+	}
+	var epcs []string
+	for _, unit := range trace.LogisticsUnits {
+		current := latest[unit.LogisticsUnitID]
+		if current == nil {
+			continue
+		}
+		if _, packedInShipment := latest[current.ParentID]; packedInShipment && len(current.ParentID) > 0 {
+			continue
+		}
+		epcs = append(epcs, c.unitURI(unit.LogisticsUnitID))
+	}
+	return epcs
+}
+
+// addUnitEvents converts the history of one logistics unit
+func (c *converter) addUnitEvents(trace LogisticsUnitTrace) {
+	history := append([]LogisticsUnitVersion(nil), trace.History...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Timestamp.Before(history[j].Timestamp) })
+	epc := c.unitURI(trace.LogisticsUnitID)
+	var previous *LogisticsUnit
+	for _, version := range history {
+		if version.IsDelete {
+			if previous != nil && len(previous.ParentID) > 0 {
+				c.add(aggregation(version, c.unitURI(previous.ParentID), epc, actionDelete, unpackStep))
+			}
+			c.add(Event{Type: objectEvent, EventTime: version.Timestamp, EPCList: []string{epc}, Action: actionDelete,
+				BizStep: removeUnitStep.BizStep, Disposition: removeUnitStep.Disposition, TxID: version.TxID})
+			previous = nil
+			continue
+		}
+		unit := version.Unit
+		if previous == nil {
+			event := Event{Type: objectEvent, EventTime: version.Timestamp, EPCList: []string{epc}, Action: actionAdd,
+				BizStep: commissionUnitStep.BizStep, Disposition: commissionUnitStep.Disposition, TxID: version.TxID}
+			event.ReadPoint, event.BizLocation = c.places(unit.Location)
+			c.add(event)
+		} else if !previous.Location.sameAs(unit.Location) {
+			event := Event{Type: objectEvent, EventTime: version.Timestamp, EPCList: []string{epc}, Action: actionObserve,
+				BizStep: moveUnitStep.BizStep, Disposition: moveUnitStep.Disposition, TxID: version.TxID}
+			event.ReadPoint, event.BizLocation = c.places(unit.Location)
+			c.add(event)
+		}
+		var previousParentID string
+		if previous != nil {
+			previousParentID = previous.ParentID
+		}
+		if previousParentID != unit.ParentID {
+			if len(previousParentID) > 0 {
+				c.add(aggregation(version, c.unitURI(previousParentID), epc, actionDelete, unpackStep))
+			}
+			if len(unit.ParentID) > 0 {
+				c.add(aggregation(version, c.unitURI(unit.ParentID), epc, actionAdd, packStep))
+			}
+		}
+		previous = unit
+	}
+}
+
+// aggregation packs a child into, or unpacks it from, its parent
+func aggregation(version LogisticsUnitVersion, parentID, childEPC, action string, step Step) Event {
+	return Event{
+		Type:      aggregationEvent,
+		EventTime: version.Timestamp,
+		ParentID:  parentID,
+		ChildEPCs: []string{childEPC},
+		Action:    action,
+		BizStep:   step.BizStep,
+		TxID:      version.TxID,
+	}
+}
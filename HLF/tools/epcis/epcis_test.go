@@ -0,0 +1,227 @@
+package epcis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2018, 6, 5, 8, 0, 0, 0, time.UTC)
+
+// at is the test start time moved by a number of hours
+func at(hours int) time.Time {
+	return start.Add(time.Duration(hours) * time.Hour)
+}
+
+// summarize renders the fields of an event the tests compare on one line
+func summarize(event Event) string {
+	parts := []string{event.Type, event.Action, event.BizStep}
+	if len(event.Disposition) > 0 {
+		parts = append(parts, "disposition="+event.Disposition)
+	}
+	if len(event.ParentID) > 0 {
+		parts = append(parts, "parent="+event.ParentID)
+	}
+	if len(event.EPCList) > 0 {
+		parts = append(parts, "epcs="+strings.Join(event.EPCList, ","))
+	}
+	if len(event.ChildEPCs) > 0 {
+		parts = append(parts, "children="+strings.Join(event.ChildEPCs, ","))
+	}
+	if event.ReadPoint != nil {
+		parts = append(parts, "readPoint="+event.ReadPoint.ID)
+	}
+	if event.BizLocation != nil {
+		parts = append(parts, "bizLocation="+event.BizLocation.ID)
+	}
+	return strings.Join(append(parts, "tx="+event.TxID), " ")
+}
+
+func TestConvert(t *testing.T) {
+	latitude, longitude := 48.8566, 2.3522
+	warehouse := Location{LocationID: "0614141000012"}
+	depot := Location{LocationID: "DEP01"}
+	pallet := "001234560000000018"
+	unit := func(logisticsUnitID, parentID string) *LogisticsUnit {
+		return &LogisticsUnit{LogisticsUnitID: logisticsUnitID, ParentID: parentID, ShipmentID: "S2", Location: depot}
+	}
+	tests := []struct {
+		name  string
+		trace ShipmentTraceability
+		want  []string
+	}{
+		{
+			name:  "empty trace",
+			trace: ShipmentTraceability{},
+			want:  []string{},
+		},
+		{
+			name: "shipment lifecycle without units",
+			trace: ShipmentTraceability{
+				ShipmentID: "S1",
+				History: []ShipmentVersion{
+					{TxID: "tx5", Timestamp: at(4), IsDelete: true},
+					{TxID: "tx1", Timestamp: at(0), Shipment: &Shipment{ShipmentID: "S1", Location: warehouse}},
+					{TxID: "tx2", Timestamp: at(1), Shipment: &Shipment{ShipmentID: "S1", Location: warehouse}},
+					{TxID: "tx3", Timestamp: at(2), Shipment: &Shipment{ShipmentID: "S1", ShipmentOrderState: InTransit,
+						Location: Location{LocationID: warehouse.LocationID, Latitude: &latitude, Longitude: &longitude}}},
+				},
+				Route: []PositionFix{{Latitude: 48.9, Longitude: 2.5, RecordedAt: at(3), TxID: "tx4"}},
+			},
+			want: []string{
+				"ObjectEvent ADD staging_outbound disposition=in_progress epcs=urn:supplychain:shipment:S1 bizLocation=https://id.gs1.org/414/0614141000012 tx=tx1",
+				"ObjectEvent OBSERVE transporting disposition=in_transit epcs=urn:supplychain:shipment:S1 readPoint=geo:48.8566,2.3522 bizLocation=https://id.gs1.org/414/0614141000012 tx=tx3",
+				"ObjectEvent OBSERVE transporting disposition=in_transit epcs=urn:supplychain:shipment:S1 readPoint=geo:48.9,2.5 tx=tx4",
+				"ObjectEvent DELETE void_shipping epcs=urn:supplychain:shipment:S1 tx=tx5",
+			},
+		},
+		{
+			name: "units packed into a pallet in one transaction",
+			trace: ShipmentTraceability{
+				ShipmentID: "S2",
+				History: []ShipmentVersion{
+					{TxID: "tx0", Timestamp: at(0), Shipment: &Shipment{ShipmentID: "S2", Location: depot}},
+				},
+				LogisticsUnits: []LogisticsUnitTrace{
+					{LogisticsUnitID: pallet, History: []LogisticsUnitVersion{{TxID: "tx1", Timestamp: at(1), Unit: unit(pallet, "")}}},
+					{LogisticsUnitID: "unit01", History: []LogisticsUnitVersion{
+						{TxID: "tx1", Timestamp: at(1), Unit: unit("unit01", "")},
+						{TxID: "tx2", Timestamp: at(2), Unit: unit("unit01", pallet)},
+					}},
+					{LogisticsUnitID: "unit02", History: []LogisticsUnitVersion{
+						{TxID: "tx1", Timestamp: at(1), Unit: unit("unit02", "")},
+						{TxID: "tx2", Timestamp: at(2), Unit: unit("unit02", pallet)},
+					}},
+				},
+			},
+			want: []string{
+				"ObjectEvent ADD staging_outbound disposition=in_progress epcs=https://id.gs1.org/00/001234560000000018 bizLocation=urn:supplychain:location:DEP01 tx=tx0",
+				"ObjectEvent ADD commissioning disposition=active epcs=https://id.gs1.org/00/001234560000000018,urn:supplychain:logisticsUnit:unit01,urn:supplychain:logisticsUnit:unit02 bizLocation=urn:supplychain:location:DEP01 tx=tx1",
+				"AggregationEvent ADD packing parent=https://id.gs1.org/00/001234560000000018 children=urn:supplychain:logisticsUnit:unit01,urn:supplychain:logisticsUnit:unit02 tx=tx2",
+			},
+		},
+		{
+			name: "unit moved, unpacked and removed",
+			trace: ShipmentTraceability{
+				LogisticsUnits: []LogisticsUnitTrace{
+					{LogisticsUnitID: "unit01", History: []LogisticsUnitVersion{
+						{TxID: "tx1", Timestamp: at(1), Unit: unit("unit01", pallet)},
+						{TxID: "tx2", Timestamp: at(2), Unit: &LogisticsUnit{LogisticsUnitID: "unit01", ParentID: pallet, Location: warehouse}},
+						{TxID: "tx3", Timestamp: at(3), Unit: &LogisticsUnit{LogisticsUnitID: "unit01", Location: warehouse}},
+						{TxID: "tx4", Timestamp: at(4), IsDelete: true},
+					}},
+				},
+			},
+			want: []string{
+				"ObjectEvent ADD commissioning disposition=active epcs=urn:supplychain:logisticsUnit:unit01 bizLocation=urn:supplychain:location:DEP01 tx=tx1",
+				"AggregationEvent ADD packing parent=https://id.gs1.org/00/001234560000000018 children=urn:supplychain:logisticsUnit:unit01 tx=tx1",
+				"ObjectEvent OBSERVE transporting epcs=urn:supplychain:logisticsUnit:unit01 bizLocation=https://id.gs1.org/414/0614141000012 tx=tx2",
+				"AggregationEvent DELETE unpacking parent=https://id.gs1.org/00/001234560000000018 children=urn:supplychain:logisticsUnit:unit01 tx=tx3",
+				"ObjectEvent DELETE decommissioning disposition=inactive epcs=urn:supplychain:logisticsUnit:unit01 tx=tx4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		document := Convert(&tt.trace, Options{CreationDate: start})
+		if document.Body.EventList == nil {
+			t.Errorf("%s: event list is nil", tt.name)
+		}
+		got := []string{}
+		for _, event := range document.Body.EventList {
+			got = append(got, summarize(event))
+			if event.EventTimeZoneOffset != "+00:00" || event.EventTime.Location() != time.UTC {
+				t.Errorf("%s: event %s at %v %s, want UTC", tt.name, event.TxID, event.EventTime, event.EventTimeZoneOffset)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events =\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+		if !document.CreationDate.Equal(start) || document.SchemaVersion != SchemaVersion || document.Type != "EPCISDocument" {
+			t.Errorf("%s: document header %+v", tt.name, document)
+		}
+	}
+}
+
+func TestConvertNamespace(t *testing.T) {
+	trace := &ShipmentTraceability{
+		ShipmentID: "06141411234567890",
+		History: []ShipmentVersion{{TxID: "tx1", Timestamp: start, Shipment: &Shipment{
+			ShipmentID:    "06141411234567890",
+			PurchaseOrder: PurchaseOrder{PurchaseOrderID: "PO1"},
+			Location:      Location{LocationID: "WH01"},
+		}}},
+	}
+	document := Convert(trace, Options{Namespace: "urn:acme:", CreationDate: start})
+	if want := map[string]string{"supplychain": "urn:acme:"}; !reflect.DeepEqual(document.Context[1], want) {
+		t.Errorf("context = %v, want %v", document.Context[1], want)
+	}
+	if len(document.Body.EventList) != 1 {
+		t.Fatalf("events = %+v, want one", document.Body.EventList)
+	}
+	event := document.Body.EventList[0]
+	if got, want := summarize(event), "ObjectEvent ADD staging_outbound disposition=in_progress epcs=https://id.gs1.org/402/06141411234567890 bizLocation=urn:acme:location:WH01 tx=tx1"; got != want {
+		t.Errorf("event = %s, want %s", got, want)
+	}
+	wantTransactions := []BizTransaction{
+		{Type: "desadv", BizTransaction: "https://id.gs1.org/402/06141411234567890"},
+		{Type: "po", BizTransaction: "urn:acme:purchaseOrder:PO1"},
+	}
+	if !reflect.DeepEqual(event.BizTransactionList, wantTransactions) {
+		t.Errorf("business transactions = %+v, want %+v", event.BizTransactionList, wantTransactions)
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     []string
+		wantErr  bool
+		shipment string
+	}{
+		{
+			name: "created then deleted",
+			data: `[{"TxID":"tx1","Value":{"shipmentID":"S1","shipmentOrderState":3},"Timestamp":"2018-06-05 10:00:00.5 +0200 CEST","IsDelete":"false"},` +
+				`{"TxID":"tx2","Value":null,"Timestamp":"2018-06-05 09:00:00 +0000 UTC","IsDelete":"true"}]`,
+			want:     []string{"tx1 2018-06-05T08:00:00.5Z inTransit", "tx2 2018-06-05T09:00:00Z deleted"},
+			shipment: "S1",
+		},
+		{
+			name:    "timestamp not in time.Time.String layout",
+			data:    `[{"TxID":"tx1","Value":{},"Timestamp":"2018-06-05T10:00:00Z","IsDelete":"false"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown state",
+			data:    `[{"TxID":"tx1","Value":{"shipmentOrderState":"lost"},"Timestamp":"2018-06-05 09:00:00 +0000 UTC","IsDelete":"false"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "not a history",
+			data:    `{"shipmentID":"S1"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		trace, err := ParseHistory([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		var got []string
+		for _, version := range trace.History {
+			state := "deleted"
+			if version.Shipment != nil {
+				state = version.Shipment.ShipmentOrderState.String()
+			}
+			got = append(got, version.TxID+" "+version.Timestamp.Format(time.RFC3339Nano)+" "+state)
+		}
+		if !reflect.DeepEqual(got, tt.want) || trace.ShipmentID != tt.shipment {
+			t.Errorf("%s: history = %v of %q, want %v of %q", tt.name, got, trace.ShipmentID, tt.want, tt.shipment)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package epcis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The types below mirror the JSON returned by the getShipmentTraceability and getHistoryForShipment
+// chaincode queries, limited to what the events are built from.
+
+// ShipmentOrderState is the lifecycle state of a shipment, stored as a number on the ledger
+type ShipmentOrderState int
+
+// shipment states in chaincode order
+const (
+	Waiting ShipmentOrderState = iota
+	Loading
+	Loaded
+	InTransit
+	DeliveredComplete
+	DeliveredIncomplete
+)
+
+var stateNames = []string{"waiting", "loading", "loaded", "inTransit", "deliveredComplete", "deliveredIncomplete"}
+
+func (s ShipmentOrderState) String() string {
+	if s < Waiting || int(s) >= len(stateNames) {
+		return strconv.Itoa(int(s))
+	}
+	return stateNames[s]
+}
+
+// UnmarshalJSON accepts the numeric value stored by the chaincode as well as the state name
+func (s *ShipmentOrderState) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	for state, name := range stateNames {
+		if name == value {
+			*s = ShipmentOrderState(state)
+			return nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < int(Waiting) || number >= len(stateNames) {
+		return fmt.Errorf("unknown shipmentOrderState: %s", value)
+	}
+	*s = ShipmentOrderState(number)
+	return nil
+}
+
+// Location is a ledger address, with optional GPS coordinates
+type Location struct {
+	LocationID string   `json:"locationID"`
+	Address    string   `json:"address,omitempty"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+}
+
+// sameAs compares the identity and coordinates of two locations
+func (l Location) sameAs(other Location) bool {
+	return l.LocationID == other.LocationID && sameCoordinate(l.Latitude, other.Latitude) && sameCoordinate(l.Longitude, other.Longitude)
+}
+
+func sameCoordinate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// PurchaseOrder references the order a shipment delivers
+type PurchaseOrder struct {
+	PurchaseOrderID string `json:"purchaseOrderID"`
+}
+
+// Shipment is one version of a shipment record
+type Shipment struct {
+	ShipmentID         string             `json:"shipmentID"`
+	PurchaseOrder      PurchaseOrder      `json:"purchaseOrder"`
+	Location           Location           `json:"location"`
+	ShipmentOrderState ShipmentOrderState `json:"shipmentOrderState"`
+}
+
+// LogisticsUnit is one version of a logistics unit record
+type LogisticsUnit struct {
+	LogisticsUnitID string   `json:"logisticsUnitID"`
+	ParentID        string   `json:"parentID"`
+	ShipmentID      string   `json:"shipmentID"`
+	Type            string   `json:"type"`
+	Location        Location `json:"location"`
+	PurchaseOrderID string   `json:"purchaseOrderID"`
+	Quantity        int      `json:"quantity"`
+}
+
+// ShipmentVersion is one ledger version of a shipment, Shipment is nil for a delete
+type ShipmentVersion struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Shipment  *Shipment `json:"shipment,omitempty"`
+}
+
+// LogisticsUnitVersion is one ledger version of a logistics unit, Unit is nil for a delete
+type LogisticsUnitVersion struct {
+	TxID      string         `json:"txID"`
+	Timestamp time.Time      `json:"timestamp"`
+	IsDelete  bool           `json:"isDelete"`
+	Unit      *LogisticsUnit `json:"unit,omitempty"`
+}
+
+// LogisticsUnitTrace is the history of one logistics unit of the shipment
+type LogisticsUnitTrace struct {
+	LogisticsUnitID string                 `json:"logisticsUnitID"`
+	History         []LogisticsUnitVersion `json:"history"`
+}
+
+// PositionFix is a GPS fix of the shipment route
+type PositionFix struct {
+	DeviceID   string    `json:"deviceID,omitempty"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	RecordedAt time.Time `json:"recordedAt"`
+	TxID       string    `json:"txID"`
+}
+
+// ShipmentTraceability is the result of the getShipmentTraceability query
+type ShipmentTraceability struct {
+	ShipmentID     string               `json:"shipmentID"`
+	History        []ShipmentVersion    `json:"history"`
+	LogisticsUnits []LogisticsUnitTrace `json:"logisticsUnits"`
+	Route          []PositionFix        `json:"route"`
+}
+
+// historyTimestampLayout is how getHistoryForShipment prints timestamps (time.Time.String)
+const historyTimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// historyRecord is one entry of the getHistoryForShipment result
+type historyRecord struct {
+	TxID      string          `json:"TxID"`
+	Value     json.RawMessage `json:"Value"`
+	Timestamp string          `json:"Timestamp"`
+	IsDelete  string          `json:"IsDelete"`
+}
+
+// ParseHistory reads the result of getHistoryForShipment, for exports without the logistics units
+// and the route of getShipmentTraceability
+func ParseHistory(data []byte) (*ShipmentTraceability, error) {
+	var records []historyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	trace := &ShipmentTraceability{}
+	for i, record := range records {
+		timestamp, err := time.Parse(historyTimestampLayout, record.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("history entry %d: %s", i, err.Error())
+		}
+		version := ShipmentVersion{TxID: record.TxID, Timestamp: timestamp.UTC(), IsDelete: record.IsDelete == "true"}
+		if !version.IsDelete {
+			version.Shipment = &Shipment{}
+			if err = json.Unmarshal(record.Value, version.Shipment); err != nil {
+				return nil, fmt.Errorf("history entry %d: %s", i, err.Error())
+			}
+			trace.ShipmentID = version.Shipment.ShipmentID
+		}
+		trace.History = append(trace.History, version)
+	}
+	return trace, nil
+}
@@ -14,5 +14,6 @@ export CORE_PEER_LOCALMSPID="Org1MSP"
 export CORE_PEER_ADDRESS="dev-peer0-xyz:7051"
 export CHANNEL_NAME="mychannel"
 #instantiating  chain code
+# a blank init argument keeps the admin MSP configured at instantiation
 
 kubectl exec $CLI_POD_ID -it -- bash -c "CORE_PEER_LOCALMSPID=$CORE_PEER_LOCALMSPID && CORE_PEER_MSPCONFIGPATH=$CORE_PEER_MSPCONFIGPATH && CORE_PEER_ADDRESS=$CORE_PEER_ADDRESS && peer chaincode upgrade -o $ORDERER_ADDR -C $CHANNEL_NAME -n mycc -v 15.0 -c '{\"Args\":[\"init\",\" \"]}' -P \"OR ('Org1MSP.peer','Org2MSP.peer')\""